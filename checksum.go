@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// errChecksumMismatch marks a processed asset serving other bytes than were uploaded
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// fileSHA256 returns the hex-encoded SHA-256 of a local file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyAssetFiles downloads the processed asset's file in each locale of uploaded and
+// compares its SHA-256 with that of the uploaded file, recording both in the run report.
+// Returns the status of the failed call and an error naming the first mismatch.
+func verifyAssetFiles(ctx context.Context, client *contentful.Client, assetID, locale string, uploaded map[string]string) (int, error) {
+	asset, status, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: assetID, Locale: locale})
+	if err != nil {
+		return status, fmt.Errorf("fetch asset %s: %w", assetID, err)
+	}
+	for _, l := range slices.Sorted(maps.Keys(uploaded)) {
+		served, status, err := client.ChecksumAssetFile(ctx, asset.InLocale(l))
+		if err != nil {
+			return status, fmt.Errorf("download %s file of asset %s: %w", l, assetID, err)
+		}
+		match := served.SHA256 == uploaded[l]
+		noteChecksum(ctx, checksumRecord{AssetID: assetID, Locale: l, Uploaded: uploaded[l], Served: served.SHA256, Match: match})
+		if !match {
+			return status, fmt.Errorf("%w: %s file of asset %s has sha256 %s, uploaded file has %s", errChecksumMismatch, l, assetID, served.SHA256, uploaded[l])
+		}
+	}
+	return 0, nil
+}
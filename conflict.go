@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// Version conflict policies selected with -on-conflict
+const (
+	conflictFail    = "fail"    // abandon the row on a 409 VersionMismatch
+	conflictRefetch = "refetch" // read the current version and retry when the content is unchanged
+)
+
+// maxConflictRetries bounds how often one call is retried after version conflicts
+const maxConflictRetries = 3
+
+// isConflict reports whether err is a CMA version conflict
+func isConflict(err error) bool {
+	return contentful.ErrorCategory(err) == contentful.ErrorVersionMismatch
+}
+
+// patchEntryLinks patches the entry's links from oldAssetID to req.NewAssetID. With the
+// refetch policy, a version conflict rereads the entry and retries at its current version
+// as long as every link still points at oldAssetID; otherwise the changed links are reported.
+// When the caller publishes the patched entry, the retry also needs every change made
+// meanwhile to be published already, so publishing releases no one else's draft.
+func patchEntryLinks(ctx context.Context, client *contentful.Client, conflicts string, req contentful.PatchEntryAssetLinkRequest, oldAssetID string, publishing bool) (int, int, error) {
+	for attempt := 0; ; attempt++ {
+		version, status, err := client.PatchEntryAssetLink(ctx, req)
+		if err == nil || conflicts != conflictRefetch || !isConflict(err) || attempt == maxConflictRetries {
+			return version, status, err
+		}
+		current, fetchStatus, ferr := client.FetchEntry(ctx, linksFetchReq(req.EntryID, req.Links))
+		if ferr != nil {
+			return 0, fetchStatus, fmt.Errorf("%v; refetch after conflict: %w", err, ferr)
+		}
+		if changes := linkChanges(current, req.Links, oldAssetID); len(changes) > 0 {
+			return 0, status, fmt.Errorf("version conflict: entry %s changed since it was read: %s", req.EntryID, strings.Join(changes, "; "))
+		}
+		if publishing && !republishable(current) {
+			return 0, status, fmt.Errorf("version conflict: entry %s has unpublished changes made since it was read", req.EntryID)
+		}
+		req.Version = current.Version
+	}
+}
+
+// publishEntryLinks publishes the entry at the version its patch produced. A version conflict
+// means the entry changed after the patch, and publishing it at another version would
+// release someone else's changes, so it is never retried. With the refetch policy, the entry
+// is reread instead: one published since with every link still pointing at assetID and no
+// pending changes counts as done; otherwise the conflict is reported.
+func publishEntryLinks(ctx context.Context, client *contentful.Client, conflicts string, req contentful.PublishEntryRequest, links []contentful.AssetLink, assetID string) (int, error) {
+	status, err := client.PublishEntry(ctx, req)
+	if err == nil || conflicts != conflictRefetch || !isConflict(err) {
+		return status, err
+	}
+	current, fetchStatus, ferr := client.FetchEntry(ctx, linksFetchReq(req.EntryID, links))
+	if ferr != nil {
+		return fetchStatus, fmt.Errorf("%v; refetch after conflict: %w", err, ferr)
+	}
+	if changes := linkChanges(current, links, assetID); len(changes) > 0 {
+		return status, fmt.Errorf("version conflict: entry %s changed since it was patched: %s", req.EntryID, strings.Join(changes, "; "))
+	}
+	if current.PublishedVersion < req.Version || !republishable(current) {
+		return status, fmt.Errorf("version conflict: entry %s has changes made since it was patched; not published", req.EntryID)
+	}
+	return fetchStatus, nil
+}
+
+// unpublishAsset unpublishes the asset read as before. With the refetch policy, a version
+// conflict rereads the asset and retries at its current version as long as its files are
+// unchanged; an asset someone else unpublished meanwhile counts as done.
+func unpublishAsset(ctx context.Context, client *contentful.Client, conflicts string, req contentful.UnpublishAssetRequest, before contentful.Asset) (int, int, error) {
+	for attempt := 0; ; attempt++ {
+		version, status, err := client.UnpublishAsset(ctx, req)
+		if err == nil || conflicts != conflictRefetch || !isConflict(err) || attempt == maxConflictRetries {
+			return version, status, err
+		}
+		current, fetchStatus, ferr := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: req.AssetID, Locale: before.Locale})
+		if ferr != nil {
+			return 0, fetchStatus, fmt.Errorf("%v; refetch after conflict: %w", err, ferr)
+		}
+		if changes := fileChanges(before, current); len(changes) > 0 {
+			return 0, status, fmt.Errorf("version conflict: asset %s changed since it was read: %s", req.AssetID, strings.Join(changes, "; "))
+		}
+		if current.PublishedVersion == 0 {
+			return current.Version, fetchStatus, nil
+		}
+		req.Version = current.Version
+	}
+}
+
+// archiveAsset archives the asset read as before. With the refetch policy, a version conflict
+// rereads the asset and retries at its current version as long as its files are unchanged;
+// an asset someone else archived meanwhile counts as done.
+func archiveAsset(ctx context.Context, client *contentful.Client, conflicts string, req contentful.ArchiveAssetRequest, before contentful.Asset) (int, error) {
+	for attempt := 0; ; attempt++ {
+		status, err := client.ArchiveAsset(ctx, req)
+		if err == nil || conflicts != conflictRefetch || !isConflict(err) || attempt == maxConflictRetries {
+			return status, err
+		}
+		current, fetchStatus, ferr := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: req.AssetID, Locale: before.Locale})
+		if ferr != nil {
+			return fetchStatus, fmt.Errorf("%v; refetch after conflict: %w", err, ferr)
+		}
+		if changes := fileChanges(before, current); len(changes) > 0 {
+			return status, fmt.Errorf("version conflict: asset %s changed since it was read: %s", req.AssetID, strings.Join(changes, "; "))
+		}
+		if current.ArchivedAt != "" {
+			return fetchStatus, nil
+		}
+		req.Version = current.Version
+	}
+}
+
+// unarchiveAsset unarchives the asset read as before. With the refetch policy, a version
+// conflict rereads the asset and retries at its current version as long as its files are
+// unchanged; an asset someone else unarchived meanwhile counts as done.
+func unarchiveAsset(ctx context.Context, client *contentful.Client, conflicts string, req contentful.UnarchiveAssetRequest, before contentful.Asset) (int, int, error) {
+	for attempt := 0; ; attempt++ {
+		version, status, err := client.UnarchiveAsset(ctx, req)
+		if err == nil || conflicts != conflictRefetch || !isConflict(err) || attempt == maxConflictRetries {
+			return version, status, err
+		}
+		current, fetchStatus, ferr := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: req.AssetID, Locale: before.Locale})
+		if ferr != nil {
+			return 0, fetchStatus, fmt.Errorf("%v; refetch after conflict: %w", err, ferr)
+		}
+		if changes := fileChanges(before, current); len(changes) > 0 {
+			return 0, status, fmt.Errorf("version conflict: asset %s changed since it was read: %s", req.AssetID, strings.Join(changes, "; "))
+		}
+		if current.ArchivedAt == "" {
+			return current.Version, fetchStatus, nil
+		}
+		req.Version = current.Version
+	}
+}
+
+// publishAsset publishes the asset read as before. With the refetch policy, a version
+// conflict rereads the asset and retries at its current version as long as its files are
+// unchanged; an asset someone else published meanwhile counts as done.
+func publishAsset(ctx context.Context, client *contentful.Client, conflicts string, req contentful.PublishAssetRequest, before contentful.Asset) (int, error) {
+	for attempt := 0; ; attempt++ {
+		_, status, err := client.PublishAsset(ctx, req)
+		if err == nil || conflicts != conflictRefetch || !isConflict(err) || attempt == maxConflictRetries {
+			return status, err
+		}
+		current, fetchStatus, ferr := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: req.AssetID, Locale: before.Locale})
+		if ferr != nil {
+			return fetchStatus, fmt.Errorf("%v; refetch after conflict: %w", err, ferr)
+		}
+		if changes := fileChanges(before, current); len(changes) > 0 {
+			return status, fmt.Errorf("version conflict: asset %s changed since it was read: %s", req.AssetID, strings.Join(changes, "; "))
+		}
+		if current.PublishedVersion != 0 {
+			return fetchStatus, nil
+		}
+		req.Version = current.Version
+	}
+}
+
+// linksFetchReq returns a request that reads the fields and locales holding links
+func linksFetchReq(entryID string, links []contentful.AssetLink) contentful.FetchEntryRequest {
+	req := contentful.FetchEntryRequest{EntryID: entryID}
+	seenField, seenLocale := make(map[string]bool), make(map[string]bool)
+	for _, link := range links {
+		if !seenField[link.FieldKey] {
+			seenField[link.FieldKey] = true
+			req.FieldKeys = append(req.FieldKeys, link.FieldKey)
+		}
+		if !seenLocale[link.Locale] {
+			seenLocale[link.Locale] = true
+			req.Locales = append(req.Locales, link.Locale)
+		}
+	}
+	return req
+}
+
+// linkChanges describes each of links whose position in the entry no longer points at
+// assetID, e.g. "body.en-US/content/3 now links abc, expected def"
+func linkChanges(entry contentful.Entry, links []contentful.AssetLink, assetID string) []string {
+	current := make(map[string]string, len(entry.AssetLinks))
+	for _, link := range entry.AssetLinks {
+		current[describeLink(link)] = link.AssetID
+	}
+	var changes []string
+	for _, link := range links {
+		desc := describeLink(link)
+		got, ok := current[desc]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s no longer links an asset, expected %s", desc, assetID))
+		} else if got != assetID {
+			changes = append(changes, fmt.Sprintf("%s now links %s, expected %s", desc, got, assetID))
+		}
+	}
+	return changes
+}
+
+// fileChanges describes each locale whose file differs between two reads of an asset
+func fileChanges(before, after contentful.Asset) []string {
+	locales := make(map[string]bool)
+	for locale := range before.Files {
+		locales[locale] = true
+	}
+	for locale := range after.Files {
+		locales[locale] = true
+	}
+	sorted := make([]string, 0, len(locales))
+	for locale := range locales {
+		sorted = append(sorted, locale)
+	}
+	sort.Strings(sorted)
+
+	var changes []string
+	for _, locale := range sorted {
+		was, now := before.Files[locale].URL, after.Files[locale].URL
+		if was != now {
+			changes = append(changes, fmt.Sprintf("%s file changed from %q to %q", locale, was, now))
+		}
+	}
+	return changes
+}
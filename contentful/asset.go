@@ -3,6 +3,8 @@ package contentful
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -90,63 +93,120 @@ type AssetResponse struct {
 			ContentType string `json:"contentType"`
 		} `json:"file"`
 	} `json:"fields"`
+
+	// Unknown holds the properties this model does not know, keyed by dotted path
+	Unknown map[string]json.RawMessage `json:"-"`
 }
 
 type Asset struct {
-	ID          string
-	Version     int
+	ID               string
+	Version          int
+	PublishedVersion int    // zero when the asset is not published
+	Locale           string // locale the file, title and description were read from
+	FileName         string
+	FileURL          string
+	ContentType      string
+	Title            string
+	Description      string
+	CreatedAt        time.Time
+	ArchivedAt       string
+
+	// Every localized value, keyed by locale
+	Files        map[string]AssetFile
+	Titles       map[string]string
+	Descriptions map[string]string
+}
+
+// AssetFile is an asset's file in one locale
+type AssetFile struct {
+	URL         string
 	FileName    string
-	FileURL     string
 	ContentType string
-	Title       string
-	Description string
-	CreatedAt   time.Time
-	ArchivedAt  string
+	Size        int64
+}
+
+// FileLocales returns the locales that have a file, starting with the asset's Locale
+func (a Asset) FileLocales() []string {
+	locales := make([]string, 0, len(a.Files))
+	for locale := range a.Files {
+		if locale != a.Locale {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	if _, ok := a.Files[a.Locale]; ok {
+		locales = append([]string{a.Locale}, locales...)
+	}
+	return locales
+}
+
+// InLocale returns a copy of the asset whose file, title and description are those of locale
+func (a Asset) InLocale(locale string) Asset {
+	f := a.Files[locale]
+	a.Locale = locale
+	a.FileURL = f.URL
+	a.FileName = f.FileName
+	a.ContentType = f.ContentType
+	a.Title = a.Titles[locale]
+	a.Description = a.Descriptions[locale]
+	return a
 }
 
 // CreateAssetRequest contains all the parameters needed to create a new asset
 type CreateAssetRequest struct {
 	Asset             Asset
-	SpaceID           string
-	Environment       string
 	Locale            string
 	FilePath          string
-	HeaderName        string
-	Scheme            string
-	Token             string
-	OriginalCreatedAt time.Time // Original asset creation timestamp
+	FilePaths         map[string]string       // local file per locale; when set, FilePath is ignored
+	Uploads           map[string]UploadedFile // files already sent with StreamAssetFile, per locale
+	OriginalCreatedAt time.Time               // Original asset creation timestamp
+}
+
+// ProcessAndPublishAssetRequest contains all the parameters needed to process and publish a
+// newly created asset
+type ProcessAndPublishAssetRequest struct {
+	AssetID string
+}
+
+// ReplaceAssetFileRequest contains all the parameters needed to replace an asset's files in place
+type ReplaceAssetFileRequest struct {
+	Asset             Asset // the asset to update, at its current version
+	Locale            string
+	FilePath          string
+	FilePaths         map[string]string       // local file per locale; when set, FilePath is ignored
+	Uploads           map[string]UploadedFile // files already sent with StreamAssetFile, per locale
+	OriginalCreatedAt time.Time               // Original asset creation timestamp
+	Publish           bool                    // republish the asset once processed; drafts are left unpublished
 }
 
 // FetchAssetRequest contains all the parameters needed to fetch an asset
 type FetchAssetRequest struct {
-	SpaceID     string
-	Environment string
-	AssetID     string
-	HeaderName  string
-	Scheme      string
-	Token       string
+	AssetID string
+	Locale  string // locale to read; falls back to DefaultLocale when the asset has no file in it
 }
 
 // ArchiveAssetRequest contains all the parameters needed to archive an asset
 type ArchiveAssetRequest struct {
-	SpaceID     string
-	Environment string
-	AssetID     string
-	Version     int
-	HeaderName  string
-	Scheme      string
-	Token       string
+	AssetID string
+	Version int
 }
 
 // UnpublishAssetRequest contains all the parameters needed to unpublish an asset
 type UnpublishAssetRequest struct {
-	SpaceID     string
-	Environment string
-	AssetID     string
-	Version     int
-	HeaderName  string
-	Scheme      string
-	Token       string
+	AssetID string
+	Version int
+}
+
+// PublishAssetRequest contains all the parameters needed to publish an asset
+type PublishAssetRequest struct {
+	AssetID string
+	Version int
+}
+
+// UnarchiveAssetRequest contains all the parameters needed to unarchive an asset
+type UnarchiveAssetRequest struct {
+	AssetID string
+	Version int
 }
 
 // DownloadAssetRequest contains all the parameters needed to download an asset
@@ -156,26 +216,26 @@ type DownloadAssetRequest struct {
 }
 
 // FetchAsset retrieves an asset from Contentful API
-func FetchAsset(ctx context.Context, client *http.Client, req FetchAssetRequest) (Asset, int, error) {
+func (c *Client) FetchAsset(ctx context.Context, req FetchAssetRequest) (Asset, int, error) {
 	// Extract values from the request struct
-	spaceID := req.SpaceID
-	environment := req.Environment
 	assetID := req.AssetID
-	headerName := req.HeaderName
-	scheme := req.Scheme
-	token := req.Token
+	locale := req.Locale
+
+	if strings.TrimSpace(locale) == "" {
+		locale = DefaultLocale
+	}
 
 	// Build the asset URL
-	url := fmt.Sprintf("https://api.contentful.com/spaces/%s/environments/%s/assets/%s", spaceID, environment, assetID)
+	url := c.envURL("/assets/%s", assetID)
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, ensureHTTPS(url), nil)
+	httpReq, err := newRequest(ctx, "fetch asset", http.MethodGet, url, nil)
 	if err != nil {
 		return Asset{}, 0, err
 	}
 	httpReq.Header.Set("Accept", "application/json")
-	httpReq.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
+	c.authorize(httpReq)
 
-	resp, err := client.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return Asset{}, 0, err
 	}
@@ -183,150 +243,116 @@ func FetchAsset(ctx context.Context, client *http.Client, req FetchAssetRequest)
 
 	status := resp.StatusCode
 	if status < 200 || status >= 300 {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return Asset{}, status, fmt.Errorf("unexpected status %d: %s", status, strings.TrimSpace(string(body)))
+		return Asset{}, status, newAPIError("", resp)
 	}
 
-	var asset AssetResponse
-	dec := json.NewDecoder(resp.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&asset); err != nil {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
 		return Asset{}, status, err
 	}
-
-	var fileURL string
-	var fileName string
-	var contentType string
-	if f, ok := asset.Fields.File["en-US"]; ok {
-		fileURL = f.URL
-		fileName = f.FileName
-		contentType = f.ContentType
+	asset, err := c.decodeAsset(body)
+	if err != nil {
+		return Asset{}, status, err
 	}
 
-	var title string
-	var description string
-	if t, ok := asset.Fields.Title["en-US"]; ok {
-		title = t
+	return newAsset(asset, locale), status, nil
+}
+
+// newAsset builds the caller DTO from a response, reading the requested locale, or the
+// default locale if the asset has no file in it
+func newAsset(ar AssetResponse, locale string) Asset {
+	if strings.TrimSpace(locale) == "" {
+		locale = DefaultLocale
+	}
+	if _, ok := ar.Fields.File[locale]; !ok {
+		locale = DefaultLocale
 	}
-	if d, ok := asset.Fields.Description["en-US"]; ok {
-		description = d
+
+	files := make(map[string]AssetFile, len(ar.Fields.File))
+	for l, f := range ar.Fields.File {
+		files[l] = AssetFile{URL: f.URL, FileName: f.FileName, ContentType: f.ContentType, Size: f.Details.Size}
 	}
 
 	var archivedAt string
-	if asset.Sys.ArchivedAt != nil {
-		archivedAt = asset.Sys.ArchivedAt.Format(time.RFC3339)
+	if ar.Sys.ArchivedAt != nil {
+		archivedAt = ar.Sys.ArchivedAt.Format(time.RFC3339)
 	}
 
 	return Asset{
-		ID:          asset.Sys.ID,
-		Version:     asset.Sys.Version,
-		FileName:    fileName,
-		FileURL:     fileURL,
-		ContentType: contentType,
-		Title:       title,
-		Description: description,
-		CreatedAt:   asset.Sys.CreatedAt,
-		ArchivedAt:  archivedAt,
-	}, status, nil
-}
-
-// CreateAndPublishAssetFromFile uploads a binary file and creates a new Asset referencing it, setting title and description. Returns new asset ID.
-func CreateAndPublishAssetFromFile(ctx context.Context, client *http.Client, req CreateAssetRequest) (string, int, error) {
+		ID:               ar.Sys.ID,
+		Version:          ar.Sys.Version,
+		PublishedVersion: ar.Sys.PublishedVersion,
+		CreatedAt:        ar.Sys.CreatedAt,
+		ArchivedAt:       archivedAt,
+		Files:            files,
+		Titles:           ar.Fields.Title,
+		Descriptions:     ar.Fields.Description,
+	}.InLocale(locale)
+}
+
+// CreateAndPublishAssetFromFile creates a new asset from files with CreateAsset, then processes
+// and publishes it with ProcessAndPublishAsset. Returns the new asset ID, also when a later
+// step failed.
+func (c *Client) CreateAndPublishAssetFromFile(ctx context.Context, req CreateAssetRequest) (string, int, error) {
+	newAssetID, status, err := c.CreateAsset(ctx, req)
+	if err != nil {
+		return "", status, err
+	}
+	_, status, err = c.ProcessAndPublishAsset(ctx, ProcessAndPublishAssetRequest{AssetID: newAssetID})
+	return newAssetID, status, err
+}
+
+// CreateAsset uploads binary files and creates a new draft Asset referencing them, setting title and description.
+// With FilePaths, every localized file, title and description is carried over. The files still
+// have to be processed, e.g. with ProcessAndPublishAsset. Returns new asset ID.
+func (c *Client) CreateAsset(ctx context.Context, req CreateAssetRequest) (string, int, error) {
 	// Extract values from the request struct
-	spaceID := req.SpaceID
-	environment := req.Environment
 	locale := req.Locale
 	filePath := req.FilePath
-	fileName := req.Asset.FileName
-	contentType := req.Asset.ContentType
-	title := req.Asset.Title
-	description := req.Asset.Description
-	headerName := req.HeaderName
-	scheme := req.Scheme
-	token := req.Token
+	filePaths := req.FilePaths
+	asset := req.Asset
 	originalCreatedAt := req.OriginalCreatedAt.Format("20060102_150405")
 
-	if strings.TrimSpace(fileName) == "" {
-		fileName = filepath.Base(strings.TrimSpace(filePath))
-	}
-
-	// Remove timestamp from filename if it was added during download
-	fileName = removeTimestampFromFilename(fileName, originalCreatedAt)
-
 	if strings.TrimSpace(locale) == "" {
-		locale = "en-US"
+		locale = DefaultLocale
 	}
-
-	// 1) Upload binary
-	f, err := os.Open(filePath)
-	if err != nil {
-		return "", 0, err
+	if len(filePaths) == 0 && len(req.Uploads) == 0 {
+		filePaths = map[string]string{locale: filePath}
 	}
-	defer f.Close()
 
-	uploadURL := fmt.Sprintf("https://upload.contentful.com/spaces/%s/uploads", spaceID)
-	upReq, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, f)
+	// 1) Upload each localized binary
+	fileFields, defaultTitle, status, err := c.uploadAssetFiles(ctx, asset, locale, filePaths, req.Uploads, originalCreatedAt)
 	if err != nil {
-		return "", 0, err
-	}
-	upReq.Header.Set("Content-Type", "application/octet-stream")
-	upReq.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
-	upResp, err := client.Do(upReq)
-	if err != nil {
-		return "", 0, err
-	}
-	defer upResp.Body.Close()
-	if upResp.StatusCode < 200 || upResp.StatusCode >= 300 {
-		body, _ := io.ReadAll(io.LimitReader(upResp.Body, 4096))
-		return "", upResp.StatusCode, fmt.Errorf("upload failed: %s", strings.TrimSpace(string(body)))
-	}
-	var uploadRes struct {
-		Sys struct {
-			ID string `json:"id"`
-		} `json:"sys"`
-	}
-	if err := json.NewDecoder(upResp.Body).Decode(&uploadRes); err != nil {
-		return "", upResp.StatusCode, err
+		return "", status, err
 	}
 
-	// 2) Create asset referencing the upload
-	createURL := fmt.Sprintf("https://api.contentful.com/spaces/%s/environments/%s/assets", spaceID, environment)
-	if strings.TrimSpace(title) == "" {
-		title = fileName
-	}
+	// 2) Create asset referencing the uploads, carrying over every localized title and description
+	createURL := c.envURL("/assets")
+	titles, descriptions := assetTexts(asset, locale, defaultTitle)
 	payload := map[string]any{
 		"fields": map[string]any{
-			"title":       map[string]string{locale: title},
-			"description": map[string]string{locale: description},
-			"file": map[string]any{locale: map[string]any{
-				"fileName":    fileName,
-				"contentType": contentType,
-				"uploadFrom": map[string]any{"sys": map[string]string{
-					"type":     "Link",
-					"linkType": "Upload",
-					"id":       uploadRes.Sys.ID,
-				}},
-			}},
+			"title":       titles,
+			"description": descriptions,
+			"file":        fileFields,
 		},
 	}
 	bodyBytes, err := json.Marshal(payload)
 	if err != nil {
 		return "", 0, err
 	}
-	crReq, err := http.NewRequestWithContext(ctx, http.MethodPost, createURL, bytes.NewReader(bodyBytes))
+	crReq, err := newRequest(ctx, "create asset", http.MethodPost, createURL, bytes.NewReader(bodyBytes))
 	if err != nil {
 		return "", 0, err
 	}
 	crReq.Header.Set("Content-Type", "application/vnd.contentful.management.v1+json")
-	crReq.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
-	crResp, err := client.Do(crReq)
+	c.authorize(crReq)
+	crResp, err := c.do(crReq)
 	if err != nil {
 		return "", 0, err
 	}
 	defer crResp.Body.Close()
 	if crResp.StatusCode < 200 || crResp.StatusCode >= 300 {
-		body, _ := io.ReadAll(io.LimitReader(crResp.Body, 4096))
-		return "", crResp.StatusCode, fmt.Errorf("create asset failed: %s", strings.TrimSpace(string(body)))
+		return "", crResp.StatusCode, newAPIError("create asset", crResp)
 	}
 	var created struct {
 		Sys struct {
@@ -336,131 +362,396 @@ func CreateAndPublishAssetFromFile(ctx context.Context, client *http.Client, req
 	if err := json.NewDecoder(crResp.Body).Decode(&created); err != nil {
 		return "", crResp.StatusCode, err
 	}
-	newAssetID := created.Sys.ID
+	return created.Sys.ID, crResp.StatusCode, nil
+}
 
-	// 3) Request processing of the file
-	processURL := fmt.Sprintf("https://api.contentful.com/spaces/%s/environments/%s/assets/%s/files/%s/process", spaceID, environment, newAssetID, locale)
-	prReq, err := http.NewRequestWithContext(ctx, http.MethodPut, processURL, nil)
+// ProcessAndPublishAsset processes each localized file of a new asset, waits until every file
+// URL is available and publishes the asset. Files an interrupted earlier call already
+// processed are not processed again, and an asset it already published is left as it is, so
+// the call can be repeated. Returns the asset's published version.
+func (c *Client) ProcessAndPublishAsset(ctx context.Context, req ProcessAndPublishAssetRequest) (int, int, error) {
+	// 1) Read the asset to find its files and the ones still waiting for processing
+	getReq, err := newRequest(ctx, "fetch asset", http.MethodGet, c.envURL("/assets/%s", req.AssetID), nil)
 	if err != nil {
-		return newAssetID, 0, err
+		return 0, 0, err
 	}
-	prReq.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
-	prReq.Header.Set("Accept", "application/vnd.contentful.management.v1+json")
-	prResp, err := client.Do(prReq)
+	getReq.Header.Set("Accept", "application/vnd.contentful.management.v1+json")
+	c.authorize(getReq)
+	getResp, err := c.do(getReq)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer getResp.Body.Close()
+	if getResp.StatusCode < 200 || getResp.StatusCode >= 300 {
+		return 0, getResp.StatusCode, newAPIError("get asset "+req.AssetID, getResp)
+	}
+	var current struct {
+		Sys    versionedSys `json:"sys"`
+		Fields struct {
+			File map[string]struct {
+				URL string `json:"url"`
+			} `json:"file"`
+		} `json:"fields"`
+	}
+	if err := json.NewDecoder(getResp.Body).Decode(&current); err != nil {
+		return 0, getResp.StatusCode, err
+	}
+	var locales, pending []string
+	for l, f := range current.Fields.File {
+		locales = append(locales, l)
+		if strings.TrimSpace(f.URL) == "" {
+			pending = append(pending, l)
+		}
+	}
+	if len(locales) == 0 {
+		return 0, getResp.StatusCode, fmt.Errorf("asset %s has no file to process", req.AssetID)
+	}
+	sort.Strings(locales)
+	sort.Strings(pending)
+	if len(pending) == 0 && current.Sys.PublishedVersion != 0 && current.Sys.Version == current.Sys.PublishedVersion+1 {
+		return current.Sys.Version, getResp.StatusCode, nil
+	}
+
+	// 2) Request processing of each localized file
+	if status, err := c.processAssetFiles(ctx, req.AssetID, pending); err != nil {
+		return 0, status, err
+	}
+
+	// 3) Poll until processing completes and every file URL is available, capturing latest version
+	latestVersion, status, err := c.waitForAssetFiles(ctx, req.AssetID, locales)
+	if err != nil {
+		return 0, status, err
+	}
+
+	// 4) Publish the asset
+	return c.PublishAsset(ctx, PublishAssetRequest{AssetID: req.AssetID, Version: latestVersion})
+}
+
+// ReplaceAssetFile uploads binary files and puts them onto the existing asset in place, keeping
+// its ID, then processes it and, with Publish, republishes it. Locales without a file path keep
+// their current file. Returns the asset's latest version.
+func (c *Client) ReplaceAssetFile(ctx context.Context, req ReplaceAssetFileRequest) (int, int, error) {
+	// Extract values from the request struct
+	locale := req.Locale
+	filePath := req.FilePath
+	filePaths := req.FilePaths
+	asset := req.Asset
+	originalCreatedAt := req.OriginalCreatedAt.Format("20060102_150405")
+
+	if strings.TrimSpace(locale) == "" {
+		locale = DefaultLocale
+	}
+	if len(filePaths) == 0 && len(req.Uploads) == 0 {
+		filePaths = map[string]string{locale: filePath}
+	}
+	locales := sortedLocales(filePaths, req.Uploads)
+
+	// 1) Upload each localized binary
+	fileFields, defaultTitle, status, err := c.uploadAssetFiles(ctx, asset, locale, filePaths, req.Uploads, originalCreatedAt)
+	if err != nil {
+		return 0, status, err
+	}
+	for l, f := range asset.Files {
+		if _, ok := fileFields[l]; !ok && strings.TrimSpace(f.URL) != "" {
+			fileFields[l] = map[string]any{"url": f.URL, "fileName": f.FileName, "contentType": f.ContentType}
+		}
+	}
+
+	// 2) Put the uploads onto the asset with its current version
+	titles, descriptions := assetTexts(asset, locale, defaultTitle)
+	payload := map[string]any{
+		"fields": map[string]any{
+			"title":       titles,
+			"description": descriptions,
+			"file":        fileFields,
+		},
+	}
+	bodyBytes, err := json.Marshal(payload)
+	if err != nil {
+		return 0, 0, err
+	}
+	putReq, err := newRequest(ctx, "update asset", http.MethodPut, c.envURL("/assets/%s", asset.ID), bytes.NewReader(bodyBytes))
+	if err != nil {
+		return 0, 0, err
+	}
+	putReq.Header.Set("Content-Type", "application/vnd.contentful.management.v1+json")
+	putReq.Header.Set("X-Contentful-Version", fmt.Sprintf("%d", asset.Version))
+	c.authorize(putReq)
+	putResp, err := c.doVersioned(putReq, c.envURL("/assets/%s", asset.ID), updatedAt(asset.Version, uploadPointers(fileFields)))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer putResp.Body.Close()
+	if putResp.StatusCode < 200 || putResp.StatusCode >= 300 {
+		return 0, putResp.StatusCode, newAPIError("update asset", putResp)
+	}
+
+	// 3) Request processing of each new localized file
+	if status, err := c.processAssetFiles(ctx, asset.ID, locales); err != nil {
+		return 0, status, err
+	}
+
+	// 4) Poll until processing completes and every new file URL is available
+	latestVersion, status, err := c.waitForAssetFiles(ctx, asset.ID, locales)
 	if err != nil {
-		return newAssetID, 0, err
+		return 0, status, err
 	}
-	prResp.Body.Close()
 
-	// 4) Poll until processing completes and file URL is available, capturing latest version
-	getURL := fmt.Sprintf("https://api.contentful.com/spaces/%s/environments/%s/assets/%s", spaceID, environment, newAssetID)
-	var latestVersion int
-	var hasURL bool
+	// 5) Republish the asset
+	if !req.Publish {
+		return latestVersion, status, nil
+	}
+	return c.PublishAsset(ctx, PublishAssetRequest{AssetID: asset.ID, Version: latestVersion})
+}
+
+// uploadAssetFiles uploads each localized file and returns the file field values referencing
+// the uploads, along with the file name used for locale as a fallback title. Locales in
+// uploads were sent already and are only referenced.
+func (c *Client) uploadAssetFiles(ctx context.Context, asset Asset, locale string, filePaths map[string]string, uploads map[string]UploadedFile, originalCreatedAt string) (map[string]any, string, int, error) {
+	fileFields := make(map[string]any, len(filePaths)+len(uploads))
+	var defaultTitle string
+	for _, l := range sortedLocales(filePaths, uploads) {
+		// Use the requested locale's top-level values, and the localized file details otherwise
+		fileName, contentType := asset.FileName, asset.ContentType
+		if l != locale {
+			fileName, contentType = asset.Files[l].FileName, asset.Files[l].ContentType
+		}
+		uploaded, streamed := uploads[l]
+		if strings.TrimSpace(fileName) == "" {
+			fileName = filepath.Base(strings.TrimSpace(filePaths[l]))
+			if streamed {
+				fileName = uploaded.FileName
+			}
+		}
+
+		// Remove timestamp from filename if it was added during download
+		fileName = removeTimestampFromFilename(fileName, originalCreatedAt)
+
+		uploadID := uploaded.UploadID
+		if !streamed {
+			id, status, err := c.uploadFile(ctx, filePaths[l])
+			if err != nil {
+				return nil, "", status, err
+			}
+			uploadID = id
+		}
+		fileFields[l] = map[string]any{
+			"fileName":    fileName,
+			"contentType": contentType,
+			"uploadFrom": map[string]any{"sys": map[string]string{
+				"type":     "Link",
+				"linkType": "Upload",
+				"id":       uploadID,
+			}},
+		}
+		if l == locale {
+			defaultTitle = fileName
+		}
+	}
+	return fileFields, defaultTitle, 0, nil
+}
+
+// uploadPointers maps the JSON pointer of each file field's upload link to the upload ID,
+// which a retried asset update checks to tell whether it was applied
+func uploadPointers(fileFields map[string]any) map[string]string {
+	pointers := make(map[string]string)
+	for l, v := range fileFields {
+		field, _ := v.(map[string]any)
+		from, _ := field["uploadFrom"].(map[string]any)
+		if sys, ok := from["sys"].(map[string]string); ok {
+			pointers["/fields/file/"+l+"/uploadFrom/sys/id"] = sys["id"]
+		}
+	}
+	return pointers
+}
+
+// assetTexts returns every localized title and description of the asset, with locale taking
+// the top-level values and defaultTitle when the title is empty
+func assetTexts(asset Asset, locale, defaultTitle string) (map[string]string, map[string]string) {
+	titles := make(map[string]string)
+	descriptions := make(map[string]string)
+	for l, t := range asset.Titles {
+		titles[l] = t
+	}
+	for l, d := range asset.Descriptions {
+		descriptions[l] = d
+	}
+	titles[locale] = asset.Title
+	if strings.TrimSpace(asset.Title) == "" {
+		titles[locale] = defaultTitle
+	}
+	descriptions[locale] = asset.Description
+	return titles, descriptions
+}
+
+// processAssetFiles requests processing of the asset's file in each locale
+func (c *Client) processAssetFiles(ctx context.Context, assetID string, locales []string) (int, error) {
+	for _, l := range locales {
+		processURL := c.envURL("/assets/%s/files/%s/process", assetID, l)
+		prReq, err := newRequest(ctx, "process asset file", http.MethodPut, processURL, nil)
+		if err != nil {
+			return 0, err
+		}
+		c.authorize(prReq)
+		prReq.Header.Set("Accept", "application/vnd.contentful.management.v1+json")
+		prResp, err := c.do(prReq)
+		if err != nil {
+			return 0, err
+		}
+		if prResp.StatusCode < 200 || prResp.StatusCode >= 300 {
+			apiErr := newAPIError("process asset file ("+l+")", prResp)
+			prResp.Body.Close()
+			return prResp.StatusCode, apiErr
+		}
+		prResp.Body.Close()
+	}
+	return 0, nil
+}
+
+// waitForAssetFiles polls the asset until every locale's file URL is available and returns
+// its latest version
+func (c *Client) waitForAssetFiles(ctx context.Context, assetID string, locales []string) (int, int, error) {
+	getURL := c.envURL("/assets/%s", assetID)
 	for i := 0; i < 60; i++ { // up to ~60s
-		gr, err := http.NewRequestWithContext(ctx, http.MethodGet, getURL, nil)
+		gr, err := newRequest(ctx, "wait for asset processing", http.MethodGet, getURL, nil)
 		if err != nil {
-			return newAssetID, 0, err
+			return 0, 0, err
 		}
 		gr.Header.Set("Accept", "application/vnd.contentful.management.v1+json")
-		gr.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
-		gv, err := client.Do(gr)
+		c.authorize(gr)
+		gv, err := c.do(gr)
 		if err != nil {
-			return newAssetID, 0, err
+			return 0, 0, err
 		}
 		if gv.StatusCode < 200 || gv.StatusCode >= 300 {
-			body, _ := io.ReadAll(io.LimitReader(gv.Body, 4096))
+			apiErr := newAPIError("get asset "+assetID, gv)
 			gv.Body.Close()
-			return newAssetID, gv.StatusCode, fmt.Errorf("get created asset failed: %s", strings.TrimSpace(string(body)))
+			return 0, gv.StatusCode, apiErr
 		}
-		var createdAsset struct {
+		var polled struct {
 			Sys struct {
 				Version int `json:"version"`
 			} `json:"sys"`
-			Fields map[string]any `json:"fields"`
+			Fields struct {
+				File map[string]struct {
+					URL string `json:"url"`
+				} `json:"file"`
+			} `json:"fields"`
 		}
-		if err := json.NewDecoder(gv.Body).Decode(&createdAsset); err != nil {
+		if err := json.NewDecoder(gv.Body).Decode(&polled); err != nil {
 			gv.Body.Close()
-			return newAssetID, 0, err
+			return 0, 0, err
 		}
 		gv.Body.Close()
-		latestVersion = createdAsset.Sys.Version
-		if fAny, ok := createdAsset.Fields["file"]; ok {
-			if fMap, ok := fAny.(map[string]any); ok {
-				if locAny, ok := fMap[locale]; ok {
-					if locMap, ok := locAny.(map[string]any); ok {
-						if urlAny, ok := locMap["url"]; ok {
-							if urlStr, ok := urlAny.(string); ok && strings.TrimSpace(urlStr) != "" {
-								hasURL = true
-								break
-							}
-						}
-					}
-				}
+		processed := true
+		for _, l := range locales {
+			if strings.TrimSpace(polled.Fields.File[l].URL) == "" {
+				processed = false
+				break
 			}
 		}
-		time.Sleep(1 * time.Second)
+		if processed {
+			return polled.Sys.Version, gv.StatusCode, nil
+		}
+
+		timer := time.NewTimer(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, 0, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return 0, 0, fmt.Errorf("asset processing did not complete: file URL missing")
+}
+
+// sortedLocales returns the locales of filePaths and uploads in order
+func sortedLocales(filePaths map[string]string, uploads map[string]UploadedFile) []string {
+	locales := make([]string, 0, len(filePaths)+len(uploads))
+	for l := range filePaths {
+		locales = append(locales, l)
 	}
-	if !hasURL {
-		return newAssetID, 0, fmt.Errorf("asset processing did not complete: file URL missing")
+	for l := range uploads {
+		if _, ok := filePaths[l]; !ok {
+			locales = append(locales, l)
+		}
 	}
+	sort.Strings(locales)
+	return locales
+}
 
-	// 5) Publish the asset
-	publishURL := fmt.Sprintf("https://api.contentful.com/spaces/%s/environments/%s/assets/%s/published", spaceID, environment, newAssetID)
-	pubReq, err := http.NewRequestWithContext(ctx, http.MethodPut, publishURL, nil)
+// uploadFile sends a local file to the Upload API and returns the upload ID
+func (c *Client) uploadFile(ctx context.Context, filePath string) (string, int, error) {
+	f, err := os.Open(filePath)
 	if err != nil {
-		return newAssetID, 0, err
+		return "", 0, err
 	}
-	pubReq.Header.Set("Accept", "application/vnd.contentful.management.v1+json")
-	pubReq.Header.Set("X-Contentful-Version", fmt.Sprintf("%d", latestVersion))
-	pubReq.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
-	pubResp, err := client.Do(pubReq)
+	defer f.Close()
+
+	uploadURL := c.uploadURL("/uploads")
+	upReq, err := newRequest(ctx, "upload file", http.MethodPost, uploadURL, io.NopCloser(f))
 	if err != nil {
-		return newAssetID, 0, err
+		return "", 0, err
+	}
+	// Rewind the file for retries; a repeated upload only leaves an unused upload behind
+	upReq.GetBody = func() (io.ReadCloser, error) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(f), nil
 	}
-	defer pubResp.Body.Close()
-	if pubResp.StatusCode < 200 || pubResp.StatusCode >= 300 {
-		body, _ := io.ReadAll(io.LimitReader(pubResp.Body, 4096))
-		return newAssetID, pubResp.StatusCode, fmt.Errorf("publish asset failed: %s", strings.TrimSpace(string(body)))
+	if stat, err := f.Stat(); err == nil {
+		upReq.ContentLength = stat.Size()
 	}
-
-	return newAssetID, pubResp.StatusCode, nil
+	upReq = markRetryable(upReq)
+	upReq.Header.Set("Content-Type", "application/octet-stream")
+	c.authorize(upReq)
+	upResp, err := c.do(upReq)
+	if err != nil {
+		return "", 0, err
+	}
+	defer upResp.Body.Close()
+	if upResp.StatusCode < 200 || upResp.StatusCode >= 300 {
+		return "", upResp.StatusCode, newAPIError("upload", upResp)
+	}
+	var uploadRes struct {
+		Sys struct {
+			ID string `json:"id"`
+		} `json:"sys"`
+	}
+	if err := json.NewDecoder(upResp.Body).Decode(&uploadRes); err != nil {
+		return "", upResp.StatusCode, err
+	}
+	return uploadRes.Sys.ID, upResp.StatusCode, nil
 }
 
 // ArchiveAsset archives an asset using Contentful Management API
-func ArchiveAsset(ctx context.Context, client *http.Client, req ArchiveAssetRequest) (int, error) {
+func (c *Client) ArchiveAsset(ctx context.Context, req ArchiveAssetRequest) (int, error) {
 	// Extract values from the request struct
-	spaceID := req.SpaceID
-	environment := req.Environment
 	assetID := req.AssetID
 	version := req.Version
-	headerName := req.HeaderName
-	scheme := req.Scheme
-	token := req.Token
 
 	// Build the archive URL
-	archiveURL := fmt.Sprintf("https://api.contentful.com/spaces/%s/environments/%s/assets/%s/archived?version=%d",
-		spaceID, environment, assetID, version)
+	archiveURL := c.envURL("/assets/%s/archived?version=%d", assetID, version)
 
 	// Get the current asset to create the archive payload
-	getURL := fmt.Sprintf("https://api.contentful.com/spaces/%s/environments/%s/assets/%s",
-		spaceID, environment, assetID)
+	getURL := c.envURL("/assets/%s", assetID)
 
-	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, getURL, nil)
+	getReq, err := newRequest(ctx, "fetch asset", http.MethodGet, getURL, nil)
 	if err != nil {
 		return 0, err
 	}
 	getReq.Header.Set("Accept", "application/vnd.contentful.management.v1+json")
-	getReq.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
+	c.authorize(getReq)
 
-	getResp, err := client.Do(getReq)
+	getResp, err := c.do(getReq)
 	if err != nil {
 		return 0, err
 	}
 	defer getResp.Body.Close()
 
 	if getResp.StatusCode < 200 || getResp.StatusCode >= 300 {
-		body, _ := io.ReadAll(io.LimitReader(getResp.Body, 4096))
-		return getResp.StatusCode, fmt.Errorf("get asset failed with status %d: %s", getResp.StatusCode, strings.TrimSpace(string(body)))
+		return getResp.StatusCode, newAPIError("get asset", getResp)
 	}
 
 	// Parse the asset to create archive payload
@@ -494,16 +785,16 @@ func ArchiveAsset(ctx context.Context, client *http.Client, req ArchiveAssetRequ
 		return 0, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPut, archiveURL, bytes.NewBuffer(jsonData))
+	httpReq, err := newRequest(ctx, "archive asset", http.MethodPut, archiveURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return 0, err
 	}
 
 	httpReq.Header.Set("Content-Type", "application/vnd.contentful.management.v1+json")
 	httpReq.Header.Set("X-Contentful-Version", fmt.Sprintf("%d", version))
-	httpReq.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
+	c.authorize(httpReq)
 
-	resp, err := client.Do(httpReq)
+	resp, err := c.doVersioned(httpReq, getURL, archivedAt(version))
 	if err != nil {
 		return 0, err
 	}
@@ -511,50 +802,97 @@ func ArchiveAsset(ctx context.Context, client *http.Client, req ArchiveAssetRequ
 
 	status := resp.StatusCode
 	if status < 200 || status >= 300 {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return status, fmt.Errorf("archive failed with status %d: %s", status, strings.TrimSpace(string(body)))
+		return status, newAPIError("archive asset", resp)
 	}
 
 	return status, nil
 }
 
-// UnpublishAsset unpublishes an asset using Contentful Management API
-func UnpublishAsset(ctx context.Context, client *http.Client, req UnpublishAssetRequest) (int, error) {
+// UnpublishAsset unpublishes an asset using Contentful Management API.
+// Returns the asset's new version, which later calls such as ArchiveAsset must send.
+func (c *Client) UnpublishAsset(ctx context.Context, req UnpublishAssetRequest) (int, int, error) {
 	// Extract values from the request struct
-	spaceID := req.SpaceID
-	environment := req.Environment
 	assetID := req.AssetID
 	version := req.Version
-	headerName := req.HeaderName
-	scheme := req.Scheme
-	token := req.Token
 
 	// Build the unpublish URL
-	unpublishURL := fmt.Sprintf("https://api.contentful.com/spaces/%s/environments/%s/assets/%s/published",
-		spaceID, environment, assetID)
+	unpublishURL := c.envURL("/assets/%s/published", assetID)
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodDelete, unpublishURL, nil)
+	httpReq, err := newRequest(ctx, "unpublish asset", http.MethodDelete, unpublishURL, nil)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
 	httpReq.Header.Set("Accept", "application/vnd.contentful.management.v1+json")
 	httpReq.Header.Set("X-Contentful-Version", fmt.Sprintf("%d", version))
-	httpReq.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
+	c.authorize(httpReq)
 
-	resp, err := client.Do(httpReq)
+	resp, err := c.doVersioned(httpReq, c.envURL("/assets/%s", assetID), unpublishedAt(version))
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 	defer resp.Body.Close()
 
 	status := resp.StatusCode
 	if status < 200 || status >= 300 {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return status, fmt.Errorf("unpublish asset failed with status %d: %s", status, strings.TrimSpace(string(body)))
+		return 0, status, newAPIError("unpublish asset", resp)
 	}
 
-	return status, nil
+	var unpublished struct {
+		Sys struct {
+			Version int `json:"version"`
+		} `json:"sys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&unpublished); err != nil {
+		return 0, status, err
+	}
+
+	return unpublished.Sys.Version, status, nil
+}
+
+// PublishAsset publishes an asset with the supplied version. Returns the asset's new version.
+func (c *Client) PublishAsset(ctx context.Context, req PublishAssetRequest) (int, int, error) {
+	publishURL := c.envURL("/assets/%s/published", req.AssetID)
+	return c.changeAssetState(ctx, http.MethodPut, publishURL, req.AssetID, req.Version, "publish asset", publishedAt(req.Version))
+}
+
+// UnarchiveAsset restores an archived asset to draft. Returns the asset's new version.
+func (c *Client) UnarchiveAsset(ctx context.Context, req UnarchiveAssetRequest) (int, int, error) {
+	unarchiveURL := c.envURL("/assets/%s/archived", req.AssetID)
+	return c.changeAssetState(ctx, http.MethodDelete, unarchiveURL, req.AssetID, req.Version, "unarchive asset", unarchivedAt(req.Version))
+}
+
+// changeAssetState sends a body-less, version-locked state change and returns the new
+// version. applied recognises the changed state when a retry of the change conflicts.
+func (c *Client) changeAssetState(ctx context.Context, method, stateURL, assetID string, version int, action string, applied func(versionedSys, []byte) bool) (int, int, error) {
+	httpReq, err := newRequest(ctx, action, method, stateURL, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	httpReq.Header.Set("Accept", "application/vnd.contentful.management.v1+json")
+	httpReq.Header.Set("X-Contentful-Version", fmt.Sprintf("%d", version))
+	c.authorize(httpReq)
+
+	resp, err := c.doVersioned(httpReq, c.envURL("/assets/%s", assetID), applied)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	status := resp.StatusCode
+	if status < 200 || status >= 300 {
+		return 0, status, newAPIError(action, resp)
+	}
+
+	var changed struct {
+		Sys struct {
+			Version int `json:"version"`
+		} `json:"sys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&changed); err != nil {
+		return 0, status, err
+	}
+	return changed.Sys.Version, status, nil
 }
 
 // ensureHTTPS ensures the URL uses HTTPS protocol
@@ -594,20 +932,87 @@ func removeTimestampFromFilename(filename string, originalCreatedAt string) stri
 	return filename
 }
 
-// DownloadAssetFile downloads the asset's file to destDir and returns the saved path.
-// It derives filename from Asset.FileName, falling back to the URL basename or Asset.ID.
-// A timestamp is added to the filename to prevent duplicates.
-func DownloadAssetFile(ctx context.Context, client *http.Client, req DownloadAssetRequest) (string, int, error) {
+// CheckAssetFile sends a HEAD request for the asset's file URL to confirm it can be downloaded.
+// Returns the reported Content-Length, or -1 when the CDN does not send one.
+func (c *Client) CheckAssetFile(ctx context.Context, asset Asset) (int64, int, error) {
+	if strings.TrimSpace(asset.FileURL) == "" {
+		return 0, 0, fmt.Errorf("empty asset file URL")
+	}
+
+	httpReq, err := newRequest(ctx, "check file", http.MethodHead, ensureHTTPS(asset.FileURL), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	resp, err := c.doFile(httpReq)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, resp.StatusCode, fmt.Errorf("file check status %d", resp.StatusCode)
+	}
+	return resp.ContentLength, resp.StatusCode, nil
+}
+
+// SniffLength is the number of leading bytes content type detection looks at
+const SniffLength = 512
+
+// SniffAssetFile returns the first SniffLength bytes of the asset's file, or the whole file
+// when it is shorter, asking the CDN for just that range
+func (c *Client) SniffAssetFile(ctx context.Context, asset Asset) ([]byte, int, error) {
+	if strings.TrimSpace(asset.FileURL) == "" {
+		return nil, 0, fmt.Errorf("empty asset file URL")
+	}
+
+	httpReq, err := newRequest(ctx, "sniff file", http.MethodGet, ensureHTTPS(asset.FileURL), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	httpReq.Header.Set("Range", fmt.Sprintf("bytes=0-%d", SniffLength-1))
+
+	resp, err := c.doFile(httpReq)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	// A CDN that ignores the range sends the whole file with 200; only its start is read
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return nil, resp.StatusCode, fmt.Errorf("download status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	head, err := io.ReadAll(io.LimitReader(resp.Body, SniffLength))
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return head, resp.StatusCode, nil
+}
+
+// DownloadedFile is the size and SHA-256 of a downloaded file, and where it was saved
+type DownloadedFile struct {
+	Path   string // empty when the file was only checksummed
+	Size   int64
+	SHA256 string // hex-encoded
+}
+
+// DownloadAssetFile downloads the asset's file to destDir and returns the saved path with
+// the file's size and SHA-256. It derives filename from Asset.FileName, falling back to the
+// URL basename or Asset.ID. A timestamp is added to the filename to prevent duplicates.
+// A download shorter or longer than its Content-Length or the file's details.size fails
+// and leaves no file behind.
+func (c *Client) DownloadAssetFile(ctx context.Context, req DownloadAssetRequest) (DownloadedFile, int, error) {
 	// Extract values from the request struct
 	asset := req.Asset
 	destDir := req.DestDir
 
 	if strings.TrimSpace(asset.FileURL) == "" {
-		return "", 0, fmt.Errorf("empty asset file URL")
+		return DownloadedFile{}, 0, fmt.Errorf("empty asset file URL")
 	}
 
 	if err := os.MkdirAll(destDir, 0o755); err != nil {
-		return "", 0, err
+		return DownloadedFile{}, 0, err
 	}
 
 	fileName := strings.TrimSpace(asset.FileName)
@@ -631,30 +1036,70 @@ func DownloadAssetFile(ctx context.Context, client *http.Client, req DownloadAss
 
 	destPath := filepath.Join(destDir, fileNameWithTimestamp)
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, ensureHTTPS(asset.FileURL), nil)
+	out, err := os.Create(destPath)
 	if err != nil {
-		return "", 0, err
+		return DownloadedFile{}, 0, err
 	}
+	file, status, err := c.readAssetFile(ctx, "download file", asset, out)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(destPath)
+		return DownloadedFile{}, status, err
+	}
+	file.Path = destPath
+	return file, status, nil
+}
+
+// ChecksumAssetFile downloads the asset's file without saving it and returns its size and
+// SHA-256, checked like DownloadAssetFile
+func (c *Client) ChecksumAssetFile(ctx context.Context, asset Asset) (DownloadedFile, int, error) {
+	if strings.TrimSpace(asset.FileURL) == "" {
+		return DownloadedFile{}, 0, fmt.Errorf("empty asset file URL")
+	}
+	return c.readAssetFile(ctx, "checksum file", asset, io.Discard)
+}
 
-	resp, err := client.Do(httpReq)
+// readAssetFile copies the asset's file to w, hashing it and checking its length with
+// checkDownloadSize. step names the request in the request log.
+func (c *Client) readAssetFile(ctx context.Context, step string, asset Asset, w io.Writer) (DownloadedFile, int, error) {
+	httpReq, err := newRequest(ctx, step, http.MethodGet, ensureHTTPS(asset.FileURL), nil)
 	if err != nil {
-		return "", 0, err
+		return DownloadedFile{}, 0, err
+	}
+
+	resp, err := c.doFile(httpReq)
+	if err != nil {
+		return DownloadedFile{}, 0, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		return "", resp.StatusCode, fmt.Errorf("download status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return DownloadedFile{}, resp.StatusCode, fmt.Errorf("download status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
 
-	out, err := os.Create(destPath)
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, hash), resp.Body)
 	if err != nil {
-		return "", resp.StatusCode, err
+		return DownloadedFile{}, resp.StatusCode, err
 	}
-	defer out.Close()
-	if _, err := io.Copy(out, resp.Body); err != nil {
-		return "", resp.StatusCode, err
+	if err := checkDownloadSize(asset, resp, n); err != nil {
+		return DownloadedFile{}, resp.StatusCode, err
 	}
+	return DownloadedFile{Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}, resp.StatusCode, nil
+}
 
-	return destPath, resp.StatusCode, nil
+// checkDownloadSize reports a file download of n bytes that differs from the response's
+// Content-Length or, when the asset was read with it, the file's details.size
+func checkDownloadSize(asset Asset, resp *http.Response, n int64) error {
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return fmt.Errorf("download size mismatch: got %d bytes, Content-Length is %d", n, resp.ContentLength)
+	}
+	// A replacement URL stands in for the asset's file, whose size no longer applies
+	if f, ok := asset.Files[asset.Locale]; ok && f.URL == asset.FileURL && f.Size > 0 && n != f.Size {
+		return fmt.Errorf("download size mismatch: got %d bytes, asset file size is %d", n, f.Size)
+	}
+	return nil
 }
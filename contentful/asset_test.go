@@ -0,0 +1,32 @@
+package contentful
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWaitForAssetFilesStopsWhenCanceled(t *testing.T) {
+	// The asset's file never finishes processing
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.contentful.management.v1+json")
+		_, _ = w.Write([]byte(`{"sys": {"id": "a1", "version": 2}, "fields": {"file": {"en-US": {"fileName": "report.pdf"}}}}`))
+	}))
+	defer srv.Close()
+	client := NewClient(srv.Client(), "space", "master", "token")
+	client.BaseURL = srv.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := client.waitForAssetFiles(ctx, "a1", []string{"en-US"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waitForAssetFiles = %v, want the context's deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("waitForAssetFiles returned after %v, want it to stop waiting once the context is done", elapsed)
+	}
+}
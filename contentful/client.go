@@ -0,0 +1,124 @@
+package contentful
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the Contentful Management API base URL
+	DefaultBaseURL = "https://api.contentful.com"
+	// DefaultUploadURL is the Contentful Upload API base URL
+	DefaultUploadURL = "https://upload.contentful.com"
+	// DefaultLocale is used when a request does not name a locale
+	DefaultLocale = "en-US"
+)
+
+// Client carries the connection settings shared by every CMA call: the API base URLs,
+// the target space and environment, and how to authenticate requests.
+type Client struct {
+	HTTPClient  *http.Client
+	BaseURL     string // CMA base URL, defaults to DefaultBaseURL
+	UploadURL   string // Upload API base URL, defaults to DefaultUploadURL
+	SpaceID     string
+	Environment string
+	HeaderName  string // Authorization header name, defaults to "Authorization"
+	Scheme      string // Authorization scheme prefix, e.g. "Bearer"
+	Token       string
+
+	// Retry policy for rate-limited (429) and transient (5xx, network) failures.
+	// MaxRetries of zero disables retries.
+	MaxRetries     int
+	RetryBaseDelay time.Duration // first backoff delay, doubled per attempt
+	RetryMaxDelay  time.Duration // cap on a single wait, including X-Contentful-RateLimit-Reset
+
+	// Limiter, when set, paces every CMA and Upload API request (including retries) made
+	// through the client. Asset file requests to the CDN are not paced.
+	Limiter *RateLimiter
+
+	// Entry and asset properties the response models do not know fail the call with
+	// StrictSchema. Otherwise they are kept in the response's Unknown map, and OnSchemaDrift,
+	// when set, is called with the dotted paths not reported before, e.g. "sys.automationTags".
+	StrictSchema  bool
+	OnSchemaDrift func(kind string, keys []string)
+
+	driftMu   sync.Mutex
+	driftSeen map[string]bool
+}
+
+// NewClient returns a Client targeting the production Contentful endpoints with bearer auth
+// and the default retry policy
+func NewClient(httpClient *http.Client, spaceID, environment, token string) *Client {
+	return &Client{
+		HTTPClient:     httpClient,
+		BaseURL:        DefaultBaseURL,
+		UploadURL:      DefaultUploadURL,
+		SpaceID:        spaceID,
+		Environment:    environment,
+		HeaderName:     "Authorization",
+		Scheme:         "Bearer",
+		Token:          token,
+		MaxRetries:     DefaultMaxRetries,
+		RetryBaseDelay: DefaultRetryBaseDelay,
+		RetryMaxDelay:  DefaultRetryMaxDelay,
+	}
+}
+
+// envURL builds a CMA URL below /spaces/{space}/environments/{environment}
+func (c *Client) envURL(format string, args ...any) string {
+	base := c.BaseURL
+	if strings.TrimSpace(base) == "" {
+		base = DefaultBaseURL
+	}
+	return fmt.Sprintf("%s/spaces/%s/environments/%s", strings.TrimRight(base, "/"), c.SpaceID, c.Environment) + fmt.Sprintf(format, args...)
+}
+
+// uploadURL builds an Upload API URL below /spaces/{space}
+func (c *Client) uploadURL(format string, args ...any) string {
+	base := c.UploadURL
+	if strings.TrimSpace(base) == "" {
+		base = DefaultUploadURL
+	}
+	return fmt.Sprintf("%s/spaces/%s", strings.TrimRight(base, "/"), c.SpaceID) + fmt.Sprintf(format, args...)
+}
+
+// authorize sets the configured authorization header on the request
+func (c *Client) authorize(r *http.Request) {
+	headerName := c.HeaderName
+	if strings.TrimSpace(headerName) == "" {
+		headerName = "Authorization"
+	}
+	r.Header.Set(headerName, strings.TrimSpace(c.Scheme+" "+c.Token))
+}
+
+// do sends the request using the configured HTTP client and retry policy, recording it
+// in the context's RequestLog
+func (c *Client) do(r *http.Request) (*http.Response, error) {
+	resp, _, err := c.doCounted(r)
+	return resp, err
+}
+
+// doCounted sends the request like do, also returning the number of retries it took
+func (c *Client) doCounted(r *http.Request) (*http.Response, int, error) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	start := time.Now()
+	resp, retries, err := c.doWithRetry(httpClient, r)
+	logRequest(r, resp, retries, start, err)
+	return resp, retries, err
+}
+
+// doFile sends a request for an asset file like do, without waiting on the Limiter: the
+// CDN serving asset files is not subject to the CMA rate limit
+func (c *Client) doFile(r *http.Request) (*http.Response, error) {
+	return c.do(r.WithContext(context.WithValue(r.Context(), fileRequestKey{}, true)))
+}
+
+// fileRequestKey flags a request sent with doFile
+type fileRequestKey struct{}
@@ -0,0 +1,170 @@
+package contentfultest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// patchOp is a single RFC 6902 JSON Patch operation
+type patchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// applyPatch applies an add, replace or remove operation to doc in place.
+// Paths are JSON Pointers and may address map keys and array indices.
+func applyPatch(doc map[string]any, op patchOp) error {
+	tokens, err := splitPointer(op.Path)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("cannot %s the document root", op.Op)
+	}
+
+	// Walk to the parent of the target, creating maps for add operations
+	var parent any = doc
+	for i, tok := range tokens[:len(tokens)-1] {
+		switch p := parent.(type) {
+		case map[string]any:
+			next, ok := p[tok]
+			if !ok {
+				if op.Op != "add" {
+					return fmt.Errorf("path %s: %q not found", op.Path, strings.Join(tokens[:i+1], "/"))
+				}
+				next = map[string]any{}
+				p[tok] = next
+			}
+			parent = next
+		case []any:
+			idx, err := arrayIndex(tok, len(p), false)
+			if err != nil {
+				return fmt.Errorf("path %s: %v", op.Path, err)
+			}
+			parent = p[idx]
+		default:
+			return fmt.Errorf("path %s: cannot descend into %T", op.Path, parent)
+		}
+	}
+
+	last := tokens[len(tokens)-1]
+	switch p := parent.(type) {
+	case map[string]any:
+		_, exists := p[last]
+		switch op.Op {
+		case "add":
+			p[last] = op.Value
+		case "replace":
+			if !exists {
+				return fmt.Errorf("path %s: cannot replace missing member", op.Path)
+			}
+			p[last] = op.Value
+		case "remove":
+			if !exists {
+				return fmt.Errorf("path %s: cannot remove missing member", op.Path)
+			}
+			delete(p, last)
+		default:
+			return fmt.Errorf("unsupported op %q", op.Op)
+		}
+	case []any:
+		arr, err := patchArray(p, last, op)
+		if err != nil {
+			return fmt.Errorf("path %s: %v", op.Path, err)
+		}
+		return setChild(doc, tokens[:len(tokens)-1], arr)
+	default:
+		return fmt.Errorf("path %s: cannot modify %T", op.Path, parent)
+	}
+	return nil
+}
+
+// patchArray applies op at index token tok of arr and returns the resulting slice
+func patchArray(arr []any, tok string, op patchOp) ([]any, error) {
+	switch op.Op {
+	case "add":
+		idx, err := arrayIndex(tok, len(arr), true)
+		if err != nil {
+			return nil, err
+		}
+		out := append([]any{}, arr[:idx]...)
+		out = append(out, op.Value)
+		return append(out, arr[idx:]...), nil
+	case "replace":
+		idx, err := arrayIndex(tok, len(arr), false)
+		if err != nil {
+			return nil, err
+		}
+		arr[idx] = op.Value
+		return arr, nil
+	case "remove":
+		idx, err := arrayIndex(tok, len(arr), false)
+		if err != nil {
+			return nil, err
+		}
+		return append(append([]any{}, arr[:idx]...), arr[idx+1:]...), nil
+	default:
+		return nil, fmt.Errorf("unsupported op %q", op.Op)
+	}
+}
+
+// setChild replaces the value at the pointer tokens with v
+func setChild(doc map[string]any, tokens []string, v any) error {
+	var cur any = doc
+	for i, tok := range tokens {
+		isLast := i == len(tokens)-1
+		switch c := cur.(type) {
+		case map[string]any:
+			if isLast {
+				c[tok] = v
+				return nil
+			}
+			cur = c[tok]
+		case []any:
+			idx, err := arrayIndex(tok, len(c), false)
+			if err != nil {
+				return err
+			}
+			if isLast {
+				c[idx] = v
+				return nil
+			}
+			cur = c[idx]
+		default:
+			return fmt.Errorf("cannot descend into %T", cur)
+		}
+	}
+	return nil
+}
+
+// arrayIndex parses an array index token; "-" means the end of the array when allowEnd is set
+func arrayIndex(tok string, n int, allowEnd bool) (int, error) {
+	if tok == "-" && allowEnd {
+		return n, nil
+	}
+	idx, err := strconv.Atoi(tok)
+	if err != nil || idx < 0 {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	if idx > n || (idx == n && !allowEnd) {
+		return 0, fmt.Errorf("array index %d out of range", idx)
+	}
+	return idx, nil
+}
+
+// splitPointer splits a JSON Pointer into unescaped reference tokens
+func splitPointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", ptr)
+	}
+	parts := strings.Split(ptr[1:], "/")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(p, "~1", "/"), "~0", "~")
+	}
+	return parts, nil
+}
@@ -0,0 +1,295 @@
+package contentfultest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mimetypeGroups maps the CMA mimetype_group values the fake understands to content type prefixes
+var mimetypeGroups = map[string]string{
+	"pdfdocument": "application/pdf",
+	"image":       "image/",
+	"video":       "video/",
+	"audio":       "audio/",
+	"plaintext":   "text/plain",
+}
+
+// handleListEntries serves the entries collection
+func (s *Server) handleListEntries(w http.ResponseWriter, r *http.Request) {
+	s.handleList(w, r, s.entries)
+}
+
+// handleListAssets serves the assets collection
+func (s *Server) handleListAssets(w http.ResponseWriter, r *http.Request) {
+	s.handleList(w, r, s.assets)
+}
+
+// handleList serves a collection in ID order with skip/limit paging. It understands
+// content_type, links_to_asset, mimetype_group and search parameters on any sys, fields
+// or metadata path with the equality, [ne], [in], [nin], [exists], [match], [gt], [gte],
+// [lt] and [lte] operators. order and select are accepted and ignored, and include
+// returns the entries and assets the page's items link to, one level deep.
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request, coll map[string]*record) {
+	if !s.inScope(w, r) {
+		return
+	}
+	query := r.URL.Query()
+	skip, limit := 0, 100
+	if v := query.Get("skip"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "BadRequest", "invalid skip "+v)
+			return
+		}
+		skip = n
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 1000 {
+			writeError(w, http.StatusBadRequest, "BadRequest", "invalid limit "+v)
+			return
+		}
+		limit = n
+	}
+	if s.MaxPageItems > 0 && limit > s.MaxPageItems {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Response size too big. Maximum allowed response size: 7340032B.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matched []map[string]any
+	for _, rec := range coll {
+		doc := s.renderPlain(rec)
+		ok, err := matchesQuery(doc, query)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidQuery", err.Error())
+			return
+		}
+		if ok {
+			matched = append(matched, doc)
+		}
+	}
+	sort.Slice(matched, func(a, b int) bool {
+		return fmt.Sprint(lookupPath(matched[a], "sys.id")) < fmt.Sprint(lookupPath(matched[b], "sys.id"))
+	})
+	items := []any{}
+	for i := skip; i < len(matched) && i < skip+limit; i++ {
+		items = append(items, matched[i])
+	}
+	body := map[string]any{
+		"sys":   map[string]any{"type": "Array"},
+		"total": len(matched),
+		"skip":  skip,
+		"limit": limit,
+		"items": items,
+	}
+	if n, _ := strconv.Atoi(query.Get("include")); n > 0 {
+		body["includes"] = s.includes(items)
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// includes renders the existing entries and assets linked from items' fields, leaving out
+// the items themselves. Must be called with s.mu held.
+func (s *Server) includes(items []any) map[string]any {
+	listed := map[string]bool{}
+	entryIDs, assetIDs := map[string]bool{}, map[string]bool{}
+	for _, item := range items {
+		doc, _ := item.(map[string]any)
+		for _, id := range lookupPath(doc, "sys.id") {
+			listed[fmt.Sprint(id)] = true
+		}
+		collectLinks(doc["fields"], "Entry", entryIDs)
+		collectLinks(doc["fields"], "Asset", assetIDs)
+	}
+	return map[string]any{
+		"Entry": s.renderLinked(s.entries, entryIDs, listed),
+		"Asset": s.renderLinked(s.assets, assetIDs, listed),
+	}
+}
+
+// renderLinked renders the records of coll named in ids, in ID order, skipping listed ones
+// and links to missing records. Must be called with s.mu held.
+func (s *Server) renderLinked(coll map[string]*record, ids, listed map[string]bool) []any {
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	rendered := []any{}
+	for _, id := range sorted {
+		if rec, ok := coll[id]; ok && !listed[id] {
+			rendered = append(rendered, s.renderPlain(rec))
+		}
+	}
+	return rendered
+}
+
+// renderPlain renders rec as decoded JSON, so timestamps are strings as clients see them
+func (s *Server) renderPlain(rec *record) map[string]any {
+	b, _ := json.Marshal(s.render(rec))
+	var doc map[string]any
+	_ = json.Unmarshal(b, &doc)
+	return doc
+}
+
+// matchesQuery reports whether the rendered item doc matches every search parameter
+func matchesQuery(doc map[string]any, query url.Values) (bool, error) {
+	for key, values := range query {
+		value := values[0]
+		switch key {
+		case "skip", "limit", "order", "select", "include", "locale":
+			continue
+		case "content_type":
+			if !matchValues(lookupPath(doc, "sys.contentType.sys.id"), "", value) {
+				return false, nil
+			}
+			continue
+		case "links_to_asset":
+			if !linksToAsset(doc["fields"], value) {
+				return false, nil
+			}
+			continue
+		case "mimetype_group":
+			prefix, ok := mimetypeGroups[value]
+			if !ok {
+				return false, fmt.Errorf("unknown mimetype_group %q", value)
+			}
+			found := false
+			for _, ct := range lookupPath(doc, "fields.file.*.contentType") {
+				if s, _ := ct.(string); strings.HasPrefix(s, prefix) {
+					found = true
+				}
+			}
+			if !found {
+				return false, nil
+			}
+			continue
+		}
+
+		path, op := key, ""
+		if i := strings.Index(key, "["); i >= 0 && strings.HasSuffix(key, "]") {
+			path, op = key[:i], key[i+1:len(key)-1]
+		}
+		root := strings.SplitN(path, ".", 2)[0]
+		if root != "sys" && root != "fields" && root != "metadata" {
+			return false, fmt.Errorf("unsupported search parameter %q", key)
+		}
+		// Field paths without a locale search the default locale, as the CMA does
+		if parts := strings.Split(path, "."); root == "fields" && len(parts) == 2 {
+			path += "." + DefaultLocale
+		}
+		found := lookupPath(doc, path)
+		if op == "exists" {
+			if (len(found) > 0) != (value == "true") {
+				return false, nil
+			}
+			continue
+		}
+		switch op {
+		case "", "ne", "in", "nin", "match", "gt", "gte", "lt", "lte":
+		default:
+			return false, fmt.Errorf("unsupported operator %q in %q", op, key)
+		}
+		if !matchValues(found, op, value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matchValues applies op to the values found at a path
+func matchValues(found []any, op, value string) bool {
+	switch op {
+	case "ne":
+		return !matchValues(found, "", value)
+	case "nin":
+		return !matchValues(found, "in", value)
+	}
+	for _, f := range found {
+		got := fmt.Sprint(f)
+		switch op {
+		case "":
+			if got == value {
+				return true
+			}
+		case "in":
+			for _, v := range strings.Split(value, ",") {
+				if got == v {
+					return true
+				}
+			}
+		case "match":
+			if strings.Contains(strings.ToLower(got), strings.ToLower(value)) {
+				return true
+			}
+		case "gt", "gte", "lt", "lte":
+			cmp := compareValues(got, value)
+			if (op == "gt" && cmp > 0) || (op == "gte" && cmp >= 0) || (op == "lt" && cmp < 0) || (op == "lte" && cmp <= 0) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compareValues compares numerically when both sides are numbers and as strings otherwise,
+// which orders RFC 3339 timestamps and dates correctly
+func compareValues(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+// lookupPath returns the values at a dotted path, descending into every element of arrays
+// along the way. A "*" segment matches every key of an object.
+func lookupPath(v any, path string) []any {
+	current := []any{v}
+	for _, seg := range strings.Split(path, ".") {
+		var next []any
+		for _, c := range current {
+			for _, item := range flatten(c) {
+				m, ok := item.(map[string]any)
+				if !ok {
+					continue
+				}
+				if seg == "*" {
+					for _, child := range m {
+						next = append(next, child)
+					}
+				} else if child, ok := m[seg]; ok {
+					next = append(next, child)
+				}
+			}
+		}
+		current = next
+	}
+	var values []any
+	for _, c := range current {
+		values = append(values, flatten(c)...)
+	}
+	return values
+}
+
+// flatten returns the elements of an array, or v itself
+func flatten(v any) []any {
+	if items, ok := v.([]any); ok {
+		return items
+	}
+	return []any{v}
+}
@@ -0,0 +1,923 @@
+// Package contentfultest provides an in-process fake of the Contentful Management and
+// Upload APIs for end-to-end tests of the contentful package and main's modes.
+//
+// The fake keeps entries, assets and uploads in memory and follows the CMA versioning
+// rules: every mutation bumps sys.version, mutations must send the current version in
+// X-Contentful-Version and otherwise fail with 409 VersionMismatch, and publish,
+// unpublish, archive and processing behave like the real API closely enough for the
+// update workflow to run unchanged.
+package contentfultest
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// DefaultLocale is used for seeded content that does not specify a locale
+const DefaultLocale = "en-US"
+
+// Asset describes an asset to seed into the fake space
+type Asset struct {
+	ID          string // generated when empty
+	Locale      string // defaults to DefaultLocale
+	Title       string
+	Description string
+	FileName    string
+	ContentType string
+	Content     []byte
+	Published   bool
+	Archived    bool
+
+	// Localized holds the title, description and file of further locales
+	Localized map[string]AssetLocale
+}
+
+// AssetLocale is an asset's content in one additional locale
+type AssetLocale struct {
+	Title       string
+	Description string
+	FileName    string
+	ContentType string
+	Content     []byte
+}
+
+// Entry describes an entry to seed into the fake space
+type Entry struct {
+	ID            string // generated when empty
+	ContentTypeID string
+	Fields        map[string]any // localized fields as the CMA returns them, e.g. {"title": {"en-US": "x"}}
+	Tags          []string       // tag IDs, rendered as metadata.tags links
+	Published     bool
+}
+
+// Fault makes matching requests fail before they reach the fake's handlers, to
+// exercise retry and error handling. A 409 fault is reported as a VersionMismatch, as if
+// another editor had changed the entity.
+type Fault struct {
+	Method         string // empty matches any method
+	PathSuffix     string // matched against the end of the URL path
+	Status         int
+	Count          int  // number of requests to fail
+	RateLimitReset int  // seconds sent in X-Contentful-RateLimit-Reset
+	Applied        bool // handle the request first, as when a change is made but its response is lost
+}
+
+// Snapshot is a copy of an entry or asset's state for assertions
+type Snapshot struct {
+	ID               string
+	Version          int
+	PublishedVersion int
+	ArchivedVersion  int
+	Published        bool
+	Archived         bool
+	Fields           map[string]any
+}
+
+// Server is a fake Contentful Management API backed by an httptest TLS server.
+// Both the CMA and Upload API are served from URL.
+type Server struct {
+	URL         string
+	SpaceID     string
+	Environment string
+	Token       string // when set, requests must carry "Bearer <Token>"
+
+	// MaxPageItems, when set, makes collection pages with a larger limit fail with the
+	// CMA's 400 "Response size too big" error
+	MaxPageItems int
+
+	srv      *httptest.Server
+	mu       sync.Mutex
+	entries  map[string]*record
+	assets   map[string]*record
+	uploads  map[string][]byte
+	files    map[string][]byte
+	faults   []*Fault
+	corrupt  int // processing requests left to alter the processed file
+	requests []string
+	queries  []string // raw query of each of requests
+}
+
+// record is the stored state of an entry or asset
+type record struct {
+	id               string
+	kind             string // "Entry" or "Asset"
+	contentTypeID    string
+	version          int
+	publishedVersion int
+	publishedCounter int
+	archivedVersion  int
+	createdAt        time.Time
+	updatedAt        time.Time
+	publishedAt      time.Time
+	firstPublishedAt time.Time
+	archivedAt       time.Time
+	tags             []string
+	fields           map[string]any
+}
+
+// NewServer starts a fake CMA for the given space and environment. Callers must Close it.
+func NewServer(spaceID, environment string) *Server {
+	s := &Server{
+		SpaceID:     spaceID,
+		Environment: environment,
+		entries:     make(map[string]*record),
+		assets:      make(map[string]*record),
+		uploads:     make(map[string][]byte),
+		files:       make(map[string][]byte),
+	}
+
+	mux := http.NewServeMux()
+	env := "/spaces/{space}/environments/{env}"
+	mux.HandleFunc("GET "+env+"/entries", s.handleListEntries)
+	mux.HandleFunc("GET "+env+"/entries/{id}", s.handleGetEntry)
+	mux.HandleFunc("PUT "+env+"/entries/{id}", s.handlePutEntry)
+	mux.HandleFunc("PATCH "+env+"/entries/{id}", s.handlePatchEntry)
+	mux.HandleFunc("PUT "+env+"/entries/{id}/published", s.handlePublish)
+	mux.HandleFunc("DELETE "+env+"/entries/{id}/published", s.handleUnpublish)
+	mux.HandleFunc("GET "+env+"/assets", s.handleListAssets)
+	mux.HandleFunc("GET "+env+"/assets/{id}", s.handleGetAsset)
+	mux.HandleFunc("POST "+env+"/assets", s.handleCreateAsset)
+	mux.HandleFunc("PUT "+env+"/assets/{id}", s.handlePutAsset)
+	mux.HandleFunc("PUT "+env+"/assets/{id}/files/{locale}/process", s.handleProcessAsset)
+	mux.HandleFunc("PUT "+env+"/assets/{id}/published", s.handlePublish)
+	mux.HandleFunc("DELETE "+env+"/assets/{id}/published", s.handleUnpublish)
+	mux.HandleFunc("PUT "+env+"/assets/{id}/archived", s.handleArchive)
+	mux.HandleFunc("DELETE "+env+"/assets/{id}/archived", s.handleUnarchive)
+	mux.HandleFunc("POST /spaces/{space}/uploads", s.handleUpload)
+	mux.HandleFunc("GET /files/{path...}", s.handleFile)
+
+	s.srv = httptest.NewTLSServer(s.middleware(mux))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// HTTPClient returns an HTTP client that trusts the server's TLS certificate
+func (s *Server) HTTPClient() *http.Client {
+	return s.srv.Client()
+}
+
+// Certificate returns the server's TLS certificate, e.g. for a process started with
+// SSL_CERT_FILE pointing at it
+func (s *Server) Certificate() *x509.Certificate {
+	return s.srv.Certificate()
+}
+
+// Client returns a contentful.Client pointed at the fake for both the CMA and Upload API
+func (s *Server) Client() *contentful.Client {
+	c := contentful.NewClient(s.HTTPClient(), s.SpaceID, s.Environment, s.Token)
+	c.BaseURL = s.URL
+	c.UploadURL = s.URL
+	return c
+}
+
+// Requests returns the "METHOD path" lines of every request served so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Queries returns the query parameters of every request sent with method to a path ending
+// in pathSuffix, in the order they were received
+func (s *Server) Queries(method, pathSuffix string) []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var queries []url.Values
+	for i, req := range s.requests {
+		if strings.HasPrefix(req, method+" ") && strings.HasSuffix(req, pathSuffix) {
+			q, _ := url.ParseQuery(s.queries[i])
+			queries = append(queries, q)
+		}
+	}
+	return queries
+}
+
+// AddFault registers a fault; faults are matched in the order they were added
+func (s *Server) AddFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// CorruptProcessing makes the next n file processing requests serve other bytes than were
+// uploaded, as when processing alters or truncates a file
+func (s *Server) CorruptProcessing(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.corrupt = n
+}
+
+// LinkAsset returns the CMA link object for an asset, for use in seeded entry fields
+func LinkAsset(assetID string) map[string]any {
+	return map[string]any{"sys": map[string]any{"type": "Link", "linkType": "Asset", "id": assetID}}
+}
+
+// AddAsset seeds a processed asset and returns its ID
+func (s *Server) AddAsset(a Asset) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := a.ID
+	if id == "" {
+		id = newID()
+	}
+	locale := a.Locale
+	if locale == "" {
+		locale = DefaultLocale
+	}
+	now := time.Now().UTC()
+	rec := &record{id: id, kind: "Asset", version: 1, createdAt: now, updatedAt: now}
+	titles := map[string]any{locale: a.Title}
+	descriptions := map[string]any{locale: a.Description}
+	files := map[string]any{locale: s.storeFile(id, a.FileName, a.ContentType, a.Content)}
+	for l, la := range a.Localized {
+		titles[l] = la.Title
+		descriptions[l] = la.Description
+		files[l] = s.storeFile(id, la.FileName, la.ContentType, la.Content)
+	}
+	rec.fields = map[string]any{
+		"title":       titles,
+		"description": descriptions,
+		"file":        files,
+	}
+	rec.version++ // processing
+	if a.Published || a.Archived {
+		rec.publish(now)
+		if a.Archived {
+			rec.unpublish(now)
+		}
+	}
+	if a.Archived {
+		rec.archive(now)
+	}
+	s.assets[id] = rec
+	return id
+}
+
+// AddEntry seeds an entry and returns its ID
+func (s *Server) AddEntry(e Entry) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := e.ID
+	if id == "" {
+		id = newID()
+	}
+	now := time.Now().UTC()
+	rec := &record{id: id, kind: "Entry", contentTypeID: e.ContentTypeID, version: 1, createdAt: now, updatedAt: now}
+	rec.fields = cloneFields(e.Fields)
+	rec.tags = append([]string(nil), e.Tags...)
+	if e.Published {
+		rec.publish(now)
+	}
+	s.entries[id] = rec
+	return id
+}
+
+// Entry returns a snapshot of the entry with the given ID
+func (s *Server) Entry(id string) (Snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.entries[id]
+	if !ok {
+		return Snapshot{}, false
+	}
+	return rec.snapshot(), true
+}
+
+// Asset returns a snapshot of the asset with the given ID
+func (s *Server) Asset(id string) (Snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.assets[id]
+	if !ok {
+		return Snapshot{}, false
+	}
+	return rec.snapshot(), true
+}
+
+// Upload returns the bytes received for the upload with the given ID
+func (s *Server) Upload(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.uploads[id]
+	return append([]byte(nil), content...), ok
+}
+
+// AssetIDs returns the IDs of all assets in the space, sorted
+func (s *Server) AssetIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.assets))
+	for id := range s.assets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		s.queries = append(s.queries, r.URL.RawQuery)
+		fault := s.takeFault(r)
+		s.mu.Unlock()
+
+		w.Header().Set("X-Contentful-Request-Id", newID())
+		if fault != nil {
+			id := "ServerError"
+			switch fault.Status {
+			case http.StatusTooManyRequests:
+				id = "RateLimitExceeded"
+				w.Header().Set("X-Contentful-RateLimit-Reset", strconv.Itoa(fault.RateLimitReset))
+			case http.StatusConflict:
+				id = "VersionMismatch"
+			}
+			if fault.Applied {
+				next.ServeHTTP(httptest.NewRecorder(), r)
+			}
+			writeError(w, fault.Status, id, "injected fault")
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/files/") {
+			if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+				writeError(w, http.StatusUnauthorized, "AccessTokenInvalid", "The access token you sent could not be found or is invalid.")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleGetEntry(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.lookup(w, r, s.entries)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.render(rec))
+}
+
+func (s *Server) handleGetAsset(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.lookup(w, r, s.assets)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.render(rec))
+}
+
+func (s *Server) handlePutEntry(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Fields map[string]any `json:"fields"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.lookup(w, r, s.entries)
+	if !ok || !checkVersion(w, r, rec) {
+		return
+	}
+	rec.fields = cloneFields(body.Fields)
+	rec.touch()
+	writeJSON(w, http.StatusOK, s.render(rec))
+}
+
+func (s *Server) handlePatchEntry(w http.ResponseWriter, r *http.Request) {
+	var ops []patchOp
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.lookup(w, r, s.entries)
+	if !ok || !checkVersion(w, r, rec) {
+		return
+	}
+	doc := map[string]any{"fields": cloneFields(rec.fields)}
+	for _, op := range ops {
+		if err := applyPatch(doc, op); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, "UnprocessableEntity", err.Error())
+			return
+		}
+	}
+	fields, _ := doc["fields"].(map[string]any)
+	rec.fields = fields
+	rec.touch()
+	writeJSON(w, http.StatusOK, s.render(rec))
+}
+
+func (s *Server) handleCreateAsset(w http.ResponseWriter, r *http.Request) {
+	if !s.inScope(w, r) {
+		return
+	}
+	var body struct {
+		Fields map[string]any `json:"fields"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, _ := body.Fields["file"].(map[string]any)
+	for locale, f := range files {
+		fMap, _ := f.(map[string]any)
+		if uploadID := uploadFromID(fMap); uploadID != "" {
+			if _, ok := s.uploads[uploadID]; !ok {
+				writeError(w, http.StatusUnprocessableEntity, "ValidationFailed", fmt.Sprintf("upload %s for locale %s not found", uploadID, locale))
+				return
+			}
+		}
+	}
+	now := time.Now().UTC()
+	rec := &record{id: newID(), kind: "Asset", version: 1, createdAt: now, updatedAt: now, fields: cloneFields(body.Fields)}
+	s.assets[rec.id] = rec
+	writeJSON(w, http.StatusCreated, s.render(rec))
+}
+
+func (s *Server) handlePutAsset(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Fields map[string]any `json:"fields"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.lookup(w, r, s.assets)
+	if !ok || !checkVersion(w, r, rec) {
+		return
+	}
+	if rec.archivedVersion != 0 {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Cannot update archived asset")
+		return
+	}
+	files, _ := body.Fields["file"].(map[string]any)
+	for locale, f := range files {
+		fMap, _ := f.(map[string]any)
+		if uploadID := uploadFromID(fMap); uploadID != "" {
+			if _, ok := s.uploads[uploadID]; !ok {
+				writeError(w, http.StatusUnprocessableEntity, "ValidationFailed", fmt.Sprintf("upload %s for locale %s not found", uploadID, locale))
+				return
+			}
+		}
+	}
+	rec.fields = cloneFields(body.Fields)
+	rec.touch()
+	writeJSON(w, http.StatusOK, s.render(rec))
+}
+
+func (s *Server) handleProcessAsset(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.lookup(w, r, s.assets)
+	if !ok {
+		return
+	}
+	locale := r.PathValue("locale")
+	files, _ := rec.fields["file"].(map[string]any)
+	fMap, _ := files[locale].(map[string]any)
+	uploadID := uploadFromID(fMap)
+	content, ok := s.uploads[uploadID]
+	if !ok {
+		writeError(w, http.StatusUnprocessableEntity, "ValidationFailed", fmt.Sprintf("asset %s has no upload to process for locale %s", rec.id, locale))
+		return
+	}
+	if s.corrupt > 0 {
+		s.corrupt--
+		content = append(append([]byte(nil), content...), "\ncorrupted"...)
+	}
+	fileName, _ := fMap["fileName"].(string)
+	contentType, _ := fMap["contentType"].(string)
+	files[locale] = s.storeFile(rec.id, fileName, contentType, content)
+	rec.touch()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.lookupEntity(w, r)
+	if !ok || !checkVersion(w, r, rec) {
+		return
+	}
+	if rec.archivedVersion != 0 {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Cannot publish archived "+strings.ToLower(rec.kind))
+		return
+	}
+	if rec.kind == "Asset" {
+		files, _ := rec.fields["file"].(map[string]any)
+		for locale, f := range files {
+			if fMap, _ := f.(map[string]any); fMap["url"] == nil {
+				writeError(w, http.StatusUnprocessableEntity, "ValidationFailed", "file for locale "+locale+" has not been processed")
+				return
+			}
+		}
+	}
+	rec.publish(time.Now().UTC())
+	writeJSON(w, http.StatusOK, s.render(rec))
+}
+
+func (s *Server) handleUnpublish(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.lookupEntity(w, r)
+	if !ok || !checkVersion(w, r, rec) {
+		return
+	}
+	if rec.publishedVersion == 0 {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Not published")
+		return
+	}
+	rec.unpublish(time.Now().UTC())
+	writeJSON(w, http.StatusOK, s.render(rec))
+}
+
+func (s *Server) handleArchive(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.lookup(w, r, s.assets)
+	if !ok || !checkVersion(w, r, rec) {
+		return
+	}
+	if rec.publishedVersion != 0 {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Cannot archive published asset")
+		return
+	}
+	if rec.archivedVersion != 0 {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Already archived")
+		return
+	}
+	rec.archive(time.Now().UTC())
+	writeJSON(w, http.StatusOK, s.render(rec))
+}
+
+func (s *Server) handleUnarchive(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.lookup(w, r, s.assets)
+	if !ok || !checkVersion(w, r, rec) {
+		return
+	}
+	if rec.archivedVersion == 0 {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Not archived")
+		return
+	}
+	rec.archivedVersion = 0
+	rec.archivedAt = time.Time{}
+	rec.touch()
+	writeJSON(w, http.StatusOK, s.render(rec))
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if !s.inScope(w, r) {
+		return
+	}
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	s.mu.Lock()
+	id := newID()
+	s.uploads[id] = content
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]any{"sys": map[string]any{"id": id, "type": "Upload"}})
+}
+
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	content, ok := s.files[r.PathValue("path")]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	_, _ = w.Write(content)
+}
+
+// takeFault consumes one use of the first fault matching r. Must be called with s.mu held.
+func (s *Server) takeFault(r *http.Request) *Fault {
+	for _, f := range s.faults {
+		if f.Count <= 0 || (f.Method != "" && f.Method != r.Method) || !strings.HasSuffix(r.URL.Path, f.PathSuffix) {
+			continue
+		}
+		f.Count--
+		return f
+	}
+	return nil
+}
+
+// storeFile makes content downloadable and returns the processed file field value.
+// Must be called with s.mu held.
+func (s *Server) storeFile(assetID, fileName, contentType string, content []byte) map[string]any {
+	key := assetID + "/" + newID() + "/" + fileName
+	s.files[key] = append([]byte(nil), content...)
+	return map[string]any{
+		"url":         "//" + strings.TrimPrefix(s.URL, "https://") + "/files/" + key,
+		"details":     map[string]any{"size": len(content)},
+		"fileName":    fileName,
+		"contentType": contentType,
+	}
+}
+
+// lookup finds the record named by the {id} path value, writing a 404 when missing
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request, coll map[string]*record) (*record, bool) {
+	if !s.inScope(w, r) {
+		return nil, false
+	}
+	rec, ok := coll[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NotFound", "The resource could not be found.")
+		return nil, false
+	}
+	return rec, true
+}
+
+// inScope checks the {space} and {env} path values, writing a 404 for other spaces
+func (s *Server) inScope(w http.ResponseWriter, r *http.Request) bool {
+	if r.PathValue("space") != s.SpaceID {
+		writeError(w, http.StatusNotFound, "NotFound", "The resource could not be found.")
+		return false
+	}
+	if env := r.PathValue("env"); env != "" && env != s.Environment {
+		writeError(w, http.StatusNotFound, "NotFound", "The resource could not be found.")
+		return false
+	}
+	return true
+}
+
+// lookupEntity resolves /entries/{id} or /assets/{id} paths shared by publish handlers
+func (s *Server) lookupEntity(w http.ResponseWriter, r *http.Request) (*record, bool) {
+	if strings.Contains(r.URL.Path, "/entries/") {
+		return s.lookup(w, r, s.entries)
+	}
+	return s.lookup(w, r, s.assets)
+}
+
+// checkVersion enforces optimistic locking via X-Contentful-Version
+func checkVersion(w http.ResponseWriter, r *http.Request, rec *record) bool {
+	v, err := strconv.Atoi(strings.TrimSpace(r.Header.Get("X-Contentful-Version")))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", "X-Contentful-Version header is required")
+		return false
+	}
+	if v != rec.version {
+		writeError(w, http.StatusConflict, "VersionMismatch", fmt.Sprintf("version %d does not match current version %d", v, rec.version))
+		return false
+	}
+	return true
+}
+
+func (rec *record) touch() {
+	rec.version++
+	rec.updatedAt = time.Now().UTC()
+}
+
+func (rec *record) publish(now time.Time) {
+	rec.publishedVersion = rec.version
+	rec.publishedCounter++
+	rec.publishedAt = now
+	if rec.firstPublishedAt.IsZero() {
+		rec.firstPublishedAt = now
+	}
+	rec.version++
+}
+
+func (rec *record) unpublish(now time.Time) {
+	rec.publishedVersion = 0
+	rec.publishedAt = time.Time{}
+	rec.version++
+	rec.updatedAt = now
+}
+
+func (rec *record) archive(now time.Time) {
+	rec.archivedVersion = rec.version
+	rec.archivedAt = now
+	rec.version++
+}
+
+func (rec *record) snapshot() Snapshot {
+	return Snapshot{
+		ID:               rec.id,
+		Version:          rec.version,
+		PublishedVersion: rec.publishedVersion,
+		ArchivedVersion:  rec.archivedVersion,
+		Published:        rec.publishedVersion != 0,
+		Archived:         rec.archivedVersion != 0,
+		Fields:           cloneFields(rec.fields),
+	}
+}
+
+// status mirrors the CMA entity status shown in sys.fieldStatus
+func (rec *record) status() string {
+	switch {
+	case rec.archivedVersion != 0:
+		return "archived"
+	case rec.publishedVersion == 0:
+		return "draft"
+	case rec.version == rec.publishedVersion+1:
+		return "published"
+	default:
+		return "changed"
+	}
+}
+
+// render produces the CMA JSON representation of a record, limited to the sys
+// properties the contentful package decodes
+func (s *Server) render(rec *record) map[string]any {
+	userLink := link("User", "fake-user")
+	sys := map[string]any{
+		"space":            link("Space", s.SpaceID),
+		"id":               rec.id,
+		"type":             rec.kind,
+		"createdAt":        rec.createdAt,
+		"updatedAt":        rec.updatedAt,
+		"environment":      link("Environment", s.Environment),
+		"createdBy":        userLink,
+		"updatedBy":        userLink,
+		"publishedCounter": rec.publishedCounter,
+		"version":          rec.version,
+		"urn":              fmt.Sprintf("crn:contentful:::content:spaces/%s/environments/%s/%ss/%s", s.SpaceID, s.Environment, strings.ToLower(rec.kind), rec.id),
+	}
+	if rec.publishedVersion != 0 {
+		sys["publishedVersion"] = rec.publishedVersion
+		sys["publishedAt"] = rec.publishedAt
+		sys["publishedBy"] = userLink
+	}
+	if !rec.firstPublishedAt.IsZero() {
+		sys["firstPublishedAt"] = rec.firstPublishedAt
+	}
+
+	fieldStatus := map[string]map[string]string{"*": {}}
+	for _, locale := range rec.locales() {
+		fieldStatus["*"][locale] = rec.status()
+	}
+	sys["fieldStatus"] = fieldStatus
+
+	switch rec.kind {
+	case "Entry":
+		sys["automationTags"] = []any{}
+		sys["contentType"] = link("ContentType", rec.contentTypeID)
+	case "Asset":
+		if rec.archivedVersion != 0 {
+			sys["archivedAt"] = rec.archivedAt
+			sys["archivedBy"] = userLink
+			sys["archivedVersion"] = rec.archivedVersion
+		}
+	}
+
+	tags := []any{}
+	for _, tag := range rec.tags {
+		tags = append(tags, link("Tag", tag))
+	}
+	return map[string]any{
+		"metadata": map[string]any{"tags": tags, "concepts": []any{}},
+		"sys":      sys,
+		"fields":   rec.fields,
+	}
+}
+
+// locales returns every locale present in the record's fields, defaulting to DefaultLocale
+func (rec *record) locales() []string {
+	seen := map[string]bool{}
+	for _, v := range rec.fields {
+		if m, ok := v.(map[string]any); ok {
+			for locale := range m {
+				seen[locale] = true
+			}
+		}
+	}
+	if len(seen) == 0 {
+		return []string{DefaultLocale}
+	}
+	locales := make([]string, 0, len(seen))
+	for locale := range seen {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+func link(linkType, id string) map[string]any {
+	return map[string]any{"sys": map[string]any{"type": "Link", "linkType": linkType, "id": id}}
+}
+
+// linksToAsset reports whether v holds a link to the asset at any depth
+func linksToAsset(v any, assetID string) bool {
+	switch t := v.(type) {
+	case map[string]any:
+		if sys, ok := t["sys"].(map[string]any); ok && sys["type"] == "Link" && sys["linkType"] == "Asset" && sys["id"] == assetID {
+			return true
+		}
+		for _, child := range t {
+			if linksToAsset(child, assetID) {
+				return true
+			}
+		}
+	case []any:
+		for _, child := range t {
+			if linksToAsset(child, assetID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collectLinks adds the IDs of every linkType link below v to ids
+func collectLinks(v any, linkType string, ids map[string]bool) {
+	switch t := v.(type) {
+	case map[string]any:
+		if sys, ok := t["sys"].(map[string]any); ok && sys["type"] == "Link" && sys["linkType"] == linkType {
+			if id, _ := sys["id"].(string); id != "" {
+				ids[id] = true
+			}
+		}
+		for _, child := range t {
+			collectLinks(child, linkType, ids)
+		}
+	case []any:
+		for _, child := range t {
+			collectLinks(child, linkType, ids)
+		}
+	}
+}
+
+// uploadFromID returns the upload ID referenced by a file field's uploadFrom link
+func uploadFromID(file map[string]any) string {
+	from, _ := file["uploadFrom"].(map[string]any)
+	sys, _ := from["sys"].(map[string]any)
+	id, _ := sys["id"].(string)
+	return id
+}
+
+// cloneFields deep-copies a fields map through a JSON round trip
+func cloneFields(fields map[string]any) map[string]any {
+	out := map[string]any{}
+	if fields == nil {
+		return out
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		panic(fmt.Sprintf("contentfultest: fields are not JSON serializable: %v", err))
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		panic(fmt.Sprintf("contentfultest: clone fields: %v", err))
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/vnd.contentful.management.v1+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a CMA style error body
+func writeError(w http.ResponseWriter, status int, id, message string) {
+	writeJSON(w, status, map[string]any{
+		"sys":       map[string]any{"type": "Error", "id": id},
+		"message":   message,
+		"requestId": w.Header().Get("X-Contentful-Request-Id"),
+	})
+}
+
+func newID() string {
+	b := make([]byte, 11)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
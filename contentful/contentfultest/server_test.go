@@ -0,0 +1,66 @@
+package contentfultest_test
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"contentful-asset-replacer/contentful"
+	"contentful-asset-replacer/contentful/contentfultest"
+)
+
+func TestServer(t *testing.T) {
+	srv := contentfultest.NewServer("space", "master")
+	defer srv.Close()
+	assetID := srv.AddAsset(contentfultest.Asset{Title: "Report", FileName: "report.pdf", ContentType: "application/pdf", Content: []byte("%PDF-1.4\n"), Published: true})
+	entryID := srv.AddEntry(contentfultest.Entry{
+		ContentTypeID: "document",
+		Fields:        map[string]any{"downloadableFile": map[string]any{"en-US": contentfultest.LinkAsset(assetID)}},
+		Published:     true,
+	})
+	client := srv.Client()
+	ctx := context.Background()
+
+	entry, _, err := client.FetchEntry(ctx, contentful.FetchEntryRequest{EntryID: entryID})
+	if err != nil {
+		t.Fatalf("fetch entry: %v", err)
+	}
+	if entry.ContentTypeID != "document" || entry.AssetID != assetID {
+		t.Errorf("entry has content type %q and links %q, want document linking %s", entry.ContentTypeID, entry.AssetID, assetID)
+	}
+	asset, _, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: assetID})
+	if err != nil {
+		t.Fatalf("fetch asset: %v", err)
+	}
+	if asset.FileName != "report.pdf" || asset.ContentType != "application/pdf" {
+		t.Errorf("asset file %q (%s), want report.pdf (application/pdf)", asset.FileName, asset.ContentType)
+	}
+
+	// Writes sending a stale version are refused
+	if status, err := client.PublishEntry(ctx, contentful.PublishEntryRequest{EntryID: entryID, Version: entry.Version - 1}); err == nil || status != http.StatusConflict {
+		t.Errorf("publish at a stale version = status %d, %v; want a 409", status, err)
+	}
+	if _, err := client.PublishEntry(ctx, contentful.PublishEntryRequest{EntryID: entryID, Version: entry.Version}); err != nil {
+		t.Fatalf("publish entry: %v", err)
+	}
+	if e, _ := srv.Entry(entryID); !e.Published || e.PublishedVersion != entry.Version || e.Version != entry.Version+1 {
+		t.Errorf("entry at version %d, published version %d; want version %d published", e.Version, e.PublishedVersion, entry.Version)
+	}
+
+	version, _, err := client.UnpublishAsset(ctx, contentful.UnpublishAssetRequest{AssetID: assetID, Version: asset.Version})
+	if err != nil {
+		t.Fatalf("unpublish asset: %v", err)
+	}
+	if _, err := client.ArchiveAsset(ctx, contentful.ArchiveAssetRequest{AssetID: assetID, Version: version}); err != nil {
+		t.Fatalf("archive asset: %v", err)
+	}
+	if a, _ := srv.Asset(assetID); a.Published || !a.Archived {
+		t.Errorf("asset published %v, archived %v; want it unpublished and archived", a.Published, a.Archived)
+	}
+
+	want := "PUT /spaces/space/environments/master/entries/" + entryID + "/published"
+	if !slices.Contains(srv.Requests(), want) {
+		t.Errorf("requests %v lack %q", srv.Requests(), want)
+	}
+}
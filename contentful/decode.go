@@ -0,0 +1,145 @@
+package contentful
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// decodeEntry decodes an entry body, keeping properties EntryResponse does not model in its
+// Unknown map
+func (c *Client) decodeEntry(data []byte) (EntryResponse, error) {
+	var er EntryResponse
+	unknown, err := c.decodeResponse("entry", data, &er)
+	er.Unknown = unknown
+	return er, err
+}
+
+// decodeAsset decodes an asset body, keeping properties AssetResponse does not model in its
+// Unknown map
+func (c *Client) decodeAsset(data []byte) (AssetResponse, error) {
+	var ar AssetResponse
+	unknown, err := c.decodeResponse("asset", data, &ar)
+	ar.Unknown = unknown
+	return ar, err
+}
+
+// decodeResponse decodes data into v and returns the properties v's type does not model,
+// keyed by their dotted path, e.g. "sys.automationTags". New properties are reported to
+// OnSchemaDrift, or with StrictSchema fail the decode.
+func (c *Client) decodeResponse(kind string, data []byte, v any) (map[string]json.RawMessage, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	unknown := make(map[string]json.RawMessage)
+	patterns := make(map[string]bool)
+	unknownFields(data, reflect.TypeOf(v), "", "", unknown, patterns)
+	if len(unknown) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(patterns))
+	for pattern := range patterns {
+		keys = append(keys, pattern)
+	}
+	sort.Strings(keys)
+	if c.StrictSchema {
+		return unknown, fmt.Errorf("%s response has unknown fields: %s", kind, strings.Join(keys, ", "))
+	}
+	c.noteSchemaDrift(kind, keys)
+	return unknown, nil
+}
+
+// noteSchemaDrift hands the keys not reported before to OnSchemaDrift
+func (c *Client) noteSchemaDrift(kind string, keys []string) {
+	if c.OnSchemaDrift == nil {
+		return
+	}
+	c.driftMu.Lock()
+	defer c.driftMu.Unlock()
+	if c.driftSeen == nil {
+		c.driftSeen = make(map[string]bool)
+	}
+	var fresh []string
+	for _, key := range keys {
+		if !c.driftSeen[kind+" "+key] {
+			c.driftSeen[kind+" "+key] = true
+			fresh = append(fresh, key)
+		}
+	}
+	if len(fresh) > 0 {
+		c.OnSchemaDrift(kind, fresh)
+	}
+}
+
+// unknownFields walks the JSON value data alongside the Go type t, recording every object
+// property t has no field for under its path in unknown, and under its path with map keys
+// and array positions replaced by "*" in patterns. Values decoded into interfaces hold
+// anything and are not walked.
+func unknownFields(data json.RawMessage, t reflect.Type, path, pattern string, unknown map[string]json.RawMessage, patterns map[string]bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return
+		}
+		for key, value := range obj {
+			field, ok := jsonField(t, key)
+			if !ok {
+				unknown[path+key] = value
+				patterns[pattern+key] = true
+				continue
+			}
+			unknownFields(value, field.Type, path+key+".", pattern+key+".", unknown, patterns)
+		}
+	case reflect.Map:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return
+		}
+		for key, value := range obj {
+			unknownFields(value, t.Elem(), path+key+".", pattern+"*.", unknown, patterns)
+		}
+	case reflect.Slice, reflect.Array:
+		var arr []json.RawMessage
+		if json.Unmarshal(data, &arr) != nil {
+			return
+		}
+		for i, value := range arr {
+			unknownFields(value, t.Elem(), path+strconv.Itoa(i)+".", pattern+"*.", unknown, patterns)
+		}
+	}
+}
+
+// jsonField returns the field of struct type t that encoding/json decodes the property key
+// into, preferring an exact match of the name over a case-insensitive one
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	var folded reflect.StructField
+	found := false
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if name == key {
+			return field, true
+		}
+		if !found && strings.EqualFold(name, key) {
+			folded, found = field, true
+		}
+	}
+	return folded, found
+}
@@ -0,0 +1,151 @@
+package contentful
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const assetBody = `{
+	"sys": {"id": "a1", "type": "Asset", "version": 3, "releaseStatus": "draft"},
+	"fields": {
+		"title": {"en-US": "Report"},
+		"file": {
+			"en-US": {"url": "//assets/report.pdf", "fileName": "report.pdf", "contentType": "application/pdf", "details": {"size": 9, "image": {"width": 1}}},
+			"de-DE": {"url": "//assets/bericht.pdf", "fileName": "bericht.pdf", "contentType": "application/pdf", "details": {"size": 9, "image": {"width": 2}}}
+		}
+	},
+	"workflow": {"step": "review"}
+}`
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		kind        string
+		body        string
+		wantUnknown []string // dotted paths kept in Unknown
+		wantDrift   []string // patterns reported to OnSchemaDrift
+	}{
+		{
+			name: "modelled entry",
+			kind: "entry",
+			body: `{"sys": {"id": "e1", "version": 2, "automationTags": [], "contentType": {"sys": {"id": "document"}}}, "fields": {"anything": {"en-US": {"goes": true}}}}`,
+		},
+		{
+			name: "property names match case-insensitively",
+			kind: "entry",
+			body: `{"SYS": {"Version": 2}}`,
+		},
+		{
+			name:        "new sys property of an entry",
+			kind:        "entry",
+			body:        `{"sys": {"id": "e1", "version": 2, "releaseStatus": "draft"}, "fields": {}}`,
+			wantUnknown: []string{"sys.releaseStatus"},
+			wantDrift:   []string{"sys.releaseStatus"},
+		},
+		{
+			name:        "new properties of an asset, per locale",
+			kind:        "asset",
+			body:        assetBody,
+			wantUnknown: []string{"fields.file.de-DE.details.image", "fields.file.en-US.details.image", "sys.releaseStatus", "workflow"},
+			wantDrift:   []string{"fields.file.*.details.image", "sys.releaseStatus", "workflow"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var drift []string
+			c := &Client{OnSchemaDrift: func(kind string, keys []string) {
+				if kind != tt.kind {
+					t.Errorf("drift reported for %s, want %s", kind, tt.kind)
+				}
+				drift = append(drift, keys...)
+			}}
+
+			var unknown []string
+			var err error
+			if tt.kind == "entry" {
+				var er EntryResponse
+				er, err = c.decodeEntry([]byte(tt.body))
+				for key := range er.Unknown {
+					unknown = append(unknown, key)
+				}
+			} else {
+				var ar AssetResponse
+				ar, err = c.decodeAsset([]byte(tt.body))
+				for key := range ar.Unknown {
+					unknown = append(unknown, key)
+				}
+			}
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			sort.Strings(unknown)
+			if !reflect.DeepEqual(unknown, tt.wantUnknown) {
+				t.Errorf("Unknown keys = %v, want %v", unknown, tt.wantUnknown)
+			}
+			if !reflect.DeepEqual(drift, tt.wantDrift) {
+				t.Errorf("drift = %v, want %v", drift, tt.wantDrift)
+			}
+		})
+	}
+}
+
+func TestSchemaDriftReportedOnce(t *testing.T) {
+	var reports [][]string
+	c := &Client{OnSchemaDrift: func(kind string, keys []string) {
+		reports = append(reports, append([]string{kind}, keys...))
+	}}
+
+	bodies := []struct{ kind, body string }{
+		{"entry", `{"sys": {"id": "e1", "releaseStatus": "draft"}}`},
+		{"entry", `{"sys": {"id": "e2", "releaseStatus": "draft"}}`},
+		{"entry", `{"sys": {"id": "e3", "releaseStatus": "draft", "variant": "b"}}`},
+		{"asset", `{"sys": {"id": "a1", "releaseStatus": "draft"}}`},
+	}
+	for _, b := range bodies {
+		var err error
+		if b.kind == "entry" {
+			_, err = c.decodeEntry([]byte(b.body))
+		} else {
+			_, err = c.decodeAsset([]byte(b.body))
+		}
+		if err != nil {
+			t.Fatalf("decode %s: %v", b.body, err)
+		}
+	}
+
+	want := [][]string{
+		{"entry", "sys.releaseStatus"},
+		{"entry", "sys.variant"},
+		{"asset", "sys.releaseStatus"},
+	}
+	if !reflect.DeepEqual(reports, want) {
+		t.Errorf("reports = %v, want %v", reports, want)
+	}
+}
+
+func TestStrictSchema(t *testing.T) {
+	c := &Client{StrictSchema: true, OnSchemaDrift: func(kind string, keys []string) {
+		t.Errorf("drift reported with StrictSchema: %s %v", kind, keys)
+	}}
+
+	ar, err := c.decodeAsset([]byte(assetBody))
+	if err == nil {
+		t.Fatal("decode succeeded, want an error naming the unknown fields")
+	}
+	if want := "asset response has unknown fields: fields.file.*.details.image, sys.releaseStatus, workflow"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+	if len(ar.Unknown) != 4 {
+		t.Errorf("Unknown holds %d keys, want 4", len(ar.Unknown))
+	}
+
+	if _, err := c.decodeEntry([]byte(`{"sys": {"id": "e1", "version": 2}, "fields": {"title": {"en-US": "x"}}}`)); err != nil {
+		t.Errorf("modelled entry: %v", err)
+	}
+	if _, err := c.decodeEntry([]byte(`{"sys": `)); err == nil || strings.Contains(err.Error(), "unknown fields") {
+		t.Errorf("malformed entry = %v, want a syntax error", err)
+	}
+}
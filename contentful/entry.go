@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 	"time"
 )
@@ -73,86 +75,114 @@ type EntryResponse struct {
 		Urn string `json:"urn"`
 	} `json:"sys"`
 	Fields map[string]any `json:"fields"`
+
+	// Unknown holds the properties this model does not know, keyed by dotted path
+	Unknown map[string]json.RawMessage `json:"-"`
 }
 
+// DefaultAssetField is the asset link field read when a request does not name one
+const DefaultAssetField = "downloadableFile"
+
 // Entry is a minimal DTO for callers
 type Entry struct {
-	ID            string
-	Version       int
-	ContentTypeID string
-	AssetID       string
-	FieldStatus   map[string]map[string]string
+	ID               string
+	Version          int
+	PublishedVersion int // zero when the entry is not published
+	ContentTypeID    string
+	AssetID          string      // asset of the first link in AssetLinks, empty when there is none
+	AssetLinks       []AssetLink // asset links in the requested fields and locales, in field, locale and array order
+	FieldStatus      map[string]map[string]string
+	Fields           map[string]any // the raw localized fields
+}
+
+// AssetLink is a single asset link held by an entry field in one locale. Links inside an
+// array-of-links field also carry their position in the array, and links embedded in a
+// Rich Text document carry the JSON Pointer of their node below the field value.
+type AssetLink struct {
+	FieldKey string
+	Locale   string
+	InArray  bool
+	Index    int
+	NodePath string // e.g. "/content/3" for an embedded-asset-block; empty outside Rich Text
+	AssetID  string
+}
+
+// path returns the JSON Pointer of the link within the entry
+func (l AssetLink) path() string {
+	locale := l.Locale
+	if locale == "" {
+		locale = DefaultLocale
+	}
+	p := fmt.Sprintf("/fields/%s/%s", l.FieldKey, locale)
+	if l.InArray {
+		p += fmt.Sprintf("/%d", l.Index)
+	}
+	if l.NodePath != "" {
+		p += l.NodePath + "/data/target"
+	}
+	return p
 }
 
 // FetchEntryRequest contains all the parameters needed to fetch an entry
 type FetchEntryRequest struct {
-	SpaceID     string
-	Environment string
-	EntryID     string
-	HeaderName  string
-	Scheme      string
-	Token       string
+	EntryID   string
+	FieldKeys []string // asset link fields to read, defaults to DefaultAssetField
+	Locales   []string // locales to read, defaults to DefaultLocale
+	AllFields bool     // read the links of every field and locale, ignoring FieldKeys and Locales
+}
+
+// FetchEntriesLinkingAssetRequest contains all the parameters needed to find the entries linking an asset
+type FetchEntriesLinkingAssetRequest struct {
+	AssetID string
 }
 
 // UpdateEntryAssetLinkRequest contains all the parameters needed to update an entry's asset link
 type UpdateEntryAssetLinkRequest struct {
-	SpaceID     string
-	Environment string
-	EntryID     string
-	FieldKey    string
-	Locale      string
-	NewAssetID  string
-	Version     int
-	HeaderName  string
-	Scheme      string
-	Token       string
+	EntryID    string
+	FieldKey   string
+	Locale     string
+	NewAssetID string
+	Version    int
 }
 
 // PublishEntryRequest contains all the parameters needed to publish an entry
 type PublishEntryRequest struct {
-	SpaceID     string
-	Environment string
-	EntryID     string
-	Version     int
-	HeaderName  string
-	Scheme      string
-	Token       string
+	EntryID string
+	Version int
 }
 
-// PatchEntryAssetLinkRequest contains all the parameters needed to patch an entry's asset link
+// PatchEntryAssetLinkRequest contains all the parameters needed to patch an entry's asset links
 type PatchEntryAssetLinkRequest struct {
-	SpaceID     string
-	Environment string
-	EntryID     string
-	FieldKey    string
-	Locale      string
-	NewAssetID  string
-	Version     int
-	HeaderName  string
-	Scheme      string
-	Token       string
+	EntryID    string
+	Links      []AssetLink // field and locale of every link to point at NewAssetID
+	NewAssetID string
+	Version    int
 }
 
 // FetchEntry retrieves a single Entry by ID using CMA
-func FetchEntry(ctx context.Context, client *http.Client, req FetchEntryRequest) (Entry, int, error) {
+func (c *Client) FetchEntry(ctx context.Context, req FetchEntryRequest) (Entry, int, error) {
 	// Extract values from the request struct
-	spaceID := req.SpaceID
-	environment := req.Environment
 	entryID := req.EntryID
-	headerName := req.HeaderName
-	scheme := req.Scheme
-	token := req.Token
+	fieldKeys := req.FieldKeys
+	locales := req.Locales
+
+	if len(fieldKeys) == 0 {
+		fieldKeys = []string{DefaultAssetField}
+	}
+	if len(locales) == 0 {
+		locales = []string{DefaultLocale}
+	}
 
-	url := fmt.Sprintf("https://api.contentful.com/spaces/%s/environments/%s/entries/%s", spaceID, environment, entryID)
+	url := c.envURL("/entries/%s", entryID)
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	httpReq, err := newRequest(ctx, "fetch entry", http.MethodGet, url, nil)
 	if err != nil {
 		return Entry{}, 0, err
 	}
 	httpReq.Header.Set("Accept", "application/json")
-	httpReq.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
+	c.authorize(httpReq)
 
-	resp, err := client.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return Entry{}, 0, err
 	}
@@ -160,65 +190,170 @@ func FetchEntry(ctx context.Context, client *http.Client, req FetchEntryRequest)
 
 	status := resp.StatusCode
 	if status < 200 || status >= 300 {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return Entry{}, status, fmt.Errorf("unexpected status %d: %s", status, strings.TrimSpace(string(body)))
+		return Entry{}, status, newAPIError("", resp)
 	}
 
-	var er EntryResponse
-	dec := json.NewDecoder(resp.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&er); err != nil {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Entry{}, status, err
+	}
+	er, err := c.decodeEntry(body)
+	if err != nil {
 		return Entry{}, status, err
 	}
+	if req.AllFields {
+		fieldKeys, locales = sortedKeys(er.Fields), entryLocales(er.Fields)
+	}
+
+	return newEntry(er, collectAssetLinks(er.Fields, fieldKeys, locales)), status, nil
+}
 
-	ctID := ""
-	if er.Sys.ContentType.Sys.ID != "" {
-		ctID = er.Sys.ContentType.Sys.ID
+// FetchEntriesLinkingAsset retrieves every entry that links to the asset, paging through
+// the links_to_asset query. Each entry's AssetLinks hold its links to the asset in all of
+// its fields and locales.
+func (c *Client) FetchEntriesLinkingAsset(ctx context.Context, req FetchEntriesLinkingAssetRequest) ([]Entry, int, error) {
+	// Extract values from the request struct
+	assetID := req.AssetID
+
+	query := url.Values{}
+	query.Set("links_to_asset", assetID)
+
+	var entries []Entry
+	status, err := c.pageCollection(ctx, "/entries", query, entryPageSize, func(page collectionPage) error {
+		for _, item := range page.Items {
+			er, err := c.decodeEntry(item)
+			if err != nil {
+				return err
+			}
+			var links []AssetLink
+			for _, link := range collectAssetLinks(er.Fields, sortedKeys(er.Fields), entryLocales(er.Fields)) {
+				if link.AssetID == assetID {
+					links = append(links, link)
+				}
+			}
+			entries = append(entries, newEntry(er, links))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, status, err
 	}
+	return entries, status, nil
+}
 
-	// Extract AssetID from fields.downloadableFile["en-US"].sys.id
+// newEntry builds the caller DTO from a response and the links read from it
+func newEntry(er EntryResponse, links []AssetLink) Entry {
 	assetID := ""
-	if df, ok := er.Fields["downloadableFile"]; ok {
-		if dfMap, ok := df.(map[string]any); ok {
-			if localized, ok := dfMap["en-US"]; ok {
-				if locMap, ok := localized.(map[string]any); ok {
-					if sys, ok := locMap["sys"].(map[string]any); ok {
-						if id, ok := sys["id"].(string); ok {
-							assetID = id
-						}
+	if len(links) > 0 {
+		assetID = links[0].AssetID
+	}
+	return Entry{
+		ID:               er.Sys.ID,
+		Version:          er.Sys.Version,
+		PublishedVersion: er.Sys.PublishedVersion,
+		ContentTypeID:    er.Sys.ContentType.Sys.ID,
+		AssetID:          assetID,
+		AssetLinks:       links,
+		FieldStatus:      er.Sys.FieldStatus,
+		Fields:           er.Fields,
+	}
+}
+
+// collectAssetLinks reads fields.{fieldKey}.{locale}.sys.id for every given field and locale,
+// fields.{fieldKey}.{locale}[i].sys.id for array-of-links fields and the asset nodes of Rich
+// Text documents
+func collectAssetLinks(fields map[string]any, fieldKeys, locales []string) []AssetLink {
+	var links []AssetLink
+	for _, fieldKey := range fieldKeys {
+		localized, _ := fields[fieldKey].(map[string]any)
+		for _, locale := range locales {
+			if doc, ok := localized[locale].(map[string]any); ok && doc["nodeType"] == "document" {
+				links = richTextAssetLinks(fieldKey, locale, doc, "", links)
+			} else if items, ok := localized[locale].([]any); ok {
+				for i, item := range items {
+					if id := assetLinkID(item); id != "" {
+						links = append(links, AssetLink{FieldKey: fieldKey, Locale: locale, InArray: true, Index: i, AssetID: id})
 					}
 				}
+			} else if id := assetLinkID(localized[locale]); id != "" {
+				links = append(links, AssetLink{FieldKey: fieldKey, Locale: locale, AssetID: id})
 			}
 		}
 	}
+	return links
+}
 
-	return Entry{
-		ID:            er.Sys.ID,
-		Version:       er.Sys.Version,
-		ContentTypeID: ctID,
-		AssetID:       assetID,
-		FieldStatus:   er.Sys.FieldStatus,
-	}, status, nil
+// entryLocales returns every locale used by the entry's fields, sorted
+func entryLocales(fields map[string]any) []string {
+	seen := make(map[string]any)
+	for _, v := range fields {
+		localized, _ := v.(map[string]any)
+		for locale := range localized {
+			seen[locale] = nil
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// richTextAssetLinks appends the asset links of the embedded-asset-block and asset-hyperlink
+// nodes below node to links, in document order
+func richTextAssetLinks(fieldKey, locale string, node map[string]any, nodePath string, links []AssetLink) []AssetLink {
+	switch node["nodeType"] {
+	case "embedded-asset-block", "asset-hyperlink":
+		data, _ := node["data"].(map[string]any)
+		if id := assetLinkID(data["target"]); id != "" {
+			links = append(links, AssetLink{FieldKey: fieldKey, Locale: locale, NodePath: nodePath, AssetID: id})
+		}
+	}
+	content, _ := node["content"].([]any)
+	for i, child := range content {
+		if childNode, ok := child.(map[string]any); ok {
+			links = richTextAssetLinks(fieldKey, locale, childNode, fmt.Sprintf("%s/content/%d", nodePath, i), links)
+		}
+	}
+	return links
+}
+
+// assetLinkID returns the asset ID of a link object, or "" if v is not an asset link
+func assetLinkID(v any) string {
+	link, ok := v.(map[string]any)
+	if !ok {
+		return ""
+	}
+	sys, ok := link["sys"].(map[string]any)
+	if !ok {
+		return ""
+	}
+	if linkType, _ := sys["linkType"].(string); linkType != "" && linkType != "Asset" {
+		return ""
+	}
+	id, _ := sys["id"].(string)
+	return id
 }
 
 // UpdateEntryAssetLink sets a single asset link field on the entry (e.g. downloadableFile)
-func UpdateEntryAssetLink(ctx context.Context, client *http.Client, req UpdateEntryAssetLinkRequest) (int, int, error) {
+func (c *Client) UpdateEntryAssetLink(ctx context.Context, req UpdateEntryAssetLinkRequest) (int, int, error) {
 	// Extract values from the request struct
-	spaceID := req.SpaceID
-	environment := req.Environment
 	entryID := req.EntryID
 	fieldKey := req.FieldKey
 	locale := req.Locale
 	newAssetID := req.NewAssetID
 	version := req.Version
-	headerName := req.HeaderName
-	scheme := req.Scheme
-	token := req.Token
 
 	if locale == "" {
-		locale = "en-US"
+		locale = DefaultLocale
 	}
-	url := fmt.Sprintf("https://api.contentful.com/spaces/%s/environments/%s/entries/%s", spaceID, environment, entryID)
+	url := c.envURL("/entries/%s", entryID)
 	payload := map[string]any{
 		"fields": map[string]any{
 			fieldKey: map[string]any{locale: map[string]any{
@@ -232,22 +367,22 @@ func UpdateEntryAssetLink(ctx context.Context, client *http.Client, req UpdateEn
 	if err != nil {
 		return 0, 0, err
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPut, url, strings.NewReader(string(body)))
+	httpReq, err := newRequest(ctx, "update entry", http.MethodPut, url, strings.NewReader(string(body)))
 	if err != nil {
 		return 0, 0, err
 	}
 	httpReq.Header.Set("Content-Type", "application/vnd.contentful.management.v1+json")
 	httpReq.Header.Set("X-Contentful-Version", fmt.Sprintf("%d", version))
-	httpReq.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
-	resp, err := client.Do(httpReq)
+	c.authorize(httpReq)
+	linkPointer := map[string]string{fmt.Sprintf("/fields/%s/%s", fieldKey, locale): newAssetID}
+	resp, err := c.doVersioned(httpReq, url, updatedAt(version, linkPointer))
 	if err != nil {
 		return 0, 0, err
 	}
 	defer resp.Body.Close()
 	status := resp.StatusCode
 	if status < 200 || status >= 300 {
-		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return 0, status, fmt.Errorf("update entry failed: %s", strings.TrimSpace(string(b)))
+		return 0, status, newAPIError("update entry", resp)
 	}
 	var er EntryResponse
 	if err := json.NewDecoder(resp.Body).Decode(&er); err != nil {
@@ -257,58 +392,49 @@ func UpdateEntryAssetLink(ctx context.Context, client *http.Client, req UpdateEn
 }
 
 // PublishEntry publishes an entry with the supplied version
-func PublishEntry(ctx context.Context, client *http.Client, req PublishEntryRequest) (int, error) {
+func (c *Client) PublishEntry(ctx context.Context, req PublishEntryRequest) (int, error) {
 	// Extract values from the request struct
-	spaceID := req.SpaceID
-	environment := req.Environment
 	entryID := req.EntryID
 	version := req.Version
-	headerName := req.HeaderName
-	scheme := req.Scheme
-	token := req.Token
 
-	url := fmt.Sprintf("https://api.contentful.com/spaces/%s/environments/%s/entries/%s/published", spaceID, environment, entryID)
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPut, url, nil)
+	url := c.envURL("/entries/%s/published", entryID)
+	httpReq, err := newRequest(ctx, "publish entry", http.MethodPut, url, nil)
 	if err != nil {
 		return 0, err
 	}
 	httpReq.Header.Set("Accept", "application/vnd.contentful.management.v1+json")
 	httpReq.Header.Set("X-Contentful-Version", fmt.Sprintf("%d", version))
-	httpReq.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
-	resp, err := client.Do(httpReq)
+	c.authorize(httpReq)
+	resp, err := c.doVersioned(httpReq, c.envURL("/entries/%s", entryID), publishedAt(version))
 	if err != nil {
 		return 0, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return resp.StatusCode, fmt.Errorf("publish entry failed: %s", strings.TrimSpace(string(b)))
+		return resp.StatusCode, newAPIError("publish entry", resp)
 	}
 	return resp.StatusCode, nil
 }
 
-// PatchEntryAssetLink applies a JSON Patch to set fields.{fieldKey}.{locale} to a new Asset link
-func PatchEntryAssetLink(ctx context.Context, client *http.Client, req PatchEntryAssetLinkRequest) (int, int, error) {
+// PatchEntryAssetLink applies a JSON Patch setting every link to a new Asset link. Links in
+// array fields are replaced at their index, so the order of the array is kept, and Rich Text
+// links are replaced at their node's data.target, leaving the rest of the document untouched.
+func (c *Client) PatchEntryAssetLink(ctx context.Context, req PatchEntryAssetLinkRequest) (int, int, error) {
 	// Extract values from the request struct
-	spaceID := req.SpaceID
-	environment := req.Environment
 	entryID := req.EntryID
-	fieldKey := req.FieldKey
-	locale := req.Locale
+	links := req.Links
 	newAssetID := req.NewAssetID
 	version := req.Version
-	headerName := req.HeaderName
-	scheme := req.Scheme
-	token := req.Token
 
-	if locale == "" {
-		locale = "en-US"
+	if len(links) == 0 {
+		return 0, 0, fmt.Errorf("no asset links to patch")
 	}
-	url := fmt.Sprintf("https://api.contentful.com/spaces/%s/environments/%s/entries/%s", spaceID, environment, entryID)
-	patch := []map[string]any{
-		{
+	url := c.envURL("/entries/%s", entryID)
+	patch := make([]map[string]any, 0, len(links))
+	for _, link := range links {
+		patch = append(patch, map[string]any{
 			"op":   "replace",
-			"path": fmt.Sprintf("/fields/%s/%s", fieldKey, locale),
+			"path": link.path(),
 			"value": map[string]any{
 				"sys": map[string]any{
 					"type":     "Link",
@@ -316,28 +442,31 @@ func PatchEntryAssetLink(ctx context.Context, client *http.Client, req PatchEntr
 					"id":       newAssetID,
 				},
 			},
-		},
+		})
 	}
 	body, err := json.Marshal(patch)
 	if err != nil {
 		return 0, 0, err
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPatch, url, strings.NewReader(string(body)))
+	httpReq, err := newRequest(ctx, "patch entry", http.MethodPatch, url, strings.NewReader(string(body)))
 	if err != nil {
 		return 0, 0, err
 	}
 	httpReq.Header.Set("Content-Type", "application/json-patch+json")
 	httpReq.Header.Set("X-Contentful-Version", fmt.Sprintf("%d", version))
-	httpReq.Header.Set(headerName, strings.TrimSpace(scheme+" "+token))
-	resp, err := client.Do(httpReq)
+	c.authorize(httpReq)
+	linkPointers := make(map[string]string, len(links))
+	for _, link := range links {
+		linkPointers[link.path()] = newAssetID
+	}
+	resp, err := c.doVersioned(httpReq, url, updatedAt(version, linkPointers))
 	if err != nil {
 		return 0, 0, err
 	}
 	defer resp.Body.Close()
 	status := resp.StatusCode
 	if status < 200 || status >= 300 {
-		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return 0, status, fmt.Errorf("patch entry failed: %s", strings.TrimSpace(string(b)))
+		return 0, status, newAPIError("patch entry", resp)
 	}
 	var er EntryResponse
 	if err := json.NewDecoder(resp.Body).Decode(&er); err != nil {
@@ -0,0 +1,163 @@
+package contentful
+
+import (
+	"reflect"
+	"testing"
+)
+
+// assetLink returns the CMA link object for an asset
+func assetLink(id string) map[string]any {
+	return map[string]any{"sys": map[string]any{"type": "Link", "linkType": "Asset", "id": id}}
+}
+
+// richText returns a Rich Text node with the given children
+func richText(nodeType string, content ...any) map[string]any {
+	return map[string]any{"nodeType": nodeType, "data": map[string]any{}, "content": append([]any{}, content...)}
+}
+
+// embedded returns a Rich Text node of nodeType targeting the asset
+func embedded(nodeType, assetID string, content ...any) map[string]any {
+	node := richText(nodeType, content...)
+	node["data"] = map[string]any{"target": assetLink(assetID)}
+	return node
+}
+
+// text returns a Rich Text text node
+func text(value string) map[string]any {
+	return map[string]any{"nodeType": "text", "value": value, "marks": []any{}, "data": map[string]any{}}
+}
+
+func TestAssetLinkPath(t *testing.T) {
+	tests := []struct {
+		name string
+		link AssetLink
+		want string
+	}{
+		{
+			name: "single link",
+			link: AssetLink{FieldKey: "downloadableFile", Locale: "de-DE", AssetID: "a1"},
+			want: "/fields/downloadableFile/de-DE",
+		},
+		{
+			name: "default locale",
+			link: AssetLink{FieldKey: "downloadableFile", AssetID: "a1"},
+			want: "/fields/downloadableFile/en-US",
+		},
+		{
+			name: "array position",
+			link: AssetLink{FieldKey: "gallery", Locale: "en-US", InArray: true, Index: 2, AssetID: "a1"},
+			want: "/fields/gallery/en-US/2",
+		},
+		{
+			name: "embedded asset block",
+			link: AssetLink{FieldKey: "body", Locale: "en-US", NodePath: "/content/3", AssetID: "a1"},
+			want: "/fields/body/en-US/content/3/data/target",
+		},
+		{
+			name: "nested asset hyperlink",
+			link: AssetLink{FieldKey: "body", Locale: "en-US", NodePath: "/content/1/content/0/content/2", AssetID: "a1"},
+			want: "/fields/body/en-US/content/1/content/0/content/2/data/target",
+		},
+		{
+			name: "first array position",
+			link: AssetLink{FieldKey: "gallery", Locale: "en-US", InArray: true, Index: 0, AssetID: "a1"},
+			want: "/fields/gallery/en-US/0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.link.path(); got != tt.want {
+				t.Errorf("path() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectAssetLinks(t *testing.T) {
+	tests := []struct {
+		name      string
+		fields    map[string]any
+		fieldKeys []string
+		locales   []string
+		want      []AssetLink
+	}{
+		{
+			name:      "single link per locale",
+			fields:    map[string]any{"downloadableFile": map[string]any{"en-US": assetLink("a1"), "de-DE": assetLink("a2")}},
+			fieldKeys: []string{"downloadableFile"},
+			locales:   []string{"en-US", "de-DE"},
+			want: []AssetLink{
+				{FieldKey: "downloadableFile", Locale: "en-US", AssetID: "a1"},
+				{FieldKey: "downloadableFile", Locale: "de-DE", AssetID: "a2"},
+			},
+		},
+		{
+			name: "array of links keeps each position",
+			fields: map[string]any{"gallery": map[string]any{"en-US": []any{
+				assetLink("a1"),
+				map[string]any{"sys": map[string]any{"type": "Link", "linkType": "Entry", "id": "e9"}},
+				assetLink("a1"),
+				"not a link",
+			}}},
+			fieldKeys: []string{"gallery"},
+			locales:   []string{"en-US"},
+			want: []AssetLink{
+				{FieldKey: "gallery", Locale: "en-US", InArray: true, Index: 0, AssetID: "a1"},
+				{FieldKey: "gallery", Locale: "en-US", InArray: true, Index: 2, AssetID: "a1"},
+			},
+		},
+		{
+			name: "only the selected fields and locales",
+			fields: map[string]any{
+				"downloadableFile": map[string]any{"en-US": assetLink("a1"), "fr-FR": assetLink("a3")},
+				"gallery":          map[string]any{"en-US": []any{assetLink("a2")}},
+			},
+			fieldKeys: []string{"downloadableFile", "missing"},
+			locales:   []string{"en-US", "it-IT"},
+			want:      []AssetLink{{FieldKey: "downloadableFile", Locale: "en-US", AssetID: "a1"}},
+		},
+		{
+			name: "rich text embeds and hyperlinks in document order",
+			fields: map[string]any{"body": map[string]any{"en-US": richText("document",
+				richText("paragraph", text("Intro")),
+				embedded("embedded-asset-block", "a1"),
+				richText("unordered-list",
+					richText("list-item",
+						richText("paragraph", text("See "), embedded("asset-hyperlink", "a2", text("the report")), text(".")),
+					),
+				),
+				embedded("embedded-entry-block", "e9"),
+				embedded("embedded-asset-block", "a1"),
+			)}},
+			fieldKeys: []string{"body"},
+			locales:   []string{"en-US"},
+			want: []AssetLink{
+				{FieldKey: "body", Locale: "en-US", NodePath: "/content/1", AssetID: "a1"},
+				{FieldKey: "body", Locale: "en-US", NodePath: "/content/2/content/0/content/0/content/1", AssetID: "a2"},
+				{FieldKey: "body", Locale: "en-US", NodePath: "/content/4", AssetID: "a1"},
+			},
+		},
+		{
+			name:      "rich text without assets",
+			fields:    map[string]any{"body": map[string]any{"en-US": richText("document", richText("paragraph", text("Plain")))}},
+			fieldKeys: []string{"body"},
+			locales:   []string{"en-US"},
+		},
+		{
+			name:      "empty array",
+			fields:    map[string]any{"gallery": map[string]any{"en-US": []any{}}},
+			fieldKeys: []string{"gallery"},
+			locales:   []string{"en-US"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectAssetLinks(tt.fields, tt.fieldKeys, tt.locales)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collectAssetLinks() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package contentful
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Error IDs the CMA sends in sys.id of its error responses
+const (
+	ErrorBadRequest         = "BadRequest"
+	ErrorInvalidQuery       = "InvalidQuery"
+	ErrorAccessTokenInvalid = "AccessTokenInvalid"
+	ErrorAccessDenied       = "AccessDenied"
+	ErrorNotFound           = "NotFound"
+	ErrorVersionMismatch    = "VersionMismatch"
+	ErrorValidationFailed   = "ValidationFailed"
+	ErrorUnresolvedLinks    = "UnresolvedLinks"
+	ErrorRateLimitExceeded  = "RateLimitExceeded"
+	ErrorServerError        = "ServerError"
+)
+
+// APIError is a failed CMA or Upload API call, carrying the details of the error response.
+// Use errors.As to read it from the errors the Client returns.
+type APIError struct {
+	Op         string // failed operation, e.g. "publish entry"; empty for reads
+	StatusCode int
+	ID         string // sys.id of the error, e.g. ErrorVersionMismatch; empty when the body is not CMA error JSON
+	Message    string
+	RequestID  string // from the body's requestId or the X-Contentful-Request-Id header
+	Details    []ErrorDetail
+	Body       string // the raw body when it is not CMA error JSON
+}
+
+// ErrorDetail is one entry of details.errors, e.g. a field that failed validation
+type ErrorDetail struct {
+	Name    string `json:"name"`    // e.g. "required" or "size"
+	Path    []any  `json:"path"`    // e.g. ["fields", "title", "en-US"]
+	Details string `json:"details"` // human-readable explanation
+	Value   any    `json:"value"`
+}
+
+// Category returns the error's sys.id, or one derived from the status code when the
+// response did not carry one
+func (e *APIError) Category() string {
+	if e.ID != "" {
+		return e.ID
+	}
+	switch {
+	case e.StatusCode == http.StatusBadRequest:
+		return ErrorBadRequest
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrorAccessTokenInvalid
+	case e.StatusCode == http.StatusForbidden:
+		return ErrorAccessDenied
+	case e.StatusCode == http.StatusNotFound:
+		return ErrorNotFound
+	case e.StatusCode == http.StatusConflict:
+		return ErrorVersionMismatch
+	case e.StatusCode == http.StatusUnprocessableEntity:
+		return ErrorValidationFailed
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrorRateLimitExceeded
+	case e.StatusCode >= 500:
+		return ErrorServerError
+	}
+	return fmt.Sprintf("HTTP%d", e.StatusCode)
+}
+
+// Error renders the operation, category, status, message, details and request ID, e.g.
+// "publish entry failed: VersionMismatch (status 409): ... [request 4f2a...]"
+func (e *APIError) Error() string {
+	var b strings.Builder
+	if e.Op != "" {
+		b.WriteString(e.Op + " failed: ")
+	}
+	fmt.Fprintf(&b, "%s (status %d)", e.Category(), e.StatusCode)
+	if msg := strings.TrimSpace(e.Message); msg != "" {
+		b.WriteString(": " + msg)
+	} else if body := strings.TrimSpace(e.Body); body != "" {
+		b.WriteString(": " + body)
+	}
+	for i, d := range e.Details {
+		sep := ", "
+		if i == 0 {
+			sep = "; "
+		}
+		b.WriteString(sep + d.String())
+	}
+	if e.RequestID != "" {
+		b.WriteString(" [request " + e.RequestID + "]")
+	}
+	return b.String()
+}
+
+// String renders the detail as its dotted path, name and explanation, e.g.
+// "fields.title.en-US required: The property is required"
+func (d ErrorDetail) String() string {
+	parts := make([]string, 0, len(d.Path))
+	for _, p := range d.Path {
+		parts = append(parts, fmt.Sprint(p))
+	}
+	s := strings.TrimSpace(strings.Join(parts, ".") + " " + d.Name)
+	if d.Details != "" {
+		s += ": " + d.Details
+	}
+	return s
+}
+
+// ErrorCategory returns the category of the APIError in err's chain, or "" when there is none
+func ErrorCategory(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Category()
+	}
+	return ""
+}
+
+// newAPIError reads up to 4KB of a failed response's body and parses it as CMA error JSON
+func newAPIError(op string, resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	e := &APIError{
+		Op:         op,
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Contentful-Request-Id"),
+	}
+
+	var parsed struct {
+		Sys struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		} `json:"sys"`
+		Message   string `json:"message"`
+		RequestID string `json:"requestId"`
+		Details   struct {
+			Errors []ErrorDetail `json:"errors"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil || parsed.Sys.Type != "Error" {
+		e.Body = strings.TrimSpace(string(body))
+		return e
+	}
+	e.ID = parsed.Sys.ID
+	e.Message = parsed.Message
+	e.Details = parsed.Details.Errors
+	if parsed.RequestID != "" {
+		e.RequestID = parsed.RequestID
+	}
+	return e
+}
@@ -0,0 +1,102 @@
+package contentful
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		header        string // X-Contentful-Request-Id
+		wantCategory  string
+		wantRequestID string
+		wantDetails   []ErrorDetail
+		wantBody      string
+	}{
+		{
+			name:          "version mismatch from sys.id",
+			status:        http.StatusConflict,
+			body:          `{"sys":{"type":"Error","id":"VersionMismatch"},"message":"Version mismatch","requestId":"req-body"}`,
+			header:        "req-header",
+			wantCategory:  ErrorVersionMismatch,
+			wantRequestID: "req-body",
+		},
+		{
+			name:          "validation details",
+			status:        http.StatusUnprocessableEntity,
+			body:          `{"sys":{"type":"Error","id":"ValidationFailed"},"message":"Validation error","details":{"errors":[{"name":"required","path":["fields","title","en-US"],"details":"The property is required"}]}}`,
+			header:        "req-header",
+			wantCategory:  ErrorValidationFailed,
+			wantRequestID: "req-header",
+			wantDetails:   []ErrorDetail{{Name: "required", Path: []any{"fields", "title", "en-US"}, Details: "The property is required"}},
+		},
+		{
+			name:          "sys.id wins over the status",
+			status:        http.StatusBadRequest,
+			body:          `{"sys":{"type":"Error","id":"InvalidQuery"},"message":"The query you sent was invalid"}`,
+			wantCategory:  ErrorInvalidQuery,
+			wantRequestID: "",
+		},
+		{name: "400 without JSON", status: http.StatusBadRequest, body: "bad", wantCategory: ErrorBadRequest, wantBody: "bad"},
+		{name: "401 without JSON", status: http.StatusUnauthorized, wantCategory: ErrorAccessTokenInvalid},
+		{name: "403 without JSON", status: http.StatusForbidden, wantCategory: ErrorAccessDenied},
+		{name: "404 without JSON", status: http.StatusNotFound, wantCategory: ErrorNotFound},
+		{name: "409 without JSON", status: http.StatusConflict, wantCategory: ErrorVersionMismatch},
+		{name: "422 without JSON", status: http.StatusUnprocessableEntity, wantCategory: ErrorValidationFailed},
+		{name: "429 without JSON", status: http.StatusTooManyRequests, wantCategory: ErrorRateLimitExceeded},
+		{name: "502 from a proxy", status: http.StatusBadGateway, body: "<html>Bad Gateway</html>", header: "req-header", wantCategory: ErrorServerError, wantRequestID: "req-header", wantBody: "<html>Bad Gateway</html>"},
+		{name: "other status", status: http.StatusTeapot, wantCategory: "HTTP418"},
+		{name: "JSON that is not a CMA error", status: http.StatusNotFound, body: `{"sys":{"type":"Entry","id":"e1"}}`, wantCategory: ErrorNotFound, wantBody: `{"sys":{"type":"Entry","id":"e1"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(tt.body))}
+			if tt.header != "" {
+				resp.Header.Set("X-Contentful-Request-Id", tt.header)
+			}
+			apiErr := newAPIError("publish entry", resp)
+			if got := apiErr.Category(); got != tt.wantCategory {
+				t.Errorf("Category() = %q, want %q", got, tt.wantCategory)
+			}
+			if apiErr.RequestID != tt.wantRequestID {
+				t.Errorf("RequestID = %q, want %q", apiErr.RequestID, tt.wantRequestID)
+			}
+			if !reflect.DeepEqual(apiErr.Details, tt.wantDetails) {
+				t.Errorf("Details = %+v, want %+v", apiErr.Details, tt.wantDetails)
+			}
+			if apiErr.Body != tt.wantBody {
+				t.Errorf("Body = %q, want %q", apiErr.Body, tt.wantBody)
+			}
+			msg := apiErr.Error()
+			if !strings.HasPrefix(msg, "publish entry failed: "+tt.wantCategory) {
+				t.Errorf("Error() = %q, want it to start with the operation and category", msg)
+			}
+			if tt.wantRequestID != "" && !strings.HasSuffix(msg, "[request "+tt.wantRequestID+"]") {
+				t.Errorf("Error() = %q, want it to end with the request ID", msg)
+			}
+
+			// Callers wrap the error on its way up
+			wrapped := fmt.Errorf("row 2: patch entry: %w", fmt.Errorf("attempt 3: %w", apiErr))
+			if got := ErrorCategory(wrapped); got != tt.wantCategory {
+				t.Errorf("ErrorCategory(wrapped) = %q, want %q", got, tt.wantCategory)
+			}
+			var target *APIError
+			if !errors.As(wrapped, &target) || target != apiErr {
+				t.Error("errors.As does not find the APIError through the wrapping")
+			}
+		})
+	}
+
+	if got := ErrorCategory(errors.New("dial tcp: connection refused")); got != "" {
+		t.Errorf("ErrorCategory(network error) = %q, want empty", got)
+	}
+}
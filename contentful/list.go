@@ -0,0 +1,138 @@
+package contentful
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// idBatchSize is the number of IDs sent in one sys.id[in] filter, keeping request URLs short
+const idBatchSize = 100
+
+// ListEntriesRequest contains all the parameters needed to page through entries
+type ListEntriesRequest struct {
+	IDs       []string   // when set, only these entries are listed, requested idBatchSize at a time
+	Query     url.Values // further CMA search parameters, e.g. content_type=document
+	FieldKeys []string   // asset link fields to read, defaults to DefaultAssetField
+	Locales   []string   // locales to read, defaults to DefaultLocale
+	Include   int        // levels of linked entries and assets to return in the includes, 0 for none
+}
+
+// ListAssetsRequest contains all the parameters needed to page through assets
+type ListAssetsRequest struct {
+	IDs    []string   // when set, only these assets are listed, requested idBatchSize at a time
+	Query  url.Values // further CMA search parameters, e.g. mimetype_group=pdfdocument
+	Locale string     // locale to read; falls back to DefaultLocale when an asset has no file in it
+}
+
+// EntryList holds the entries a ListEntries call matched and the linked items the CMA
+// included with them
+type EntryList struct {
+	Entries         []Entry
+	IncludedEntries map[string]Entry // by ID, with the asset links of the requested fields and locales
+	IncludedAssets  map[string]Asset // by ID, read in DefaultLocale
+}
+
+// ListEntries returns every entry matching the request, with the asset links of the
+// requested fields and locales. Entries missing from IDs are left out rather than reported
+// as errors, so callers compare the result with the IDs they asked for.
+func (c *Client) ListEntries(ctx context.Context, req ListEntriesRequest) (EntryList, int, error) {
+	// Extract values from the request struct
+	fieldKeys := req.FieldKeys
+	locales := req.Locales
+
+	if len(fieldKeys) == 0 {
+		fieldKeys = []string{DefaultAssetField}
+	}
+	if len(locales) == 0 {
+		locales = []string{DefaultLocale}
+	}
+
+	query := cloneQuery(req.Query)
+	if err := checkQuery(query); err != nil {
+		return EntryList{}, 0, err
+	}
+	if req.Include > 0 {
+		query.Set("include", strconv.Itoa(req.Include))
+	}
+
+	list := EntryList{
+		IncludedEntries: make(map[string]Entry),
+		IncludedAssets:  make(map[string]Asset),
+	}
+	status, err := c.pageBatches(ctx, "/entries", query, req.IDs, entryPageSize, func(page collectionPage) error {
+		for _, item := range page.Items {
+			er, err := c.decodeEntry(item)
+			if err != nil {
+				return err
+			}
+			list.Entries = append(list.Entries, newEntry(er, collectAssetLinks(er.Fields, fieldKeys, locales)))
+		}
+		for _, item := range page.Includes.Entry {
+			er, err := c.decodeEntry(item)
+			if err != nil {
+				return err
+			}
+			list.IncludedEntries[er.Sys.ID] = newEntry(er, collectAssetLinks(er.Fields, fieldKeys, locales))
+		}
+		for _, item := range page.Includes.Asset {
+			ar, err := c.decodeAsset(item)
+			if err != nil {
+				return err
+			}
+			list.IncludedAssets[ar.Sys.ID] = newAsset(ar, DefaultLocale)
+		}
+		return nil
+	})
+	if err != nil {
+		return EntryList{}, status, err
+	}
+	return list, status, nil
+}
+
+// ListAssets returns every asset matching the request. Assets missing from IDs are left
+// out rather than reported as errors, so callers compare the result with the IDs they asked for.
+func (c *Client) ListAssets(ctx context.Context, req ListAssetsRequest) ([]Asset, int, error) {
+	query := cloneQuery(req.Query)
+	if err := checkQuery(query); err != nil {
+		return nil, 0, err
+	}
+
+	var assets []Asset
+	status, err := c.pageBatches(ctx, "/assets", query, req.IDs, entryPageSize, func(page collectionPage) error {
+		for _, item := range page.Items {
+			ar, err := c.decodeAsset(item)
+			if err != nil {
+				return err
+			}
+			assets = append(assets, newAsset(ar, req.Locale))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, status, err
+	}
+	return assets, status, nil
+}
+
+// pageBatches pages through the collection once per idBatchSize IDs, filtering on
+// sys.id[in], or once for the whole query when ids is empty
+func (c *Client) pageBatches(ctx context.Context, path string, query url.Values, ids []string, pageSize int, fn func(page collectionPage) error) (int, error) {
+	if len(ids) == 0 {
+		return c.pageCollection(ctx, path, query, pageSize, fn)
+	}
+
+	status := 0
+	for start := 0; start < len(ids); start += idBatchSize {
+		end := min(start+idBatchSize, len(ids))
+		q := cloneQuery(query)
+		q.Set("sys.id[in]", strings.Join(ids[start:end], ","))
+
+		var err error
+		if status, err = c.pageCollection(ctx, path, q, pageSize, fn); err != nil {
+			return status, err
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,122 @@
+package contentful_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"contentful-asset-replacer/contentful"
+	"contentful-asset-replacer/contentful/contentfultest"
+)
+
+// newAssetSpace starts a fake CMA holding n assets "asset000", "asset001", ... and returns
+// a client for it with their IDs
+func newAssetSpace(t *testing.T, n int) (*contentfultest.Server, *contentful.Client, []string) {
+	t.Helper()
+	srv := contentfultest.NewServer("space", "master")
+	t.Cleanup(srv.Close)
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("asset%03d", i)
+		srv.AddAsset(contentfultest.Asset{ID: ids[i], Title: ids[i], FileName: ids[i] + ".pdf", ContentType: "application/pdf", Content: []byte("%PDF-1.4\n")})
+	}
+	return srv, srv.Client(), ids
+}
+
+// assetIDs returns the IDs of assets in order
+func assetIDs(assets []contentful.Asset) []string {
+	ids := make([]string, 0, len(assets))
+	for _, a := range assets {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
+
+func TestPageCollection(t *testing.T) {
+	type page struct {
+		skip, limit string
+		ids         int // IDs in the sys.id[in] filter, 0 for none
+	}
+	tests := []struct {
+		name         string
+		assets       int
+		maxPageItems int
+		ids          func(all []string) []string // IDs to list, nil for the whole collection
+		want         func(all []string) []string
+		wantPages    []page
+	}{
+		{
+			name:   "pages with skip and limit until the total",
+			assets: 250,
+			want:   func(all []string) []string { return all },
+			wantPages: []page{
+				{skip: "0", limit: "100"},
+				{skip: "100", limit: "100"},
+				{skip: "200", limit: "100"},
+			},
+		},
+		{
+			name:         "halves the page size while the response is too big",
+			assets:       60,
+			maxPageItems: 30,
+			want:         func(all []string) []string { return all },
+			wantPages: []page{
+				{skip: "0", limit: "100"},
+				{skip: "0", limit: "50"},
+				{skip: "0", limit: "25"},
+				{skip: "25", limit: "25"},
+				{skip: "50", limit: "25"},
+			},
+		},
+		{
+			name:   "filters on sys.id[in] one batch of IDs at a time",
+			assets: 210,
+			ids: func(all []string) []string {
+				return append(slices.Clone(all), "missing1", "missing2")
+			},
+			want: func(all []string) []string { return all },
+			wantPages: []page{
+				{skip: "0", limit: "100", ids: 100},
+				{skip: "0", limit: "100", ids: 100},
+				{skip: "0", limit: "100", ids: 12},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, client, all := newAssetSpace(t, tt.assets)
+			srv.MaxPageItems = tt.maxPageItems
+			req := contentful.ListAssetsRequest{}
+			if tt.ids != nil {
+				req.IDs = tt.ids(all)
+			}
+
+			assets, _, err := client.ListAssets(context.Background(), req)
+			if err != nil {
+				t.Fatalf("list assets: %v", err)
+			}
+			if got, want := assetIDs(assets), tt.want(all); !slices.Equal(got, want) {
+				t.Errorf("listed %d assets %v..., want %d", len(got), got[:min(3, len(got))], len(want))
+			}
+
+			var pages []page
+			for _, q := range srv.Queries(http.MethodGet, "/assets") {
+				if q.Get("order") != "sys.id" {
+					t.Errorf("request %v is not ordered by sys.id", q)
+				}
+				p := page{skip: q.Get("skip"), limit: q.Get("limit")}
+				if in := q.Get("sys.id[in]"); in != "" {
+					p.ids = len(strings.Split(in, ","))
+				}
+				pages = append(pages, p)
+			}
+			if !slices.Equal(pages, tt.wantPages) {
+				t.Errorf("pages = %+v, want %+v", pages, tt.wantPages)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package contentful_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"contentful-asset-replacer/contentful"
+	"contentful-asset-replacer/contentful/contentfultest"
+)
+
+func TestPatchEntryAssetLink(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		value any                                                       // the field's en-US value before patching
+		patch func(links []contentful.AssetLink) []contentful.AssetLink // picks the links to a1 to patch; nil patches every one
+		want  any                                                       // the field's en-US value after patching a1 to a2
+	}{
+		{
+			name:  "single link",
+			field: "downloadableFile",
+			value: contentfultest.LinkAsset("a1"),
+			want:  contentfultest.LinkAsset("a2"),
+		},
+		{
+			name:  "every position of an array",
+			field: "gallery",
+			value: []any{contentfultest.LinkAsset("a1"), contentfultest.LinkAsset("a3"), contentfultest.LinkAsset("a1")},
+			want:  []any{contentfultest.LinkAsset("a2"), contentfultest.LinkAsset("a3"), contentfultest.LinkAsset("a2")},
+		},
+		{
+			name:  "one position of an array",
+			field: "gallery",
+			value: []any{contentfultest.LinkAsset("a1"), contentfultest.LinkAsset("a3"), contentfultest.LinkAsset("a1")},
+			patch: func(links []contentful.AssetLink) []contentful.AssetLink {
+				return links[1:]
+			},
+			want: []any{contentfultest.LinkAsset("a1"), contentfultest.LinkAsset("a3"), contentfultest.LinkAsset("a2")},
+		},
+		{
+			name:  "rich text embeds and hyperlinks",
+			field: "body",
+			value: richTextBody("a1", "a1"),
+			want:  richTextBody("a2", "a2"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, client := newSpace(t)
+			srv.AddEntry(contentfultest.Entry{
+				ID:            "doc",
+				ContentTypeID: "document",
+				Fields:        map[string]any{tt.field: map[string]any{"en-US": tt.value}},
+			})
+			ctx := context.Background()
+			entry, _, err := client.FetchEntry(ctx, contentful.FetchEntryRequest{EntryID: "doc", FieldKeys: []string{tt.field}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var links []contentful.AssetLink
+			for _, link := range entry.AssetLinks {
+				if link.AssetID == "a1" {
+					links = append(links, link)
+				}
+			}
+			if tt.patch != nil {
+				links = tt.patch(links)
+			}
+
+			if _, _, err := client.PatchEntryAssetLink(ctx, contentful.PatchEntryAssetLinkRequest{EntryID: "doc", Links: links, NewAssetID: "a2", Version: entry.Version}); err != nil {
+				t.Fatalf("patch: %v", err)
+			}
+			patched, _ := srv.Entry("doc")
+			got := patched.Fields[tt.field].(map[string]any)["en-US"]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+// richTextBody returns a Rich Text document embedding the block asset and linking the inline
+// asset from a paragraph
+func richTextBody(blockAssetID, inlineAssetID string) map[string]any {
+	text := func(value string) any {
+		return map[string]any{"nodeType": "text", "value": value, "marks": []any{}, "data": map[string]any{}}
+	}
+	return map[string]any{"nodeType": "document", "data": map[string]any{}, "content": []any{
+		map[string]any{"nodeType": "embedded-asset-block", "data": map[string]any{"target": contentfultest.LinkAsset(blockAssetID)}, "content": []any{}},
+		map[string]any{"nodeType": "paragraph", "data": map[string]any{}, "content": []any{
+			text("See "),
+			map[string]any{"nodeType": "asset-hyperlink", "data": map[string]any{"target": contentfultest.LinkAsset(inlineAssetID)}, "content": []any{text("the report")}},
+			text("."),
+		}},
+	}}
+}
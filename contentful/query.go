@@ -0,0 +1,170 @@
+package contentful
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// QueryRequest contains all the parameters needed to page through a collection query
+type QueryRequest struct {
+	Query     url.Values // CMA search parameters, e.g. content_type=document or sys.updatedAt[gte]=2025-01-01
+	FieldKeys []string   // QueryEntries only: asset link fields to read, defaults to DefaultAssetField
+	Locales   []string   // QueryEntries only: locales to read, defaults to DefaultLocale
+}
+
+const (
+	// entryPageSize is the number of entries requested per collection page
+	entryPageSize = 100
+	// idPageSize is the number of IDs requested per collection page
+	idPageSize = maxPageSize
+	// maxPageSize is the largest limit the CMA accepts
+	maxPageSize = 1000
+)
+
+// collectionPage models one page of a CMA collection, leaving items and includes to the caller
+type collectionPage struct {
+	Sys struct {
+		Type string `json:"type"`
+	} `json:"sys"`
+	Total    int               `json:"total"`
+	Skip     int               `json:"skip"`
+	Limit    int               `json:"limit"`
+	Items    []json.RawMessage `json:"items"`
+	Includes struct {
+		Entry []json.RawMessage `json:"Entry"`
+		Asset []json.RawMessage `json:"Asset"`
+	} `json:"includes"`
+}
+
+// QueryEntryIDs returns the IDs of every entry matching the query
+func (c *Client) QueryEntryIDs(ctx context.Context, req QueryRequest) ([]string, int, error) {
+	return c.queryIDs(ctx, "/entries", req.Query)
+}
+
+// QueryAssetIDs returns the IDs of every asset matching the query
+func (c *Client) QueryAssetIDs(ctx context.Context, req QueryRequest) ([]string, int, error) {
+	return c.queryIDs(ctx, "/assets", req.Query)
+}
+
+// QueryEntries returns every entry matching the query, with the asset links of the
+// requested fields and locales
+func (c *Client) QueryEntries(ctx context.Context, req QueryRequest) ([]Entry, int, error) {
+	list, status, err := c.ListEntries(ctx, ListEntriesRequest{Query: req.Query, FieldKeys: req.FieldKeys, Locales: req.Locales})
+	if err != nil {
+		return nil, status, err
+	}
+	return list.Entries, status, nil
+}
+
+// queryIDs pages through a collection requesting only sys.id
+func (c *Client) queryIDs(ctx context.Context, path string, query url.Values) ([]string, int, error) {
+	q := cloneQuery(query)
+	if err := checkQuery(q); err != nil {
+		return nil, 0, err
+	}
+	q.Set("select", "sys.id")
+
+	var ids []string
+	status, err := c.pageCollection(ctx, path, q, idPageSize, func(page collectionPage) error {
+		for _, item := range page.Items {
+			var ref struct {
+				Sys struct {
+					ID string `json:"id"`
+				} `json:"sys"`
+			}
+			if err := json.Unmarshal(item, &ref); err != nil {
+				return err
+			}
+			ids = append(ids, ref.Sys.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, status, err
+	}
+	return ids, status, nil
+}
+
+// pageCollection requests every page of a collection below the environment, in a stable
+// order, and hands each page to fn. Pages the CMA refuses as too large are requested again
+// with half the limit.
+func (c *Client) pageCollection(ctx context.Context, path string, query url.Values, pageSize int, fn func(page collectionPage) error) (int, error) {
+	q := cloneQuery(query)
+	if q.Get("order") == "" {
+		q.Set("order", "sys.id")
+	}
+	if pageSize < 1 || pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	status := 0
+	for skip := 0; ; {
+		q.Set("skip", strconv.Itoa(skip))
+		q.Set("limit", strconv.Itoa(pageSize))
+		httpReq, err := newRequest(ctx, "list "+strings.TrimPrefix(path, "/"), http.MethodGet, c.envURL("%s", path)+"?"+q.Encode(), nil)
+		if err != nil {
+			return 0, err
+		}
+		httpReq.Header.Set("Accept", "application/json")
+		c.authorize(httpReq)
+
+		resp, err := c.do(httpReq)
+		if err != nil {
+			return 0, err
+		}
+		status = resp.StatusCode
+		if status < 200 || status >= 300 {
+			apiErr := newAPIError("", resp)
+			resp.Body.Close()
+			if status == http.StatusBadRequest && pageSize > 1 && responseTooBig(apiErr) {
+				pageSize /= 2
+				continue
+			}
+			return status, apiErr
+		}
+
+		var page collectionPage
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return status, err
+		}
+		if err := fn(page); err != nil {
+			return status, err
+		}
+
+		skip += len(page.Items)
+		if len(page.Items) == 0 || skip >= page.Total {
+			return status, nil
+		}
+	}
+}
+
+// responseTooBig reports whether an error is the CMA's refusal of a response over its size limit
+func responseTooBig(e *APIError) bool {
+	return strings.Contains(strings.ToLower(e.Message+e.Body), "response size too big")
+}
+
+// checkQuery rejects the paging parameters the client sets itself
+func checkQuery(q url.Values) error {
+	for _, key := range []string{"skip", "limit", "select"} {
+		if q.Has(key) {
+			return fmt.Errorf("query must not set %s; paging is handled by the client", key)
+		}
+	}
+	return nil
+}
+
+// cloneQuery copies query so paging does not modify the caller's values
+func cloneQuery(query url.Values) url.Values {
+	q := make(url.Values, len(query)+4)
+	for k, v := range query {
+		q[k] = append([]string(nil), v...)
+	}
+	return q
+}
@@ -0,0 +1,57 @@
+package contentful
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultRequestsPerSecond matches the CMA's default per-space rate limit
+const DefaultRequestsPerSecond = 7
+
+// RateLimiter spaces requests evenly so that callers sharing it stay under a fixed
+// requests-per-second budget. It is safe for concurrent use.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rps requests per second, or nil (no limit) when rps <= 0
+func NewRateLimiter(rps float64) *RateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// Wait blocks until the caller may send its next request or ctx is done.
+// A nil limiter never blocks.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	// Reserve the next free slot, then sleep until it arrives
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	wait := time.Until(slot)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
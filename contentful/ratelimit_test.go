@@ -0,0 +1,77 @@
+package contentful_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"contentful-asset-replacer/contentful"
+)
+
+func TestRateLimiterSharedByWorkers(t *testing.T) {
+	const (
+		rps       = 200
+		workers   = 8
+		perWorker = 10
+	)
+	interval := time.Second / rps
+
+	tests := []struct {
+		name string
+		call func(ctx context.Context, t *testing.T, client *contentful.Client)
+	}{
+		{
+			name: "Wait",
+			call: func(ctx context.Context, t *testing.T, client *contentful.Client) {
+				if err := client.Limiter.Wait(ctx); err != nil {
+					t.Error(err)
+				}
+			},
+		},
+		{
+			name: "client requests",
+			call: func(ctx context.Context, t *testing.T, client *contentful.Client) {
+				if _, _, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: "a1"}); err != nil {
+					t.Error(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, client := newSpace(t)
+			client.Limiter = contentful.NewRateLimiter(rps)
+			ctx := context.Background()
+
+			var mu sync.Mutex
+			var granted []time.Duration
+			start := time.Now()
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < perWorker; i++ {
+						tt.call(ctx, t, client)
+						mu.Lock()
+						granted = append(granted, time.Since(start))
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			// The limiter hands out one slot per interval, so however the workers interleave,
+			// the i-th call to finish cannot have started before i intervals passed
+			slices.Sort(granted)
+			for i, at := range granted {
+				if earliest := time.Duration(i) * interval; at < earliest {
+					t.Fatalf("call %d of %d finished after %v, want at least %v", i+1, len(granted), at, earliest)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package contentful
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Request describes one call made through a Client, after any retries
+type Request struct {
+	Step      string // the workflow step the call belongs to, e.g. "publish entry"
+	Method    string
+	Path      string // URL path, without the query
+	Status    int    // final HTTP status, zero when no response was received
+	RequestID string // X-Contentful-Request-Id of the final response
+	Duration  time.Duration
+	Retries   int
+	Err       string // transport error, empty when a response was received
+}
+
+// RequestLog collects the requests made by Client calls using a context from WithRequestLog
+type RequestLog struct {
+	mu       sync.Mutex
+	requests []Request
+}
+
+// Requests returns the requests recorded so far, in the order they completed
+func (l *RequestLog) Requests() []Request {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Request(nil), l.requests...)
+}
+
+func (l *RequestLog) add(req Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests = append(l.requests, req)
+}
+
+type requestLogKey struct{}
+
+type requestStepKey struct{}
+
+// newRequest builds a request for the named workflow step, which its log record carries
+func newRequest(ctx context.Context, step, method, url string, body io.Reader) (*http.Request, error) {
+	return http.NewRequestWithContext(context.WithValue(ctx, requestStepKey{}, step), method, url, body)
+}
+
+// stepOf returns the workflow step a request context was built for
+func stepOf(ctx context.Context) string {
+	step, _ := ctx.Value(requestStepKey{}).(string)
+	return step
+}
+
+// WithRequestLog returns a context whose Client calls are recorded in the returned log
+func WithRequestLog(ctx context.Context) (context.Context, *RequestLog) {
+	l := &RequestLog{}
+	return context.WithValue(ctx, requestLogKey{}, l), l
+}
+
+// logRequest records a completed call in the request's log, if it has one
+func logRequest(r *http.Request, resp *http.Response, retries int, start time.Time, err error) {
+	l, _ := r.Context().Value(requestLogKey{}).(*RequestLog)
+	if l == nil {
+		return
+	}
+	req := Request{
+		Step:     stepOf(r.Context()),
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Duration: time.Since(start),
+		Retries:  retries,
+	}
+	if resp != nil {
+		req.Status = resp.StatusCode
+		req.RequestID = resp.Header.Get("X-Contentful-Request-Id")
+	}
+	if err != nil {
+		req.Err = err.Error()
+	}
+	l.add(req)
+}
@@ -0,0 +1,291 @@
+package contentful
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is the number of retries NewClient configures
+	DefaultMaxRetries = 5
+	// DefaultRetryBaseDelay is the first backoff delay NewClient configures; it doubles per attempt
+	DefaultRetryBaseDelay = 500 * time.Millisecond
+	// DefaultRetryMaxDelay caps a single backoff or rate-limit wait
+	DefaultRetryMaxDelay = 60 * time.Second
+)
+
+// RetryCounter tallies the retries performed by Client calls made with a context from WithRetryCounter
+type RetryCounter struct {
+	n atomic.Int64
+}
+
+// Count returns the number of retries recorded so far
+func (rc *RetryCounter) Count() int {
+	if rc == nil {
+		return 0
+	}
+	return int(rc.n.Load())
+}
+
+type retryCounterKey struct{}
+
+// WithRetryCounter returns a context whose Client calls add their retries to the returned counter
+func WithRetryCounter(ctx context.Context) (context.Context, *RetryCounter) {
+	rc := &RetryCounter{}
+	return context.WithValue(ctx, retryCounterKey{}, rc), rc
+}
+
+type safeRetryKey struct{}
+
+// markRetryable flags a non-idempotent request (e.g. an upload POST) as safe to resend
+// after a server error or dropped connection
+func markRetryable(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), safeRetryKey{}, true))
+}
+
+// doWithRetry sends r, retrying rate-limited responses, server errors and transport
+// failures with exponential backoff and jitter. Requests whose body cannot be replayed
+// are sent once. Returns the number of retries made.
+func (c *Client) doWithRetry(httpClient *http.Client, r *http.Request) (*http.Response, int, error) {
+	ctx := r.Context()
+	counter, _ := ctx.Value(retryCounterKey{}).(*RetryCounter)
+	replayable := r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+
+	for attempt := 0; ; attempt++ {
+		req := r
+		if attempt > 0 {
+			req = r.Clone(ctx)
+			if r.GetBody != nil {
+				body, err := r.GetBody()
+				if err != nil {
+					return nil, attempt, err
+				}
+				req.Body = body
+			}
+		}
+
+		if fileReq, _ := ctx.Value(fileRequestKey{}).(bool); !fileReq {
+			if err := c.Limiter.Wait(ctx); err != nil {
+				return nil, attempt, err
+			}
+		}
+		resp, err := httpClient.Do(req)
+		if attempt >= c.MaxRetries || !replayable || !shouldRetry(r, resp, err) {
+			return resp, attempt, err
+		}
+
+		wait := c.backoff(attempt)
+		if resp != nil {
+			if d, ok := rateLimitWait(resp); ok {
+				wait = min(d, c.maxDelay())
+			}
+			resp.Body.Close()
+		}
+
+		if counter != nil {
+			counter.n.Add(1)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, attempt, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// shouldRetry decides whether the outcome of a request is worth another attempt.
+// 429 responses were rejected before any work happened and are always retried; server
+// errors and transport failures are only retried for idempotent or explicitly safe requests.
+func shouldRetry(r *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		return isRetrySafe(r)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return isRetrySafe(r)
+	}
+	return false
+}
+
+// isRetrySafe reports whether resending r cannot duplicate work. PUT, PATCH and DELETE
+// calls carry X-Contentful-Version, so a repeat of a change an earlier attempt applied is
+// refused with a 409 conflict rather than applied twice; doVersioned tells such conflicts
+// from real ones.
+func isRetrySafe(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	safe, _ := r.Context().Value(safeRetryKey{}).(bool)
+	return safe
+}
+
+// rateLimitWait reads how long Contentful asks us to wait before the next request
+func rateLimitWait(resp *http.Response) (time.Duration, bool) {
+	for _, h := range []string{"X-Contentful-RateLimit-Reset", "Retry-After"} {
+		if v := strings.TrimSpace(resp.Header.Get(h)); v != "" {
+			if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+				return time.Duration(secs) * time.Second, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// backoff returns the jittered exponential delay before retry number attempt+1
+func (c *Client) backoff(attempt int) time.Duration {
+	base := c.RetryBaseDelay
+	if base <= 0 {
+		base = DefaultRetryBaseDelay
+	}
+	d := base << min(attempt, 20)
+	if maxDelay := c.maxDelay(); d <= 0 || d > maxDelay {
+		d = maxDelay
+	}
+	// Equal jitter: wait between half and the full delay
+	return d/2 + rand.N(d/2+1)
+}
+
+func (c *Client) maxDelay() time.Duration {
+	if c.RetryMaxDelay > 0 {
+		return c.RetryMaxDelay
+	}
+	return DefaultRetryMaxDelay
+}
+
+// versionedSys holds the sys properties version-locked changes move forward
+type versionedSys struct {
+	Version          int `json:"version"`
+	PublishedVersion int `json:"publishedVersion"`
+	ArchivedVersion  int `json:"archivedVersion"`
+}
+
+// doVersioned sends a version-locked change. When the change had to be retried and the
+// final attempt is refused with a 409 conflict, an earlier attempt may have been applied
+// with its response lost. The entity is then read again from getURL and, if applied finds
+// the change in place, that read is returned instead of the conflict, so callers decode
+// the entity's sys from it as from the change's own response.
+func (c *Client) doVersioned(r *http.Request, getURL string, applied func(sys versionedSys, body []byte) bool) (*http.Response, error) {
+	resp, retries, err := c.doCounted(r)
+	if err != nil || retries == 0 || resp.StatusCode != http.StatusConflict {
+		return resp, err
+	}
+
+	getReq, err := newRequest(r.Context(), "confirm "+stepOf(r.Context()), http.MethodGet, getURL, nil)
+	if err != nil {
+		return resp, nil
+	}
+	getReq.Header.Set("Accept", "application/vnd.contentful.management.v1+json")
+	c.authorize(getReq)
+	getResp, err := c.do(getReq)
+	if err != nil {
+		return resp, nil
+	}
+	body, err := io.ReadAll(getResp.Body)
+	getResp.Body.Close()
+	if err != nil || getResp.StatusCode < 200 || getResp.StatusCode >= 300 {
+		return resp, nil
+	}
+	var entity struct {
+		Sys versionedSys `json:"sys"`
+	}
+	if err := json.Unmarshal(body, &entity); err != nil || !applied(entity.Sys, body) {
+		return resp, nil
+	}
+	resp.Body.Close()
+	getResp.Body = io.NopCloser(bytes.NewReader(body))
+	return getResp, nil
+}
+
+// publishedAt reports whether an entity was published at version, with nothing changed since
+func publishedAt(version int) func(versionedSys, []byte) bool {
+	return func(sys versionedSys, _ []byte) bool {
+		return sys.PublishedVersion == version && sys.Version == version+1
+	}
+}
+
+// unpublishedAt reports whether an entity was unpublished at version, with nothing changed since
+func unpublishedAt(version int) func(versionedSys, []byte) bool {
+	return func(sys versionedSys, _ []byte) bool {
+		return sys.PublishedVersion == 0 && sys.Version == version+1
+	}
+}
+
+// archivedAt reports whether an entity was archived at version, with nothing changed since
+func archivedAt(version int) func(versionedSys, []byte) bool {
+	return func(sys versionedSys, _ []byte) bool {
+		return sys.ArchivedVersion == version && sys.Version == version+1
+	}
+}
+
+// unarchivedAt reports whether an entity was unarchived at version, with nothing changed since
+func unarchivedAt(version int) func(versionedSys, []byte) bool {
+	return func(sys versionedSys, _ []byte) bool {
+		return sys.ArchivedVersion == 0 && sys.Version == version+1
+	}
+}
+
+// updatedAt reports whether an entity was updated once at version, with every JSON pointer
+// in want holding what it maps to (an asset link's ID or a plain string)
+func updatedAt(version int, want map[string]string) func(versionedSys, []byte) bool {
+	return func(sys versionedSys, body []byte) bool {
+		if sys.Version != version+1 {
+			return false
+		}
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return false
+		}
+		for pointer, value := range want {
+			v, ok := lookupPointer(doc, pointer)
+			if !ok {
+				return false
+			}
+			if s, isString := v.(string); !(isString && s == value) && assetLinkID(v) != value {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// lookupPointer resolves a JSON pointer such as "/fields/body/en-US/content/3" in doc
+func lookupPointer(doc any, pointer string) (any, bool) {
+	v := doc
+	for _, seg := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,227 @@
+package contentful_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"contentful-asset-replacer/contentful"
+	"contentful-asset-replacer/contentful/contentfultest"
+)
+
+// newSpace starts a fake CMA holding the published asset "a1" and the published entry "e1"
+// linking it in downloadableFile, and returns a client for it that retries without delay
+func newSpace(t *testing.T) (*contentfultest.Server, *contentful.Client) {
+	t.Helper()
+	srv := contentfultest.NewServer("space", "master")
+	t.Cleanup(srv.Close)
+	srv.AddAsset(contentfultest.Asset{ID: "a1", Title: "Report", FileName: "report.pdf", ContentType: "application/pdf", Content: []byte("%PDF-1.4\n"), Published: true})
+	srv.AddAsset(contentfultest.Asset{ID: "a2", Title: "Report v2", FileName: "report.pdf", ContentType: "application/pdf", Content: []byte("%PDF-1.7\n"), Published: true})
+	srv.AddEntry(contentfultest.Entry{
+		ID:            "e1",
+		ContentTypeID: "document",
+		Fields:        map[string]any{"downloadableFile": map[string]any{"en-US": contentfultest.LinkAsset("a1")}},
+		Published:     true,
+	})
+	client := srv.Client()
+	client.RetryBaseDelay = time.Millisecond
+	client.RetryMaxDelay = 10 * time.Millisecond
+	return srv, client
+}
+
+// countRequests returns how many requests the fake served with the given method and path suffix
+func countRequests(srv *contentfultest.Server, method, pathSuffix string) int {
+	n := 0
+	for _, req := range srv.Requests() {
+		if strings.HasPrefix(req, method+" ") && strings.HasSuffix(req, pathSuffix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		fault       contentfultest.Fault
+		call        func(ctx context.Context, client *contentful.Client) (int, error)
+		wantStatus  int // zero for success
+		wantSent    int // requests matching the fault
+		wantRetries int
+	}{
+		{
+			name:  "rate-limited reads are retried after the reset delay",
+			fault: contentfultest.Fault{Method: http.MethodGet, PathSuffix: "/entries/e1", Status: http.StatusTooManyRequests, Count: 2, RateLimitReset: 30},
+			call: func(ctx context.Context, client *contentful.Client) (int, error) {
+				_, status, err := client.FetchEntry(ctx, contentful.FetchEntryRequest{EntryID: "e1"})
+				return status, err
+			},
+			wantSent:    3,
+			wantRetries: 2,
+		},
+		{
+			name:  "server errors on reads are retried",
+			fault: contentfultest.Fault{Method: http.MethodGet, PathSuffix: "/assets/a1", Status: http.StatusServiceUnavailable, Count: 2},
+			call: func(ctx context.Context, client *contentful.Client) (int, error) {
+				_, status, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: "a1"})
+				return status, err
+			},
+			wantSent:    3,
+			wantRetries: 2,
+		},
+		{
+			name:  "retries stop after MaxRetries",
+			fault: contentfultest.Fault{Method: http.MethodGet, PathSuffix: "/assets/a1", Status: http.StatusBadGateway, Count: 10},
+			call: func(ctx context.Context, client *contentful.Client) (int, error) {
+				_, status, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: "a1"})
+				return status, err
+			},
+			wantStatus:  http.StatusBadGateway,
+			wantSent:    contentful.DefaultMaxRetries + 1,
+			wantRetries: contentful.DefaultMaxRetries,
+		},
+		{
+			name:  "server errors on asset creation are not retried",
+			fault: contentfultest.Fault{Method: http.MethodPost, PathSuffix: "/environments/master/assets", Status: http.StatusInternalServerError, Count: 1},
+			call: func(ctx context.Context, client *contentful.Client) (int, error) {
+				_, status, err := client.CreateAsset(ctx, contentful.CreateAssetRequest{
+					Asset:   contentful.Asset{Title: "Report", FileName: "report.pdf", ContentType: "application/pdf"},
+					Uploads: map[string]contentful.UploadedFile{"en-US": {UploadID: "missing"}},
+				})
+				return status, err
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantSent:   1,
+		},
+		{
+			name:  "client errors are not retried",
+			fault: contentfultest.Fault{Method: http.MethodGet, PathSuffix: "/entries/e1", Status: http.StatusBadRequest, Count: 1},
+			call: func(ctx context.Context, client *contentful.Client) (int, error) {
+				_, status, err := client.FetchEntry(ctx, contentful.FetchEntryRequest{EntryID: "e1"})
+				return status, err
+			},
+			wantStatus: http.StatusBadRequest,
+			wantSent:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, client := newSpace(t)
+			srv.AddFault(tt.fault)
+			ctx, retries := contentful.WithRetryCounter(context.Background())
+
+			start := time.Now()
+			status, err := tt.call(ctx, client)
+			if tt.wantStatus == 0 && err != nil {
+				t.Fatalf("call failed: status %d: %v", status, err)
+			}
+			if tt.wantStatus != 0 && (err == nil || status != tt.wantStatus) {
+				t.Fatalf("call = status %d, %v; want status %d and an error", status, err, tt.wantStatus)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("call took %v; waits should be capped at RetryMaxDelay", elapsed)
+			}
+			if got := countRequests(srv, tt.fault.Method, tt.fault.PathSuffix); got != tt.wantSent {
+				t.Errorf("sent %d requests, want %d", got, tt.wantSent)
+			}
+			if got := retries.Count(); got != tt.wantRetries {
+				t.Errorf("retry counter = %d, want %d", got, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestVersionedRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		pathSuffix string
+		call       func(ctx context.Context, client *contentful.Client, entry contentful.Entry) error
+		check      func(t *testing.T, srv *contentfultest.Server)
+	}{
+		{
+			name:       "publish entry",
+			method:     http.MethodPut,
+			pathSuffix: "/entries/e1/published",
+			call: func(ctx context.Context, client *contentful.Client, entry contentful.Entry) error {
+				_, err := client.PublishEntry(ctx, contentful.PublishEntryRequest{EntryID: "e1", Version: entry.Version})
+				return err
+			},
+			check: func(t *testing.T, srv *contentfultest.Server) {
+				if e, _ := srv.Entry("e1"); e.PublishedVersion != 2 || e.Version != 3 {
+					t.Errorf("e1 at version %d, published version %d; want it published once more", e.Version, e.PublishedVersion)
+				}
+			},
+		},
+		{
+			name:       "patch entry links",
+			method:     http.MethodPatch,
+			pathSuffix: "/entries/e1",
+			call: func(ctx context.Context, client *contentful.Client, entry contentful.Entry) error {
+				_, _, err := client.PatchEntryAssetLink(ctx, contentful.PatchEntryAssetLinkRequest{EntryID: "e1", Links: entry.AssetLinks, NewAssetID: "a2", Version: entry.Version})
+				return err
+			},
+			check: func(t *testing.T, srv *contentfultest.Server) {
+				e, _ := srv.Entry("e1")
+				link := e.Fields["downloadableFile"].(map[string]any)["en-US"].(map[string]any)["sys"].(map[string]any)
+				if link["id"] != "a2" || e.Version != 3 {
+					t.Errorf("e1 links %v at version %d; want a2 patched once", link["id"], e.Version)
+				}
+			},
+		},
+		{
+			name:       "unpublish asset",
+			method:     http.MethodDelete,
+			pathSuffix: "/assets/a1/published",
+			call: func(ctx context.Context, client *contentful.Client, _ contentful.Entry) error {
+				asset, _, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: "a1"})
+				if err != nil {
+					return err
+				}
+				_, _, err = client.UnpublishAsset(ctx, contentful.UnpublishAssetRequest{AssetID: "a1", Version: asset.Version})
+				return err
+			},
+			check: func(t *testing.T, srv *contentfultest.Server) {
+				if a, _ := srv.Asset("a1"); a.Published || a.Version != 4 {
+					t.Errorf("a1 at version %d, published %v; want it unpublished once", a.Version, a.Published)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" applied before its response was lost", func(t *testing.T) {
+			srv, client := newSpace(t)
+			ctx := context.Background()
+			entry, _, err := client.FetchEntry(ctx, contentful.FetchEntryRequest{EntryID: "e1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv.AddFault(contentfultest.Fault{PathSuffix: tt.pathSuffix, Method: tt.method, Status: http.StatusServiceUnavailable, Count: 1, Applied: true})
+
+			if err := tt.call(ctx, client, entry); err != nil {
+				t.Fatalf("retried change failed: %v", err)
+			}
+			tt.check(t, srv)
+		})
+
+		t.Run(tt.name+" conflicting with another change", func(t *testing.T) {
+			srv, client := newSpace(t)
+			ctx := context.Background()
+			entry, _, err := client.FetchEntry(ctx, contentful.FetchEntryRequest{EntryID: "e1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv.AddFault(contentfultest.Fault{PathSuffix: tt.pathSuffix, Method: tt.method, Status: http.StatusServiceUnavailable, Count: 1})
+			srv.AddFault(contentfultest.Fault{PathSuffix: tt.pathSuffix, Method: tt.method, Status: http.StatusConflict, Count: 1})
+
+			err = tt.call(ctx, client, entry)
+			if contentful.ErrorCategory(err) != contentful.ErrorVersionMismatch {
+				t.Fatalf("call = %v, want a version conflict", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package contentful
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// StreamAssetFileRequest contains all the parameters needed to stream an asset's file into an upload
+type StreamAssetFileRequest struct {
+	Asset    Asset  // the file at Asset.FileURL is streamed
+	SpoolDir string // when set, the file is also spooled to a temporary file here so a failed upload can be retried
+}
+
+// UploadedFile is a file sent to the Upload API, with the size and SHA-256 of its bytes
+type UploadedFile struct {
+	UploadID string
+	FileName string // basename of the source URL, the fallback file name of the asset
+	Size     int64
+	SHA256   string // hex-encoded
+	Head     []byte // the first SniffLength bytes, for content type detection
+}
+
+// StreamAssetFile pipes the asset's file from its URL straight into an upload, without
+// staging it on disk, and returns the upload for CreateAssetRequest.Uploads or
+// ReplaceAssetFileRequest.Uploads. The download is checked like DownloadAssetFile once the
+// upload completes. Without a SpoolDir the upload cannot be replayed and is sent once.
+func (c *Client) StreamAssetFile(ctx context.Context, req StreamAssetFileRequest) (UploadedFile, int, error) {
+	// Extract values from the request struct
+	asset := req.Asset
+	spoolDir := req.SpoolDir
+
+	if strings.TrimSpace(asset.FileURL) == "" {
+		return UploadedFile{}, 0, fmt.Errorf("empty asset file URL")
+	}
+
+	dlReq, err := newRequest(ctx, "download file", http.MethodGet, ensureHTTPS(asset.FileURL), nil)
+	if err != nil {
+		return UploadedFile{}, 0, err
+	}
+	dlResp, err := c.doFile(dlReq)
+	if err != nil {
+		return UploadedFile{}, 0, err
+	}
+	defer dlResp.Body.Close()
+	if dlResp.StatusCode < 200 || dlResp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(dlResp.Body, 2048))
+		return UploadedFile{}, dlResp.StatusCode, fmt.Errorf("download status %d: %s", dlResp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	src := &teeSource{r: dlResp.Body, hash: sha256.New()}
+	if spoolDir != "" {
+		if err := os.MkdirAll(spoolDir, 0o755); err != nil {
+			return UploadedFile{}, 0, err
+		}
+		if src.spool, err = os.CreateTemp(spoolDir, "spool-*"); err != nil {
+			return UploadedFile{}, 0, err
+		}
+		defer func() {
+			src.spool.Close()
+			os.Remove(src.spool.Name())
+		}()
+	}
+
+	upReq, err := newRequest(ctx, "upload file", http.MethodPost, c.uploadURL("/uploads"), io.NopCloser(src))
+	if err != nil {
+		return UploadedFile{}, 0, err
+	}
+	upReq.ContentLength = dlResp.ContentLength
+	if src.spool != nil {
+		// Finish the download into the spool and send that instead; a repeated upload only
+		// leaves an unused upload behind
+		upReq.GetBody = src.replay
+		upReq = markRetryable(upReq)
+	}
+	upReq.Header.Set("Content-Type", "application/octet-stream")
+	c.authorize(upReq)
+	upResp, err := c.do(upReq)
+	if err != nil {
+		return UploadedFile{}, 0, err
+	}
+	defer upResp.Body.Close()
+	if upResp.StatusCode < 200 || upResp.StatusCode >= 300 {
+		return UploadedFile{}, upResp.StatusCode, newAPIError("upload", upResp)
+	}
+
+	// The upload must have carried the whole download
+	n, sum, err := src.finish()
+	if err != nil {
+		return UploadedFile{}, dlResp.StatusCode, err
+	}
+	if err := checkDownloadSize(asset, dlResp, n); err != nil {
+		return UploadedFile{}, dlResp.StatusCode, err
+	}
+
+	var uploadRes struct {
+		Sys struct {
+			ID string `json:"id"`
+		} `json:"sys"`
+	}
+	if err := json.NewDecoder(upResp.Body).Decode(&uploadRes); err != nil {
+		return UploadedFile{}, upResp.StatusCode, err
+	}
+
+	fileName := ""
+	if parsed, err := url.Parse(ensureHTTPS(asset.FileURL)); err == nil {
+		if base := path.Base(parsed.Path); base != "." && base != "/" {
+			fileName = base
+		}
+	}
+	return UploadedFile{UploadID: uploadRes.Sys.ID, FileName: fileName, Size: n, SHA256: sum, Head: src.head}, upResp.StatusCode, nil
+}
+
+// teeSource reads a download once, hashing it and copying it to the optional spool. Reads
+// are serialized because the transport may still be reading a failed attempt's body while
+// the next attempt replays the spool.
+type teeSource struct {
+	mu       sync.Mutex
+	r        io.Reader
+	hash     hash.Hash
+	spool    *os.File
+	head     []byte // the first SniffLength bytes read
+	n        int64
+	err      error // first read error other than io.EOF
+	done     bool
+	replayed bool // the upload was retried from the spool
+}
+
+// Read reads the download, hashing and spooling what it returns
+func (t *teeSource) Read(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.read(p)
+}
+
+// read reads the download with t.mu held
+func (t *teeSource) read(p []byte) (int, error) {
+	if t.done {
+		return 0, io.EOF
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if len(t.head) < SniffLength {
+			t.head = append(t.head, p[:min(n, SniffLength-len(t.head))]...)
+		}
+		t.n += int64(n)
+		t.hash.Write(p[:n])
+		if t.spool != nil {
+			if _, werr := t.spool.Write(p[:n]); werr != nil {
+				t.err = werr
+				return n, werr
+			}
+		}
+	}
+	if err == io.EOF {
+		t.done = true
+	} else if err != nil && t.err == nil {
+		t.err = err
+	}
+	return n, err
+}
+
+// drain reads the rest of the download with t.mu held
+func (t *teeSource) drain() error {
+	buf := make([]byte, 32*1024)
+	for !t.done {
+		if _, err := t.read(buf); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// replay finishes the download into the spool and returns the spooled file from its start
+func (t *teeSource) replay() (io.ReadCloser, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.drain(); err != nil {
+		return nil, err
+	}
+	t.replayed = true
+	return io.NopCloser(io.NewSectionReader(t.spool, 0, t.n)), nil
+}
+
+// finish returns the size and hex-encoded SHA-256 of the whole download, reporting a
+// download that failed or was longer than what the upload sent
+func (t *teeSource) finish() (int64, string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sent := t.n
+	if err := t.drain(); err != nil {
+		return 0, "", fmt.Errorf("download: %w", err)
+	}
+	if t.err != nil {
+		return 0, "", fmt.Errorf("download: %w", t.err)
+	}
+	if !t.replayed && t.n != sent {
+		return 0, "", fmt.Errorf("download size mismatch: uploaded %d of %d bytes", sent, t.n)
+	}
+	return t.n, hex.EncodeToString(t.hash.Sum(nil)), nil
+}
@@ -0,0 +1,66 @@
+package contentful_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"contentful-asset-replacer/contentful"
+	"contentful-asset-replacer/contentful/contentfultest"
+)
+
+func TestStreamAssetFileRetry(t *testing.T) {
+	// Large enough that the failed attempt has not sent the whole file when it is answered
+	content := bytes.Repeat([]byte("%PDF-1.4 streamed\n"), 64<<10)
+	sum := sha256.Sum256(content)
+
+	tests := []struct {
+		name       string
+		spool      bool
+		wantStatus int // zero for success
+		wantSent   int // upload requests
+	}{
+		{name: "a spooled upload is replayed from the spool", spool: true, wantSent: 2},
+		{name: "an upload without a spool is sent once", wantStatus: http.StatusServiceUnavailable, wantSent: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, client := newSpace(t)
+			srv.AddAsset(contentfultest.Asset{ID: "big", Title: "Big", FileName: "big.pdf", ContentType: "application/pdf", Content: content})
+			srv.AddFault(contentfultest.Fault{Method: http.MethodPost, PathSuffix: "/uploads", Status: http.StatusServiceUnavailable, Count: 1})
+			ctx := context.Background()
+			asset, _, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: "big"})
+			if err != nil {
+				t.Fatalf("fetch asset: %v", err)
+			}
+
+			req := contentful.StreamAssetFileRequest{Asset: asset}
+			if tt.spool {
+				req.SpoolDir = t.TempDir()
+			}
+			uploaded, status, err := client.StreamAssetFile(ctx, req)
+			if got := countRequests(srv, http.MethodPost, "/uploads"); got != tt.wantSent {
+				t.Errorf("sent %d uploads, want %d", got, tt.wantSent)
+			}
+			if tt.wantStatus != 0 {
+				if err == nil || status != tt.wantStatus {
+					t.Errorf("stream = status %d, %v; want status %d and an error", status, err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stream: status %d: %v", status, err)
+			}
+			if uploaded.Size != int64(len(content)) || uploaded.SHA256 != hex.EncodeToString(sum[:]) {
+				t.Errorf("uploaded %d bytes with sha256 %s, want %d bytes with %x", uploaded.Size, uploaded.SHA256, len(content), sum)
+			}
+			if got, ok := srv.Upload(uploaded.UploadID); !ok || !bytes.Equal(got, content) {
+				t.Errorf("upload %s holds %d bytes, want the %d bytes of the file", uploaded.UploadID, len(got), len(content))
+			}
+		})
+	}
+}
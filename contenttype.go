@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// contentTypeUnknown is what detection falls back to when neither the bytes nor the file
+// name tell the type, and the label many legacy assets were uploaded with
+const contentTypeUnknown = "application/octet-stream"
+
+// Results of auditing a file's content type
+const (
+	auditMatch        = "ok"
+	auditMismatch     = "mismatch"
+	auditUndetermined = "undetermined" // the file's type could not be detected
+)
+
+// extensionTypes maps file extensions to the content types detection trusts them for, where
+// the bytes alone are ambiguous (e.g. Office documents are ZIP archives) or the platform's
+// MIME table may not know them
+var extensionTypes = map[string]string{
+	".csv":  "text/csv",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".epub": "application/epub+zip",
+	".heic": "image/heic",
+	".json": "application/json",
+	".md":   "text/markdown",
+	".mov":  "video/quicktime",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".rtf":  "application/rtf",
+	".svg":  "image/svg+xml",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".txt":  "text/plain",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".xml":  "application/xml",
+}
+
+// detectContentType returns the content type of a file from its first bytes, refined by
+// its name's extension where the bytes only tell the container (ZIP, XML, plain text) or
+// nothing at all. Parameters such as charset are dropped.
+func detectContentType(head []byte, fileName string) string {
+	sniffed := baseContentType(http.DetectContentType(head))
+	ext := strings.ToLower(filepath.Ext(fileName))
+	byExt := extensionTypes[ext]
+	if byExt == "" && ext != "" {
+		byExt = baseContentType(mime.TypeByExtension(ext))
+	}
+	if byExt != "" && refines(sniffed, byExt) {
+		return byExt
+	}
+	return sniffed
+}
+
+// refines reports whether a type taken from a file's extension is a more specific reading
+// of the sniffed type, rather than contradicting it
+func refines(sniffed, byExt string) bool {
+	switch sniffed {
+	case contentTypeUnknown:
+		return true
+	case "text/plain":
+		return strings.HasPrefix(byExt, "text/") || byExt == "application/json" || byExt == "application/rtf" || strings.HasSuffix(byExt, "+xml") || strings.HasSuffix(byExt, "/xml")
+	case "text/xml":
+		return strings.HasSuffix(byExt, "+xml") || strings.HasSuffix(byExt, "/xml")
+	case "application/zip":
+		return strings.HasPrefix(byExt, "application/vnd.") || strings.HasSuffix(byExt, "+zip")
+	}
+	return false
+}
+
+// baseContentType returns a content type without its parameters, in lower case
+func baseContentType(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// auditContentType compares a file's labelled content type with the detected one
+func auditContentType(labelled, detected string) string {
+	if baseContentType(labelled) == detected {
+		return auditMatch
+	}
+	if detected == contentTypeUnknown {
+		return auditUndetermined
+	}
+	return auditMismatch
+}
+
+// fileHead reads the first contentful.SniffLength bytes of a local file
+func fileHead(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, contentful.SniffLength))
+}
+
+// processContentTypeAudit checks the file of each asset the entry's selected links point
+// at, in every locale, and writes one line per file with the content type it is labelled
+// with and the one its bytes show. Only the start of each file is downloaded.
+func processContentTypeAudit(ctx context.Context, cfg runConfig, job rowJob, successW, failedW *rowWriter) {
+	client, sel := cfg.client, cfg.sel
+	entryID, rowNum := job.entryID, job.rowNum
+	entry, entryStatus, err := client.FetchEntry(ctx, sel.fetchEntryReq(entryID))
+	if err != nil {
+		warnf("row %d: fetch entry %s -> status %d: %v", rowNum, entryID, entryStatus, err)
+		_ = failedW.Write([]string{entryID, "", fmt.Sprintf("fetch entry: %v", err)})
+		return
+	}
+	links := sel.wantedLinks(entry)
+	if len(links) == 0 {
+		warnf("row %d: entry %s has no asset link in %s", rowNum, entryID, strings.Join(sel.fields, ", "))
+		return
+	}
+
+	var assetIDs []string
+	for _, link := range links {
+		if !slices.Contains(assetIDs, link.AssetID) {
+			assetIDs = append(assetIDs, link.AssetID)
+		}
+	}
+	for _, assetID := range assetIDs {
+		asset, assetStatus, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: assetID})
+		if err != nil {
+			warnf("row %d: fetch asset %s -> status %d: %v", rowNum, assetID, assetStatus, err)
+			_ = failedW.Write([]string{entryID, assetID, fmt.Sprintf("fetch asset: %v", err)})
+			continue
+		}
+		for _, locale := range asset.FileLocales() {
+			file := asset.InLocale(locale)
+			head, status, err := client.SniffAssetFile(ctx, file)
+			if err != nil {
+				warnf("row %d: read %s file of asset %s -> status %d: %v", rowNum, locale, assetID, status, err)
+				_ = failedW.Write([]string{entryID, assetID, fmt.Sprintf("read %s file: %v", locale, err)})
+				continue
+			}
+			detected := detectContentType(head, file.FileName)
+			result := auditContentType(file.ContentType, detected)
+			if result == auditMismatch {
+				warnf("row %d: %s file %q of asset %s is labelled %s but is %s", rowNum, locale, file.FileName, assetID, file.ContentType, detected)
+			}
+			_ = successW.Write([]string{entryID, assetID, locale, file.FileName, file.ContentType, detected, result})
+		}
+	}
+}
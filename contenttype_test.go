@@ -0,0 +1,106 @@
+package main
+
+import "testing"
+
+const docxType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+func TestDetectContentType(t *testing.T) {
+	var (
+		pngHead = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+		zipHead = []byte("PK\x03\x04\x14\x00\x06\x00")
+		binary  = []byte{0x00, 0x00, 0x00, 0x18, 0x01, 0xfe, 0x02, 0xff}
+	)
+
+	tests := []struct {
+		name     string
+		head     []byte
+		fileName string
+		want     string
+	}{
+		{name: "bytes alone", head: pngHead, fileName: "logo.png", want: "image/png"},
+		{name: "bytes over a contradicting extension", head: pngHead, fileName: "logo.jpg", want: "image/png"},
+		{name: "upper-case extension", head: []byte("%PDF-1.7\n"), fileName: "REPORT.PDF", want: "application/pdf"},
+		{name: "Office document in a ZIP", head: zipHead, fileName: "letter.docx", want: docxType},
+		{name: "EPUB in a ZIP", head: zipHead, fileName: "book.epub", want: "application/epub+zip"},
+		{name: "ZIP named as an image", head: zipHead, fileName: "photo.png", want: "application/zip"},
+		{name: "plain text read as CSV", head: []byte("id,title\n1,Report\n"), fileName: "rows.csv", want: "text/csv"},
+		{name: "plain text read as JSON", head: []byte(`{"id": 1}`), fileName: "data.json", want: "application/json"},
+		{name: "SVG markup", head: []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), fileName: "icon.svg", want: "image/svg+xml"},
+		{name: "SVG with an XML declaration", head: []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"/>`), fileName: "icon.svg", want: "image/svg+xml"},
+		{name: "HTML named as text", head: []byte("<!DOCTYPE html><html></html>"), fileName: "notes.txt", want: "text/html"},
+		{name: "unknown bytes named by extension", head: binary, fileName: "photo.heic", want: "image/heic"},
+		{name: "unknown bytes without an extension", head: binary, fileName: "download", want: contentTypeUnknown},
+		{name: "empty file", head: nil, fileName: "empty.txt", want: "text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectContentType(tt.head, tt.fileName); got != tt.want {
+				t.Errorf("detectContentType(%q) = %q, want %q", tt.fileName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefines(t *testing.T) {
+	tests := []struct {
+		sniffed, byExt string
+		want           bool
+	}{
+		{sniffed: contentTypeUnknown, byExt: "image/heic", want: true},
+		{sniffed: "text/plain", byExt: "text/markdown", want: true},
+		{sniffed: "text/plain", byExt: "application/rtf", want: true},
+		{sniffed: "text/plain", byExt: "image/svg+xml", want: true},
+		{sniffed: "text/plain", byExt: "application/pdf", want: false},
+		{sniffed: "text/xml", byExt: "application/xml", want: true},
+		{sniffed: "text/xml", byExt: "text/csv", want: false},
+		{sniffed: "application/zip", byExt: docxType, want: true},
+		{sniffed: "application/zip", byExt: "image/png", want: false},
+		{sniffed: "image/png", byExt: "image/jpeg", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := refines(tt.sniffed, tt.byExt); got != tt.want {
+			t.Errorf("refines(%q, %q) = %v, want %v", tt.sniffed, tt.byExt, got, tt.want)
+		}
+	}
+}
+
+func TestBaseContentType(t *testing.T) {
+	tests := []struct {
+		contentType, want string
+	}{
+		{contentType: "text/plain; charset=utf-8", want: "text/plain"},
+		{contentType: "Application/PDF", want: "application/pdf"},
+		{contentType: " image/png ", want: "image/png"},
+		{contentType: "not a type;;", want: "not a type;;"},
+		{contentType: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := baseContentType(tt.contentType); got != tt.want {
+			t.Errorf("baseContentType(%q) = %q, want %q", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestAuditContentType(t *testing.T) {
+	tests := []struct {
+		labelled, detected, want string
+	}{
+		{labelled: "application/pdf", detected: "application/pdf", want: auditMatch},
+		{labelled: "text/csv; charset=utf-8", detected: "text/csv", want: auditMatch},
+		{labelled: "Image/PNG", detected: "image/png", want: auditMatch},
+		{labelled: contentTypeUnknown, detected: "application/pdf", want: auditMismatch},
+		{labelled: "image/jpeg", detected: "image/png", want: auditMismatch},
+		{labelled: "", detected: "image/png", want: auditMismatch},
+		{labelled: "image/heic", detected: contentTypeUnknown, want: auditUndetermined},
+		{labelled: contentTypeUnknown, detected: contentTypeUnknown, want: auditMatch},
+	}
+
+	for _, tt := range tests {
+		if got := auditContentType(tt.labelled, tt.detected); got != tt.want {
+			t.Errorf("auditContentType(%q, %q) = %q, want %q", tt.labelled, tt.detected, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// Update-mode strategies selected with -strategy
+const (
+	strategyCreate  = "create"   // create a new asset, retire the old one and relink the entry
+	strategyInPlace = "in-place" // put the new files onto the existing asset, keeping its ID
+)
+
+// processAssetInPlace replaces the asset's files without changing its ID, so every entry
+// linking it keeps working. The entry itself is not modified. The new files are verified
+// before a published asset is republished, so a bad file never goes live; a draft stays a
+// draft. Each asset is replaced at most once per run, since every entry linking it sees the
+// new files: later rows for it succeed without replacing it again. Each completed step is
+// recorded in the journal; when resuming, steps the journal already holds are skipped.
+func processAssetInPlace(ctx context.Context, cfg runConfig, job rowJob, assetID string, asset contentful.Asset, successW, failedW *rowWriter) {
+	client, jr := cfg.client, cfg.jr
+	entryID, rowNum, repl := job.entryID, job.rowNum, job.repl
+
+	progress, resuming := jr.state(entryID, assetID)
+	if progress.Step < stepFileReplaced && jr.replacedInRun(assetID) {
+		warnf("row %d: entry %s asset %s was already replaced in place for another row", rowNum, entryID, assetID)
+		_ = successW.Write([]string{entryID, assetID, assetID, "false", strconv.FormatBool(asset.PublishedVersion != 0)})
+		jr.record(journalRecord{EntryID: entryID, Step: stepValidated, OldAssetID: assetID})
+		return
+	}
+	if !resuming {
+		jr.record(journalRecord{EntryID: entryID, Step: stepStarted, OldAssetID: assetID})
+	}
+
+	// fail records a failed step in failed.csv and the journal
+	fail := func(step journalStep, newAssetID, msg string) {
+		_ = failedW.Write([]string{entryID, assetID, newAssetID, msg})
+		jr.record(journalRecord{EntryID: entryID, Step: step, OldAssetID: assetID, NewAssetID: newAssetID, Error: msg})
+	}
+
+	if progress.Step >= stepAssetCreated {
+		warnf("row %d: entry %s asset %s was started with -strategy %s", rowNum, entryID, assetID, strategyCreate)
+		_ = failedW.Write([]string{entryID, assetID, progress.NewAssetID, fmt.Sprintf("replacement was started with -strategy %s; resume it with the same strategy", strategyCreate)})
+		return
+	}
+
+	if progress.Step < stepFileReplaced {
+		if asset.ArchivedAt != "" {
+			warnf("row %d: asset %s is archived", rowNum, assetID)
+			fail(stepFileReplaced, "", "asset is archived; unarchive it before replacing its file in place")
+			return
+		}
+		files, ok := downloadAssetFiles(ctx, cfg, job, assetID, asset, progress, fail)
+		if !ok {
+			return
+		}
+
+		// Put the files onto the asset with its current version and process them, then verify
+		// them before republishing the asset if it was published
+		published := asset.PublishedVersion != 0
+		replaceReq := contentful.ReplaceAssetFileRequest{
+			Asset:             files.applyTo(repl.apply(asset)),
+			Locale:            asset.Locale,
+			FilePaths:         files.paths,
+			Uploads:           files.uploads,
+			OriginalCreatedAt: asset.CreatedAt,
+		}
+		version, replaceStatus, err := client.ReplaceAssetFile(ctx, replaceReq)
+		if err != nil {
+			warnf("row %d: replace file of asset %s -> status %d: %v", rowNum, assetID, replaceStatus, err)
+			fail(stepFileReplaced, "", fmt.Sprintf("replace asset file: %v", err))
+			return
+		}
+		if verifyStatus, err := verifyAssetFiles(ctx, client, assetID, asset.Locale, files.digests); err != nil {
+			warnf("row %d: verify asset %s -> status %d: %v", rowNum, assetID, verifyStatus, err)
+			msg := fmt.Sprintf("verify replaced file: %v; the asset's draft now holds the replaced file", err)
+			if published {
+				msg += ", its published version is unchanged"
+			}
+			fail(stepFileReplaced, "", msg)
+			return
+		}
+		if published {
+			if _, pubStatus, err := client.PublishAsset(ctx, contentful.PublishAssetRequest{AssetID: assetID, Version: version}); err != nil {
+				warnf("row %d: publish asset %s -> status %d: %v", rowNum, assetID, pubStatus, err)
+				fail(stepFileReplaced, "", fmt.Sprintf("publish asset: %v", err))
+				return
+			}
+		}
+
+		// Validate against the asset as read before the replacement: every replaced locale
+		// serves a new file URL and a published asset has a newer published version
+		replaced, fetchStatus, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: assetID, Locale: asset.Locale})
+		if err != nil {
+			warnf("row %d: validate asset %s -> status %d: %v", rowNum, assetID, fetchStatus, err)
+			fail(stepFileReplaced, "", fmt.Sprintf("validation fetch asset: %v", err))
+			return
+		}
+		if problems := inPlaceChanges(asset, replaced, slices.Sorted(maps.Keys(files.digests))); len(problems) > 0 {
+			warnf("row %d: validation failed for asset %s - %s", rowNum, assetID, strings.Join(problems, "; "))
+			fail(stepFileReplaced, "", "validation failed: "+strings.Join(problems, "; "))
+			return
+		}
+		jr.record(journalRecord{EntryID: entryID, Step: stepFileReplaced, OldAssetID: assetID})
+	}
+
+	_ = successW.Write([]string{entryID, assetID, assetID, "false", strconv.FormatBool(asset.PublishedVersion != 0)})
+	jr.record(journalRecord{EntryID: entryID, Step: stepValidated, OldAssetID: assetID})
+	cfg.staging.cleanup(assetID, rowNum, repl)
+}
+
+// inPlaceChanges describes how an asset replaced in place falls short of the asset read
+// before the replacement: a locale still serving its old file URL, or a published asset
+// whose published version did not move on
+func inPlaceChanges(before, after contentful.Asset, locales []string) []string {
+	var problems []string
+	for _, locale := range locales {
+		was, now := before.Files[locale].URL, after.Files[locale].URL
+		if now == "" {
+			problems = append(problems, fmt.Sprintf("%s file has no URL", locale))
+		} else if now == was {
+			problems = append(problems, fmt.Sprintf("%s file URL is unchanged (%s)", locale, now))
+		}
+	}
+	if before.PublishedVersion != 0 && after.PublishedVersion <= before.PublishedVersion {
+		problems = append(problems, fmt.Sprintf("asset was not republished (published version %d, was %d)", after.PublishedVersion, before.PublishedVersion))
+	}
+	if before.PublishedVersion == 0 && after.PublishedVersion != 0 {
+		problems = append(problems, "draft asset was published")
+	}
+	return problems
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// journalStep is a completed stage of the update workflow for one entry, in workflow order
+type journalStep int
+
+const (
+	stepStarted journalStep = iota // resets an entry's progress when it is processed from scratch
+	stepDownloaded
+	stepFileReplaced   // -strategy in-place: the asset carries the new files and is republished
+	stepAssetCreated   // the new asset exists as a draft; its ID is known
+	stepAssetPublished // the new asset is processed, published and serves the uploaded files
+	stepOldUnpublished
+	stepOldArchived
+	stepEntryPatched
+	stepEntryPublished
+	stepValidated
+)
+
+var journalStepNames = map[journalStep]string{
+	stepStarted:        "started",
+	stepDownloaded:     "downloaded",
+	stepFileReplaced:   "file_replaced",
+	stepAssetCreated:   "asset_created",
+	stepAssetPublished: "asset_published",
+	stepOldUnpublished: "old_unpublished",
+	stepOldArchived:    "old_archived",
+	stepEntryPatched:   "entry_patched",
+	stepEntryPublished: "entry_published",
+	stepValidated:      "validated",
+}
+
+func (s journalStep) String() string {
+	if name, ok := journalStepNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("step(%d)", int(s))
+}
+
+func (s journalStep) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *journalStep) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return err
+	}
+	for step, n := range journalStepNames {
+		if n == name {
+			*s = step
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown journal step %q", name)
+}
+
+// journalRecord is one line of the journal file. A record with Error set notes a failed
+// attempt and does not advance the replacement's step.
+type journalRecord struct {
+	Time          time.Time         `json:"time"`
+	EntryID       string            `json:"entry_id"`
+	Step          journalStep       `json:"step"`
+	OldAssetID    string            `json:"old_asset_id,omitempty"`
+	OldAssetDraft bool              `json:"old_asset_draft,omitempty"` // started: the old asset was not published
+	NewAssetID    string            `json:"new_asset_id,omitempty"`
+	SavedPaths    map[string]string `json:"saved_paths,omitempty"` // downloaded file per locale
+	Digests       map[string]string `json:"sha256,omitempty"`      // SHA-256 of each uploaded file per locale
+	Error         string            `json:"error,omitempty"`
+}
+
+// journalKey identifies one replacement: an entry's links to one old asset
+type journalKey struct {
+	EntryID    string
+	OldAssetID string
+}
+
+// journalState is the accumulated progress of one replacement
+type journalState struct {
+	Step          journalStep
+	OldAssetID    string
+	OldAssetDraft bool // the old asset was not published when the replacement started
+	NewAssetID    string
+	SavedPaths    map[string]string // downloaded file per locale
+	Digests       map[string]string // SHA-256 of each uploaded file per locale
+}
+
+// apply folds a journal record into the state
+func (st *journalState) apply(rec journalRecord) {
+	if rec.Step == stepStarted && rec.Error == "" {
+		*st = journalState{OldAssetID: rec.OldAssetID, OldAssetDraft: rec.OldAssetDraft}
+		return
+	}
+	if rec.OldAssetID != "" {
+		st.OldAssetID = rec.OldAssetID
+	}
+	if rec.NewAssetID != "" {
+		st.NewAssetID = rec.NewAssetID
+	}
+	if len(rec.SavedPaths) > 0 {
+		st.SavedPaths = rec.SavedPaths
+	}
+	if len(rec.Digests) > 0 {
+		st.Digests = rec.Digests
+	}
+	if rec.Error == "" && rec.Step > st.Step {
+		st.Step = rec.Step
+	}
+}
+
+// journal is an append-only NDJSON log of update workflow progress per replacement, so an
+// interrupted run can continue each replacement from its last completed step
+type journal struct {
+	mu       sync.Mutex
+	f        *os.File
+	resume   bool
+	states   map[journalKey]journalState
+	created  map[string]bool // assets created by replacements recorded in this run
+	replaced map[string]bool // assets given new files in place by replacements recorded in this run
+}
+
+// openJournal loads any existing progress from path and opens it for appending
+func openJournal(path string, resume bool) (*journal, error) {
+	states, err := loadJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{f: f, resume: resume, states: states}, nil
+}
+
+// loadJournal replays the journal file into per-replacement states. A missing file is empty.
+func loadJournal(path string) (map[journalKey]journalState, error) {
+	states := make(map[journalKey]journalState)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A torn final line is expected if the process died mid-write
+			warnf("journal %s line %d: %v", path, lineNum, err)
+			continue
+		}
+		applyRecord(states, rec)
+	}
+	return states, scanner.Err()
+}
+
+// applyRecord folds rec into the state of its replacement
+func applyRecord(states map[journalKey]journalState, rec journalRecord) {
+	key := journalKey{EntryID: rec.EntryID, OldAssetID: rec.OldAssetID}
+	st := states[key]
+	st.apply(rec)
+	states[key] = st
+}
+
+// Close closes the journal file
+func (j *journal) Close() error {
+	if j == nil || j.f == nil {
+		return nil
+	}
+	return j.f.Close()
+}
+
+// state returns the recorded progress of replacing oldAssetID in entryID when resuming,
+// and false otherwise
+func (j *journal) state(entryID, oldAssetID string) (journalState, bool) {
+	if j == nil || !j.resume {
+		return journalState{}, false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st, ok := j.states[journalKey{EntryID: entryID, OldAssetID: oldAssetID}]
+	return st, ok && st.Step > stepStarted
+}
+
+// entryStates returns the recorded progress of every replacement in entryID when resuming,
+// ordered by old asset ID
+func (j *journal) entryStates(entryID string) []journalState {
+	if j == nil || !j.resume {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var states []journalState
+	for key, st := range j.states {
+		if key.EntryID == entryID && st.Step > stepStarted {
+			states = append(states, st)
+		}
+	}
+	sort.Slice(states, func(a, b int) bool { return states[a].OldAssetID < states[b].OldAssetID })
+	return states
+}
+
+// hasProgress reports whether the journal holds unfinished progress for replacing oldAssetID in entryID
+func (j *journal) hasProgress(entryID, oldAssetID string) (journalStep, bool) {
+	if j == nil {
+		return stepStarted, false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st := j.states[journalKey{EntryID: entryID, OldAssetID: oldAssetID}]
+	return st.Step, st.Step > stepStarted && st.Step < stepValidated
+}
+
+// record appends a record and syncs it to disk before the workflow moves on
+func (j *journal) record(rec journalRecord) {
+	if j == nil {
+		return
+	}
+	rec.Time = time.Now().UTC()
+	line, err := json.Marshal(rec)
+	if err != nil {
+		warnf("journal %s: %v", rec.EntryID, err)
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.f.Write(append(line, '\n')); err != nil {
+		warnf("journal %s: write: %v", rec.EntryID, err)
+		return
+	}
+	if err := j.f.Sync(); err != nil {
+		warnf("journal %s: sync: %v", rec.EntryID, err)
+	}
+
+	applyRecord(j.states, rec)
+	if rec.Step == stepAssetCreated && rec.Error == "" && rec.NewAssetID != "" {
+		if j.created == nil {
+			j.created = make(map[string]bool)
+		}
+		j.created[rec.NewAssetID] = true
+	}
+	if rec.Step == stepFileReplaced && rec.Error == "" {
+		if j.replaced == nil {
+			j.replaced = make(map[string]bool)
+		}
+		j.replaced[rec.OldAssetID] = true
+	}
+}
+
+// createdInRun reports whether a replacement recorded in this run created assetID
+func (j *journal) createdInRun(assetID string) bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.created[assetID]
+}
+
+// replacedInRun reports whether a replacement recorded in this run put new files onto assetID in place
+func (j *journal) replacedInRun(assetID string) bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.replaced[assetID]
+}
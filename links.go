@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// stringList is a repeatable string flag. Each use appends; a comma-separated value adds several.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// linkSelector names the entry fields and locales whose asset links are read and replaced
+type linkSelector struct {
+	fields  []string
+	locales []string
+	index   int             // position to use in array-of-links fields, or -1 for every position
+	assets  map[string]bool // -asset-query: the only assets worked on, nil for every asset
+}
+
+// fetchEntryReq returns a request that reads the selected asset links of entryID
+func (ls linkSelector) fetchEntryReq(entryID string) contentful.FetchEntryRequest {
+	return contentful.FetchEntryRequest{
+		EntryID:   entryID,
+		FieldKeys: ls.fields,
+		Locales:   ls.locales,
+	}
+}
+
+// links returns the entry's selected links, leaving out other positions of array fields
+// when an index is selected
+func (ls linkSelector) links(entry contentful.Entry) []contentful.AssetLink {
+	var links []contentful.AssetLink
+	for _, link := range entry.AssetLinks {
+		if !link.InArray || ls.index < 0 || link.Index == ls.index {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// linksTo returns the entry's selected links that point at assetID
+func (ls linkSelector) linksTo(entry contentful.Entry, assetID string) []contentful.AssetLink {
+	var links []contentful.AssetLink
+	for _, link := range ls.links(entry) {
+		if link.AssetID == assetID {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// wanted reports whether links to assetID are worked on
+func (ls linkSelector) wanted(assetID string) bool {
+	return ls.assets == nil || ls.assets[assetID]
+}
+
+// wantedLinks returns the entry's selected links to assets that are worked on
+func (ls linkSelector) wantedLinks(entry contentful.Entry) []contentful.AssetLink {
+	var links []contentful.AssetLink
+	for _, link := range ls.links(entry) {
+		if ls.wanted(link.AssetID) {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// linkedAssetIDs returns the distinct assets the entry's selected links point at, in link order
+func (ls linkSelector) linkedAssetIDs(entry contentful.Entry) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, link := range ls.links(entry) {
+		if !seen[link.AssetID] {
+			seen[link.AssetID] = true
+			ids = append(ids, link.AssetID)
+		}
+	}
+	return ids
+}
+
+// describeLinks renders links as "field.locale" pairs with array positions and Rich Text
+// node paths, e.g. "heroImage.en-US, gallery.de-DE[2], body.en-US/content/3"
+func describeLinks(links []contentful.AssetLink) string {
+	parts := make([]string, 0, len(links))
+	for _, link := range links {
+		parts = append(parts, describeLink(link))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeLink renders one link as described by describeLinks
+func describeLink(link contentful.AssetLink) string {
+	desc := link.FieldKey + "." + link.Locale
+	if link.InArray {
+		desc += "[" + strconv.Itoa(link.Index) + "]"
+	}
+	return desc + link.NodePath
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// listBatchSize is the number of rows list and archived-list modes read with one collection request
+const listBatchSize = 100
+
+// batchJobs groups the jobs into batches of up to size, in order, and closes batches when
+// jobs is drained
+func batchJobs(jobs <-chan rowJob, batches chan<- []rowJob, size int) {
+	defer close(batches)
+	var batch []rowJob
+	for job := range jobs {
+		batch = append(batch, job)
+		if len(batch) == size {
+			batches <- batch
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		batches <- batch
+	}
+}
+
+// processListBatch reads the entries (list mode) or assets (archived-list mode) of a batch
+// of rows with one collection request per page, and writes each row's listing. IDs missing
+// from the response, or every ID when the collection request fails, are fetched on their
+// own, and those the CMA does not know are written to notFoundW.
+func processListBatch(ctx context.Context, cfg runConfig, batch []rowJob, successW, notFoundW *rowWriter) {
+	client, sel := cfg.client, cfg.sel
+	ids := make([]string, 0, len(batch))
+	for _, job := range batch {
+		ids = append(ids, job.entryID)
+	}
+	rows := fmt.Sprintf("rows %d-%d", batch[0].rowNum, batch[len(batch)-1].rowNum)
+
+	if cfg.mode == "archived-list" {
+		// Archived list mode: the rows name assets
+		assets, status, err := client.ListAssets(ctx, contentful.ListAssetsRequest{IDs: ids})
+		if err != nil {
+			warnf("%s: list assets -> status %d: %v; fetching each asset on its own", rows, status, err)
+		}
+		byID := make(map[string]contentful.Asset, len(assets))
+		for _, asset := range assets {
+			byID[asset.ID] = asset
+		}
+		for _, job := range batch {
+			asset, ok := byID[job.entryID]
+			if !ok {
+				if asset, ok = fetchMissingAsset(ctx, client, job.rowNum, job.entryID, "", notFoundW); !ok {
+					continue
+				}
+			}
+			processArchivedList(job.entryID, asset, successW)
+		}
+		return
+	}
+
+	// List mode: read the entries together with the assets they link to
+	listReq := contentful.ListEntriesRequest{
+		IDs:       ids,
+		FieldKeys: sel.fields,
+		Locales:   sel.locales,
+		Include:   1,
+	}
+	list, status, err := client.ListEntries(ctx, listReq)
+	if err != nil {
+		warnf("%s: list entries -> status %d: %v; fetching each entry on its own", rows, status, err)
+	}
+	byID := make(map[string]contentful.Entry, len(list.Entries))
+	for _, entry := range list.Entries {
+		byID[entry.ID] = entry
+	}
+	for _, job := range batch {
+		entry, ok := byID[job.entryID]
+		if !ok {
+			if entry, ok = fetchMissingEntry(ctx, client, job.rowNum, job.entryID, sel, notFoundW); !ok {
+				continue
+			}
+		}
+		links := sel.wantedLinks(entry)
+		if len(links) == 0 {
+			warnf("row %d: entry %s has no asset link in %s", job.rowNum, job.entryID, strings.Join(sel.fields, ", "))
+			continue
+		}
+
+		// Only list links whose asset exists; fetch the assets the CMA did not include, once each
+		exists := make(map[string]bool, len(links))
+		listed := make([]contentful.AssetLink, 0, len(links))
+		for _, link := range links {
+			ok, checked := exists[link.AssetID]
+			if !checked {
+				if _, ok = list.IncludedAssets[link.AssetID]; !ok {
+					_, ok = fetchMissingAsset(ctx, client, job.rowNum, link.AssetID, job.entryID, notFoundW)
+				}
+				exists[link.AssetID] = ok
+			}
+			if ok {
+				listed = append(listed, link)
+			}
+		}
+		writeEntryLinks(job.entryID, entry, listed, successW)
+	}
+}
+
+// fetchMissingEntry fetches an entry left out of a batch response on its own. Reports false
+// when it cannot be read, recording it in notFoundW when the CMA does not know it.
+func fetchMissingEntry(ctx context.Context, client *contentful.Client, rowNum int, entryID string, sel linkSelector, notFoundW *rowWriter) (contentful.Entry, bool) {
+	entry, status, err := client.FetchEntry(ctx, sel.fetchEntryReq(entryID))
+	if err != nil {
+		warnf("row %d: fetch entry %s -> status %d: %v", rowNum, entryID, status, err)
+		if contentful.ErrorCategory(err) == contentful.ErrorNotFound {
+			_ = notFoundW.Write([]string{strconv.Itoa(rowNum), "Entry", entryID, ""})
+		}
+		return contentful.Entry{}, false
+	}
+	return entry, true
+}
+
+// fetchMissingAsset fetches an asset left out of a batch response on its own. Reports false
+// when it cannot be read, recording it in notFoundW, with the entry linking it if any, when
+// the CMA does not know it.
+func fetchMissingAsset(ctx context.Context, client *contentful.Client, rowNum int, assetID, linkedFrom string, notFoundW *rowWriter) (contentful.Asset, bool) {
+	asset, status, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: assetID})
+	if err != nil {
+		warnf("row %d: fetch asset %s -> status %d: %v", rowNum, assetID, status, err)
+		if contentful.ErrorCategory(err) == contentful.ErrorNotFound {
+			_ = notFoundW.Write([]string{strconv.Itoa(rowNum), "Asset", assetID, linkedFrom})
+		}
+		return contentful.Asset{}, false
+	}
+	return asset, true
+}
+
+// writeEntryLinks writes one listing line per selected link of the entry
+func writeEntryLinks(entryID string, entry contentful.Entry, links []contentful.AssetLink, successW *rowWriter) {
+	for _, link := range links {
+		index := ""
+		if link.InArray {
+			index = fmt.Sprintf("%d", link.Index)
+		}
+		_ = successW.Write([]string{
+			entryID,
+			entry.FieldStatus["*"][link.Locale],
+			link.AssetID,
+			link.FieldKey,
+			link.Locale,
+			index,
+			link.NodePath,
+		})
+	}
+}
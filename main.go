@@ -9,8 +9,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,11 +25,37 @@ func main() {
 	scheme := flag.String("scheme", "Bearer", "Authorization scheme prefix, e.g. Bearer")
 	environment := flag.String("environment", "yap_env2", "Environment to use for the base URL")
 	spaceID := flag.String("space-id", os.Getenv("SPACE_ID"), "Contentful space ID (or set SPACE_ID env var)")
+	baseURL := flag.String("base-url", contentful.DefaultBaseURL, "Contentful Management API base URL")
+	uploadURL := flag.String("upload-url", contentful.DefaultUploadURL, "Contentful Upload API base URL")
 	timeout := flag.Duration("timeout", 20*time.Second, "HTTP client timeout")
-	mode := flag.String("mode", "update", "Operation mode: 'update' to replace assets, 'list' to generate entry/asset listing, 'publish' to publish entries, or 'archived-list' to check if assets are archived")
+	maxRetries := flag.Int("max-retries", contentful.DefaultMaxRetries, "Maximum retries per request for rate-limited (429) and transient (5xx, network) failures; 0 disables retries")
+	retryDelay := flag.Duration("retry-delay", contentful.DefaultRetryBaseDelay, "Initial retry backoff delay, doubled per attempt with jitter")
+	resume := flag.Bool("resume", false, "Update mode: continue each entry from its last completed step recorded in the journal")
+	journalPath := flag.String("journal", "update_journal.jsonl", "Update mode: path of the per-replacement progress journal")
+	concurrency := flag.Int("concurrency", 1, "Number of CSV rows (batches of 100 rows in list and archived-list modes) to process in parallel")
+	rateLimit := flag.Float64("rate-limit", contentful.DefaultRequestsPerSecond, "Maximum CMA and Upload API requests per second shared by all workers, not counting CDN file downloads; 0 disables the limit")
+	retireNew := flag.Bool("retire-new", false, "Rollback mode: also unpublish and archive the replacement asset")
+	var fields, locales stringList
+	flag.Var(&fields, "field", "Entry field holding the asset link; repeat or comma-separate for several (default downloadableFile)")
+	flag.Var(&locales, "locale", "Locale of the asset link; repeat or comma-separate for several (default en-US)")
+	index := flag.Int("index", -1, "Array-of-links fields: only use the link at this position (0-based); -1 uses every position")
+	strategy := flag.String("strategy", strategyCreate, "Update mode: 'create' to create a new asset and relink the entry, or 'in-place' to put the new file onto the existing asset, keeping its ID")
+	referrers := flag.String("referrers", referrersRefuse, "Update mode: what to do with other entries linking an old asset before it is archived: 'refuse' to leave the asset alone and report them, or 'relink' to patch and republish them")
+	conflicts := flag.String("on-conflict", conflictFail, "Update and rollback modes: what to do when an entry or asset changed since it was read (409 VersionMismatch): 'fail' to abandon the row, or 'refetch' to retry at the current version when the links or files are unchanged")
+	stream := flag.Bool("stream", false, "Update mode: pipe each file from the CDN straight into its upload instead of saving it under downloaded/")
+	spool := flag.Bool("spool", false, "With -stream: also spool each file to a temporary file under downloaded/ while uploading, so a failed upload can be retried")
+	keepDownloads := flag.Bool("keep-downloads", false, "Update mode: keep the files saved under downloaded/ after a row succeeds instead of removing them")
+	transformFlag := flag.String("transform", "", "Update mode: re-encode PNG, JPEG and GIF files before uploading them, dropping EXIF, e.g. 'format=jpeg,max-width=2000,max-height=2000,quality=80'")
+	fixContentType := flag.Bool("fix-content-type", false, "Update mode: give replacement assets the content type detected from their files' bytes when the old asset's label differs, e.g. application/octet-stream")
+	queryFlag := flag.String("query", "", "Select the entries to work on (assets in archived-list mode) with a CMA search query instead of -csv, e.g. 'content_type=document&sys.updatedAt[gte]=2025-01-01'")
+	assetQueryFlag := flag.String("asset-query", "", "Update, list, publish and content-type-audit modes: only work on entries' links to assets matching this CMA search query, e.g. 'mimetype_group=pdfdocument'")
+	strictSchema := flag.Bool("strict-schema", false, "Fail rows whose entries or assets carry properties this tool does not know, instead of warning once about them")
+	reportPath := flag.String("report", "run_report.jsonl", "Path of the NDJSON run report with per-row requests, retries and outcomes; empty disables it")
+	dryRun := flag.Bool("dry-run", false, "Update, publish and rollback modes: only read from the API and write the planned changes to plan.csv")
+	mode := flag.String("mode", "update", "Operation mode: 'update' to replace assets, 'list' to generate entry/asset listing, 'publish' to publish entries, 'archived-list' to check if assets are archived, 'content-type-audit' to compare assets' content types with their files' bytes, or 'rollback' to revert replacements listed in success.csv or the journal")
 	flag.Parse()
 
-	if strings.TrimSpace(*csvPath) == "" {
+	if strings.TrimSpace(*csvPath) == "" && *queryFlag == "" {
 		fatalf("missing -csv <path> argument")
 	}
 	if token == nil || strings.TrimSpace(*token) == "" {
@@ -35,36 +65,157 @@ func main() {
 		fatalf("missing -space-id argument or SPACE_ID environment variable")
 	}
 
+	if *concurrency < 1 {
+		fatalf("invalid -concurrency %d: must be at least 1", *concurrency)
+	}
+
+	if *resume && *mode != "update" {
+		fatalf("-resume is only supported in update mode")
+	}
+
 	// Validate mode parameter
-	if *mode != "update" && *mode != "list" && *mode != "publish" && *mode != "archived-list" {
-		fatalf("invalid mode '%s': must be 'update', 'list', 'publish', or 'archived-list'", *mode)
+	if *mode != "update" && *mode != "list" && *mode != "publish" && *mode != "archived-list" && *mode != "content-type-audit" && *mode != "rollback" {
+		fatalf("invalid mode '%s': must be 'update', 'list', 'publish', 'archived-list', 'content-type-audit', or 'rollback'", *mode)
 	}
 
-	file, err := os.Open(*csvPath)
-	if err != nil {
-		fatalf("open csv: %v", err)
+	// Select the asset link fields and locales to work on
+	if len(fields) == 0 {
+		fields = stringList{contentful.DefaultAssetField}
+	}
+	if len(locales) == 0 {
+		locales = stringList{contentful.DefaultLocale}
+	}
+	if *index < -1 {
+		fatalf("invalid -index %d: must be a position (0-based) or -1 for every position", *index)
+	}
+	sel := linkSelector{fields: fields, locales: locales, index: *index}
+
+	if *dryRun && *mode != "update" && *mode != "publish" && *mode != "rollback" {
+		fatalf("-dry-run is only supported in update, publish and rollback modes")
+	}
+
+	if *strategy != strategyCreate && *strategy != strategyInPlace {
+		fatalf("invalid -strategy '%s': must be '%s' or '%s'", *strategy, strategyCreate, strategyInPlace)
+	}
+	if *referrers != referrersRefuse && *referrers != referrersRelink {
+		fatalf("invalid -referrers '%s': must be '%s' or '%s'", *referrers, referrersRefuse, referrersRelink)
+	}
+	if *conflicts != conflictFail && *conflicts != conflictRefetch {
+		fatalf("invalid -on-conflict '%s': must be '%s' or '%s'", *conflicts, conflictFail, conflictRefetch)
+	}
+	if *spool && !*stream {
+		fatalf("-spool is only supported with -stream")
+	}
+	staging := fileStaging{stream: *stream, spool: *spool, keep: *keepDownloads, fixTypes: *fixContentType}
+	if *transformFlag != "" {
+		if *stream {
+			fatalf("-transform is not supported with -stream; images must be saved to be re-encoded")
+		}
+		transform, err := parseTransform(*transformFlag)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		staging.transform = transform
+	}
+
+	// Select rows with a CMA search query instead of the CSV, and narrow the rows, queried or
+	// read from the CSV, to links to the assets a second query matches
+	var query, assetQuery url.Values
+	var err error
+	if *queryFlag != "" || *assetQueryFlag != "" {
+		if *mode == "rollback" {
+			fatalf("-query and -asset-query are not supported in rollback mode; it reverts the rows of success.csv or the journal")
+		}
+		if *assetQueryFlag != "" && *mode == "archived-list" {
+			fatalf("-asset-query is not supported in archived-list mode; select the assets with -query")
+		}
+		if *queryFlag != "" {
+			if query, err = parseQuery("-query", *queryFlag); err != nil {
+				fatalf("%v", err)
+			}
+		}
+		if *assetQueryFlag != "" {
+			if assetQuery, err = parseQuery("-asset-query", *assetQueryFlag); err != nil {
+				fatalf("%v", err)
+			}
+		}
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.TrimLeadingSpace = true
+	var reader *csv.Reader
+	if query == nil {
+		file, err := os.Open(*csvPath)
+		if err != nil {
+			fatalf("open csv: %v", err)
+		}
+		defer file.Close()
 
-	var successW, failedW *csv.Writer
+		reader = csv.NewReader(file)
+		reader.TrimLeadingSpace = true
+		if *mode == "rollback" {
+			// entry_published is optional, so rows may have 3 or 4 columns
+			reader.FieldsPerRecord = -1
+		}
+	}
+
+	var successW, failedW *rowWriter
 	var successF, failedF *os.File
+	var jr *journal
+
+	if *mode == "update" && *dryRun {
+		// A dry run never writes the journal, but plans around its progress when resuming
+		if *resume {
+			states, err := loadJournal(*journalPath)
+			if err != nil {
+				fatalf("read journal %s: %v", *journalPath, err)
+			}
+			jr = &journal{resume: true, states: states}
+		}
+	} else if *mode == "update" {
+		// Record per-entry progress so an interrupted run can be resumed
+		jr, err = openJournal(*journalPath, *resume)
+		if err != nil {
+			fatalf("open journal %s: %v", *journalPath, err)
+		}
+		defer jr.Close()
+	}
 
-	if *mode == "update" {
+	if *dryRun {
+		// For dry runs, write the planned changes instead of touching the mode's outputs
+		planF, err := os.Create("plan.csv")
+		if err != nil {
+			fatalf("open plan.csv: %v", err)
+		}
+		defer planF.Close()
+		successW = newRowWriter(planF)
+		defer successW.Flush()
+		_ = successW.Write(planHeader)
+
+		// Rows that cannot be planned use the mode's failed columns
+		failedF, err = os.Create("plan_failed.csv")
+		if err != nil {
+			fatalf("open plan_failed.csv: %v", err)
+		}
+		defer failedF.Close()
+		failedW = newRowWriter(failedF)
+		defer failedW.Flush()
+		if *mode == "publish" {
+			_ = failedW.Write([]string{"entry_id", "error"})
+		} else {
+			_ = failedW.Write([]string{"entry_id", "old_asset_id", "new_asset_id", "error"})
+		}
+	} else if *mode == "update" {
 		// Prepare success and failed CSV outputs (append mode) for update mode
 		successF, err = os.OpenFile("success.csv", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 		if err != nil {
 			fatalf("open success.csv: %v", err)
 		}
 		defer successF.Close()
-		successW = csv.NewWriter(successF)
+		successW = newRowWriter(successF)
 		defer successW.Flush()
 
 		// Check if success.csv is empty and write header if needed
 		if stat, err := successF.Stat(); err == nil && stat.Size() == 0 {
-			_ = successW.Write([]string{"entry_id", "old_asset_id", "new_asset_id"})
+			_ = successW.Write([]string{"entry_id", "old_asset_id", "new_asset_id", "entry_published", "old_asset_published"})
 		}
 
 		failedF, err = os.OpenFile("failed.csv", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -72,7 +223,7 @@ func main() {
 			fatalf("open failed.csv: %v", err)
 		}
 		defer failedF.Close()
-		failedW = csv.NewWriter(failedF)
+		failedW = newRowWriter(failedF)
 		defer failedW.Flush()
 
 		// Check if failed.csv is empty and write header if needed
@@ -86,7 +237,7 @@ func main() {
 			fatalf("open publish_success.csv: %v", err)
 		}
 		defer successF.Close()
-		successW = csv.NewWriter(successF)
+		successW = newRowWriter(successF)
 		defer successW.Flush()
 
 		// Check if publish_success.csv is empty and write header if needed
@@ -99,13 +250,40 @@ func main() {
 			fatalf("open publish_failed.csv: %v", err)
 		}
 		defer failedF.Close()
-		failedW = csv.NewWriter(failedF)
+		failedW = newRowWriter(failedF)
 		defer failedW.Flush()
 
 		// Check if publish_failed.csv is empty and write header if needed
 		if stat, err := failedF.Stat(); err == nil && stat.Size() == 0 {
 			_ = failedW.Write([]string{"entry_id", "error"})
 		}
+	} else if *mode == "rollback" {
+		// Prepare success and failed CSV outputs for rollback mode
+		successF, err = os.OpenFile("rollback_success.csv", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fatalf("open rollback_success.csv: %v", err)
+		}
+		defer successF.Close()
+		successW = newRowWriter(successF)
+		defer successW.Flush()
+
+		// Check if rollback_success.csv is empty and write header if needed
+		if stat, err := successF.Stat(); err == nil && stat.Size() == 0 {
+			_ = successW.Write([]string{"entry_id", "old_asset_id", "new_asset_id", "new_asset_retired"})
+		}
+
+		failedF, err = os.OpenFile("rollback_failed.csv", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fatalf("open rollback_failed.csv: %v", err)
+		}
+		defer failedF.Close()
+		failedW = newRowWriter(failedF)
+		defer failedW.Flush()
+
+		// Check if rollback_failed.csv is empty and write header if needed
+		if stat, err := failedF.Stat(); err == nil && stat.Size() == 0 {
+			_ = failedW.Write([]string{"entry_id", "old_asset_id", "new_asset_id", "error"})
+		}
 	} else if *mode == "archived-list" {
 		// For archived list mode, create a listing output file
 		archivedF, err := os.Create("archived_asset_list.csv")
@@ -113,11 +291,32 @@ func main() {
 			fatalf("open archived_asset_list.csv: %v", err)
 		}
 		defer archivedF.Close()
-		successW = csv.NewWriter(archivedF)
+		successW = newRowWriter(archivedF)
 		defer successW.Flush()
 
 		// Write header for archived list mode
 		_ = successW.Write([]string{"asset_id", "is_archived", "archived_at", "title", "file_url"})
+	} else if *mode == "content-type-audit" {
+		// For content type audit mode, create an audit output file with one line per file
+		auditF, err := os.Create("content_type_audit.csv")
+		if err != nil {
+			fatalf("open content_type_audit.csv: %v", err)
+		}
+		defer auditF.Close()
+		successW = newRowWriter(auditF)
+		defer successW.Flush()
+
+		_ = successW.Write([]string{"entry_id", "asset_id", "locale", "file_name", "content_type", "detected_content_type", "result"})
+
+		failedF, err = os.Create("content_type_audit_failed.csv")
+		if err != nil {
+			fatalf("open content_type_audit_failed.csv: %v", err)
+		}
+		defer failedF.Close()
+		failedW = newRowWriter(failedF)
+		defer failedW.Flush()
+
+		_ = failedW.Write([]string{"entry_id", "asset_id", "error"})
 	} else {
 		// For list mode, create a listing output file
 		listF, err := os.Create("entry_asset_list.csv")
@@ -125,17 +324,184 @@ func main() {
 			fatalf("open entry_asset_list.csv: %v", err)
 		}
 		defer listF.Close()
-		successW = csv.NewWriter(listF)
+		successW = newRowWriter(listF)
 		defer successW.Flush()
 
 		// Write header for listing mode
-		_ = successW.Write([]string{"entry_id", "entry_status", "asset_id"})
+		_ = successW.Write([]string{"entry_id", "entry_status", "asset_id", "field", "locale", "index", "node"})
 	}
 
-	client := &http.Client{Timeout: *timeout}
+	if *mode == "list" || *mode == "archived-list" {
+		// Entries and assets the CMA does not know are listed separately
+		notFoundF, err := os.Create("not_found.csv")
+		if err != nil {
+			fatalf("open not_found.csv: %v", err)
+		}
+		defer notFoundF.Close()
+		failedW = newRowWriter(notFoundF)
+		defer failedW.Flush()
+
+		_ = failedW.Write([]string{"row", "type", "id", "linked_from"})
+	}
+
+	client := &contentful.Client{
+		HTTPClient:  &http.Client{Timeout: *timeout},
+		BaseURL:     *baseURL,
+		UploadURL:   *uploadURL,
+		SpaceID:     *spaceID,
+		Environment: *environment,
+		HeaderName:  *headerName,
+		Scheme:      *scheme,
+		Token:       *token,
+
+		MaxRetries:     *maxRetries,
+		RetryBaseDelay: *retryDelay,
+		Limiter:        contentful.NewRateLimiter(*rateLimit),
+
+		StrictSchema: *strictSchema,
+		OnSchemaDrift: func(kind string, keys []string) {
+			warnf("CMA %s responses carry fields this tool does not know, ignoring them (use -strict-schema to fail instead): %s", kind, strings.Join(keys, ", "))
+		},
+	}
 	ctx := context.Background()
 
+	// Record a machine-readable report of the run next to the CSVs
+	var rep *runReport
+	if *reportPath != "" {
+		source := *csvPath
+		if *queryFlag != "" {
+			source = *queryFlag
+		}
+		run := runRecord{
+			Version:     toolVersion(),
+			SpaceID:     *spaceID,
+			Environment: *environment,
+			Mode:        *mode,
+			DryRun:      *dryRun,
+			Source:      source,
+			StartedAt:   time.Now(),
+		}
+		if rep, err = openReport(*reportPath, run); err != nil {
+			fatalf("open report %s: %v", *reportPath, err)
+		}
+		defer rep.Close()
+	}
+
+	// Run the queries before the workers start, so they all see the narrowed selector
+	if assetQuery != nil {
+		if sel.assets, err = queryAssets(ctx, client, assetQuery); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	var queried []rowJob
+	if query != nil {
+		if queried, err = queryJobs(ctx, client, *mode, query, sel); err != nil {
+			fatalf("%v", err)
+		}
+		if len(queried) == 0 {
+			warnf("query matched nothing")
+		}
+	}
+
+	cfg := runConfig{
+		client:    client,
+		mode:      *mode,
+		dryRun:    *dryRun,
+		strategy:  *strategy,
+		referrers: *referrers,
+		conflicts: *conflicts,
+		retireNew: *retireNew,
+		sel:       sel,
+		staging:   staging,
+		jr:        jr,
+	}
+
+	// Start a bounded pool of workers; all of them share the client's rate limiter
+	jobs := make(chan rowJob)
+	var wg sync.WaitGroup
+	if *mode == "list" || *mode == "archived-list" {
+		// Listing modes read their rows a batch at a time, with one collection request per batch
+		batches := make(chan []rowJob)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batchJobs(jobs, batches, listBatchSize)
+		}()
+		for i := 0; i < *concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for batch := range batches {
+					first, last := batch[0].rowNum, batch[len(batch)-1].rowNum
+					batchCtx, trace := rep.startRow(ctx, "batch", first, last, len(batch), "", successW, failedW)
+					processListBatch(batchCtx, cfg, batch, trace.succeededW, trace.failedW)
+					if n := trace.Retries(); n > 0 {
+						warnf("rows %d-%d needed %d retries", first, last, n)
+					}
+					trace.finish()
+				}
+			}()
+		}
+	} else {
+		for i := 0; i < *concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for job := range jobs {
+					// Rows naming the same entry (e.g. one rollback row per replaced asset) must not
+					// race on the entry's version, so they run one at a time. Update rows lock
+					// the entries they change themselves, once their new asset exists.
+					unlock := func() {}
+					if *mode != "update" || *dryRun {
+						unlock = entryLocks.lock(job.entryID)
+					}
+
+					// Trace the row so its retries, requests and outcome can be reported per row
+					rowCtx, trace := rep.startRow(ctx, "row", job.rowNum, job.rowNum, 1, job.entryID, successW, failedW)
+					rowSuccessW, rowFailedW := trace.succeededW, trace.failedW
+					if *mode == "rollback" && *dryRun {
+						planRollback(rowCtx, cfg, job, rowSuccessW, rowFailedW)
+					} else if *mode == "rollback" {
+						processRollback(rowCtx, cfg, job, rowSuccessW, rowFailedW)
+					} else {
+						processRow(rowCtx, cfg, job, rowSuccessW, rowFailedW)
+					}
+					if n := trace.Retries(); n > 0 {
+						warnf("row %d: %s needed %d retries", job.rowNum, job.entryID, n)
+					}
+					trace.finish()
+					unlock()
+				}
+			}()
+		}
+	}
+
+	// Rollback mode can read its rows straight from the update journal
+	if *mode == "rollback" && strings.EqualFold(filepath.Ext(*csvPath), ".jsonl") {
+		journalJobs, err := rollbackJobsFromJournal(*csvPath)
+		if err != nil {
+			fatalf("read journal %s: %v", *csvPath, err)
+		}
+		for _, job := range journalJobs {
+			jobs <- job
+		}
+		close(jobs)
+		wg.Wait()
+		return
+	}
+
+	// Queried rows go straight to the workers
+	if query != nil {
+		for _, job := range queried {
+			jobs <- job
+		}
+		close(jobs)
+		wg.Wait()
+		return
+	}
+
 	rowNum := 0
+	var cols map[string]int // update mode: header column positions, nil without a header row
 
 	for {
 		record, err := reader.Read()
@@ -153,8 +519,29 @@ func main() {
 		}
 		entryID := strings.TrimSpace(record[0])
 
-		if *mode == "list" || *mode == "publish" {
-			// List mode and publish mode: only require entry_id
+		if *mode == "rollback" {
+			// Rollback mode: rows come from success.csv (entry_id, old_asset_id, new_asset_id and
+			// optionally entry_published and old_asset_published)
+			if rowNum == 1 && strings.EqualFold(entryID, "entry_id") {
+				// header row, skip
+				continue
+			}
+			if entryID == "" || len(record) < 3 || strings.TrimSpace(record[1]) == "" || strings.TrimSpace(record[2]) == "" {
+				warnf("row %d: require entry_id, old_asset_id and new_asset_id", rowNum)
+				continue
+			}
+			if strings.TrimSpace(record[1]) == strings.TrimSpace(record[2]) {
+				// -strategy in-place kept the asset ID, so there is no earlier asset to relink
+				warnf("row %d: asset %s was replaced in place and cannot be rolled back", rowNum, strings.TrimSpace(record[1]))
+				rep.failRow(ctx, rowNum, entryID, failedW, []string{entryID, strings.TrimSpace(record[1]), strings.TrimSpace(record[2]), "replaced in place; the previous file is not kept as an asset"})
+				continue
+			}
+			entryPublished := len(record) < 4 || !strings.EqualFold(strings.TrimSpace(record[3]), "false")
+			oldPublished := len(record) < 5 || !strings.EqualFold(strings.TrimSpace(record[4]), "false")
+			jobs <- rowJob{rowNum: rowNum, entryID: entryID, oldAssetID: strings.TrimSpace(record[1]), newAssetID: strings.TrimSpace(record[2]), entryPublished: entryPublished, oldAssetPublished: oldPublished}
+			continue
+		} else if *mode == "list" || *mode == "publish" || *mode == "content-type-audit" {
+			// List, publish and content type audit modes: only require entry_id
 			if entryID == "" {
 				warnf("row %d: require entry_id", rowNum)
 				continue
@@ -174,278 +561,688 @@ func main() {
 				continue
 			}
 		} else {
-			// Update mode: only require entry_id (asset_id will be fetched from entry)
+			// Update mode: require entry_id (asset_id will be fetched from entry). A header
+			// row may add replacement_file/replacement_url and metadata override columns.
 			if entryID == "" {
 				warnf("row %d: require entry_id", rowNum)
 				continue
 			}
 			if rowNum == 1 && strings.EqualFold(entryID, "entry_id") {
-				// header row, skip
+				cols = columnIndex(record)
 				continue
 			}
-		}
-
-		// Declare variables to be used in both modes
-		var entry contentful.Entry
-		var asset contentful.Asset
-		var assetID string
-
-		if *mode == "list" || *mode == "publish" {
-			// List mode and publish mode: fetch entry first
-			fetchEntryReq := contentful.FetchEntryRequest{
-				SpaceID:     *spaceID,
-				Environment: *environment,
-				EntryID:     entryID,
-				HeaderName:  *headerName,
-				Scheme:      *scheme,
-				Token:       *token,
-			}
-			var entryStatus int
-			var err error
-			entry, entryStatus, err = contentful.FetchEntry(ctx, client, fetchEntryReq)
+			repl, err := parseReplacement(record, cols)
 			if err != nil {
-				warnf("row %d: fetch entry %s -> status %d: %v", rowNum, entryID, entryStatus, err)
-				if *mode == "publish" {
-					_ = failedW.Write([]string{entryID, fmt.Sprintf("fetch entry: %v", err)})
-				}
+				warnf("row %d: %v", rowNum, err)
+				rep.failRow(ctx, rowNum, entryID, failedW, []string{entryID, "", "", err.Error()})
 				continue
 			}
+			jobs <- rowJob{rowNum: rowNum, entryID: entryID, repl: repl}
+			continue
+		}
 
-			// For list mode: extract asset_id from entry's downloadableFile field and fetch asset
-			if *mode == "list" {
-				assetID = entry.AssetID
-				if assetID == "" {
-					warnf("row %d: entry %s has no downloadableFile asset", rowNum, entryID)
-					continue
-				}
+		jobs <- rowJob{rowNum: rowNum, entryID: entryID}
+	}
 
-				// Now fetch the asset details
-				fetchAssetReq := contentful.FetchAssetRequest{
-					SpaceID:     *spaceID,
-					Environment: *environment,
-					AssetID:     assetID,
-					HeaderName:  *headerName,
-					Scheme:      *scheme,
-					Token:       *token,
-				}
-				var fetchStatus int
-				asset, fetchStatus, err = contentful.FetchAsset(ctx, client, fetchAssetReq)
-				if err != nil {
-					warnf("row %d: fetch asset %s -> status %d: %v", rowNum, assetID, fetchStatus, err)
-					continue
-				}
-			}
-		} else if *mode == "archived-list" {
-			// Archived list mode: treat entryID as asset_id and fetch asset directly
-			assetID = entryID
-			fetchAssetReq := contentful.FetchAssetRequest{
-				SpaceID:     *spaceID,
-				Environment: *environment,
-				AssetID:     assetID,
-				HeaderName:  *headerName,
-				Scheme:      *scheme,
-				Token:       *token,
-			}
-			var fetchStatus int
-			var err error
-			asset, fetchStatus, err = contentful.FetchAsset(ctx, client, fetchAssetReq)
-			if err != nil {
-				warnf("row %d: fetch asset %s -> status %d: %v", rowNum, assetID, fetchStatus, err)
-				continue
-			}
-		} else {
-			// Update mode: fetch entry first, then get asset_id from entry's downloadableFile field
-			fetchEntryReq := contentful.FetchEntryRequest{
-				SpaceID:     *spaceID,
-				Environment: *environment,
-				EntryID:     entryID,
-				HeaderName:  *headerName,
-				Scheme:      *scheme,
-				Token:       *token,
-			}
-			var entryStatus int
-			var err error
-			entry, entryStatus, err = contentful.FetchEntry(ctx, client, fetchEntryReq)
-			if err != nil {
-				warnf("row %d: fetch entry %s -> status %d: %v", rowNum, entryID, entryStatus, err)
-				_ = failedW.Write([]string{entryID, "", "", fmt.Sprintf("fetch entry: %v", err)})
-				continue
-			}
+	close(jobs)
+	wg.Wait()
+}
 
-			// Extract asset_id from entry's downloadableFile field
-			assetID = entry.AssetID
-			if assetID == "" {
-				warnf("row %d: entry %s has no downloadableFile asset", rowNum, entryID)
-				_ = failedW.Write([]string{entryID, "", "", "entry has no downloadableFile asset"})
-				continue
-			}
+// rowJob is one validated CSV row waiting for a worker
+type rowJob struct {
+	rowNum  int
+	entryID string
 
-			fetchAssetReq := contentful.FetchAssetRequest{
-				SpaceID:     *spaceID,
-				Environment: *environment,
-				AssetID:     assetID,
-				HeaderName:  *headerName,
-				Scheme:      *scheme,
-				Token:       *token,
-			}
-			var fetchStatus int
-			asset, fetchStatus, err = contentful.FetchAsset(ctx, client, fetchAssetReq)
-			if err != nil {
-				warnf("row %d: fetch asset %s -> status %d: %v", rowNum, assetID, fetchStatus, err)
-				_ = failedW.Write([]string{entryID, assetID, "", fmt.Sprintf("fetch asset: %v", err)})
-				continue
-			}
-		}
+	// Rollback mode only: the replacement to revert, whether update mode published the entry
+	// with it, and whether the old asset was published before
+	oldAssetID        string
+	newAssetID        string
+	entryPublished    bool
+	oldAssetPublished bool
 
-		if *mode == "list" {
-			// List mode: just output the information
-			_ = successW.Write([]string{
-				entryID,
-				entry.FieldStatus["*"]["en-US"],
-				assetID,
-			})
-		} else if *mode == "publish" {
-			// Publish mode: publish the entry
-			processPublishEntry(ctx, client, entryID, entry, *spaceID, *environment, *headerName, *scheme, *token, rowNum, successW, failedW)
-		} else if *mode == "archived-list" {
-			// Archived list mode: check if asset is archived
-			processArchivedList(assetID, asset, successW)
-		} else {
-			// Update mode: execute the full asset replacement workflow
-			processAssetUpdate(ctx, client, entryID, assetID, entry, asset, *spaceID, *environment, *headerName, *scheme, *token, rowNum, successW, failedW)
+	// Update mode only: the row's new file and metadata overrides
+	repl replacement
+}
+
+// runConfig carries the settings every row of a run shares, as selected with the flags
+type runConfig struct {
+	client *contentful.Client
+	mode   string
+	dryRun bool
+	sel    linkSelector
+
+	strategy  string      // update mode: strategyCreate or strategyInPlace
+	referrers string      // update mode: referrersRelink or referrersRefuse
+	conflicts string      // update and rollback modes: conflictFail or conflictRefetch
+	staging   fileStaging // update mode
+	jr        *journal    // update mode; nil for dry runs that do not resume
+	retireNew bool        // rollback mode
+}
+
+// keyedMutex hands out one lock per key, created on first use
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock acquires the lock for key and returns its unlock function
+func (km *keyedMutex) lock(key string) func() {
+	unlock, _ := km.lockWaited(key)
+	return unlock
+}
+
+// lockWaited acquires the lock for key like lock, also reporting whether another holder
+// made it wait
+func (km *keyedMutex) lockWaited(key string) (func(), bool) {
+	km.mu.Lock()
+	if km.locks == nil {
+		km.locks = make(map[string]*sync.Mutex)
+	}
+	l, ok := km.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		km.locks[key] = l
+	}
+	km.mu.Unlock()
+
+	if l.TryLock() {
+		return l.Unlock, false
+	}
+	l.Lock()
+	return l.Unlock, true
+}
+
+// lockAll acquires the locks for keys in sorted order, so holders of overlapping key sets
+// cannot deadlock, and returns a function unlocking them all
+func (km *keyedMutex) lockAll(keys ...string) func() {
+	keys = slices.Compact(slices.Sorted(slices.Values(keys)))
+	unlocks := make([]func(), 0, len(keys))
+	for _, key := range keys {
+		unlocks = append(unlocks, km.lock(key))
+	}
+	return func() {
+		for _, unlock := range unlocks {
+			unlock()
 		}
 	}
+}
+
+// assetLocks serializes replacements of the same old asset across workers, since entries
+// sharing it may be relinked by whichever row replaces it first
+var assetLocks keyedMutex
 
+// entryLocks serializes changes to the same entry across workers, so none patches or
+// publishes it at a version another has just moved on. Update rows take them only while
+// holding an asset lock, never the other way round.
+var entryLocks keyedMutex
+
+// rowWriter serializes CSV writes from concurrent workers so each record lands as one
+// whole line, and flushes after every record so progress survives an interrupted run
+type rowWriter struct {
+	mu sync.Mutex
+	w  *csv.Writer
+
+	// Writers from observed write through to and hand each record to note
+	to   *rowWriter
+	note func(record []string)
 }
 
-// processAssetUpdate handles the complete asset replacement workflow for update mode
-func processAssetUpdate(ctx context.Context, client *http.Client, entryID, assetID string, entry contentful.Entry, asset contentful.Asset, spaceID, environment, headerName, scheme, token string, rowNum int, successW, failedW *csv.Writer) {
-	// Download the asset file via contentful module
-	var savedPath string
-	if strings.TrimSpace(asset.FileURL) != "" {
-		downloadReq := contentful.DownloadAssetRequest{
-			Asset:   asset,
-			DestDir: "downloaded",
+func newRowWriter(w io.Writer) *rowWriter {
+	return &rowWriter{w: csv.NewWriter(w)}
+}
+
+// observed returns a writer that writes through rw and hands each record to note, e.g. to
+// track one row's outcome
+func (rw *rowWriter) observed(note func(record []string)) *rowWriter {
+	if rw == nil {
+		return nil
+	}
+	return &rowWriter{to: rw, note: note}
+}
+
+// Write writes a single record and flushes it
+func (rw *rowWriter) Write(record []string) error {
+	if rw.to != nil {
+		rw.note(record)
+		return rw.to.Write(record)
+	}
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if err := rw.w.Write(record); err != nil {
+		return err
+	}
+	rw.w.Flush()
+	return rw.w.Error()
+}
+
+// WriteAll writes several records as one contiguous block and flushes them
+func (rw *rowWriter) WriteAll(records [][]string) error {
+	if rw.to != nil {
+		for _, record := range records {
+			rw.note(record)
 		}
-		if p, _, derr := contentful.DownloadAssetFile(ctx, client, downloadReq); derr != nil {
-			warnf("row %d: download asset file: %v", rowNum, derr)
-			_ = failedW.Write([]string{entryID, assetID, "", fmt.Sprintf("download file: %v", derr)})
-			return
-		} else {
-			savedPath = p
+		return rw.to.WriteAll(records)
+	}
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	for _, record := range records {
+		if err := rw.w.Write(record); err != nil {
+			return err
 		}
+	}
+	rw.w.Flush()
+	return rw.w.Error()
+}
+
+// Flush flushes any buffered data
+func (rw *rowWriter) Flush() {
+	if rw.to != nil {
+		rw.to.Flush()
+		return
+	}
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.w.Flush()
+}
+
+// processRow fetches the entry for one CSV row and dispatches it to the mode's handler.
+// With cfg.dryRun, mutating modes write their plan to successW instead of applying it.
+// List and archived-list rows are read in batches by processListBatch instead.
+func processRow(ctx context.Context, cfg runConfig, job rowJob, successW, failedW *rowWriter) {
+	if cfg.mode == "content-type-audit" {
+		processContentTypeAudit(ctx, cfg, job, successW, failedW)
+		return
+	}
+	if cfg.mode != "publish" {
+		// Update mode: replace every asset the entry's selected links point at
+		processEntryUpdate(ctx, cfg, job, successW, failedW)
+		return
+	}
+
+	// Publish mode: fetch the entry first
+	entryID, rowNum := job.entryID, job.rowNum
+	fetchEntryReq := cfg.sel.fetchEntryReq(entryID)
+	entry, entryStatus, err := cfg.client.FetchEntry(ctx, fetchEntryReq)
+	if err != nil {
+		warnf("row %d: fetch entry %s -> status %d: %v", rowNum, entryID, entryStatus, err)
+		_ = failedW.Write([]string{entryID, fmt.Sprintf("fetch entry: %v", err)})
+		return
+	}
+	if cfg.sel.assets != nil && len(cfg.sel.wantedLinks(entry)) == 0 {
+		warnf("row %d: entry %s links no asset matching -asset-query, skipping", rowNum, entryID)
+		return
+	}
+
+	if cfg.dryRun {
+		planPublishEntry(entryID, entry, cfg.sel, rowNum, successW)
 	} else {
-		_ = failedW.Write([]string{entryID, assetID, "", "asset has empty file URL"})
+		processPublishEntry(ctx, cfg.client, entryID, entry, rowNum, successW, failedW)
+	}
+}
+
+// processEntryUpdate replaces each asset the entry's selected links point at, one after
+// the other, using the run's strategy and referrers policy. With cfg.dryRun, the
+// replacements are planned instead. A row with a replacement file must select exactly one asset.
+func processEntryUpdate(ctx context.Context, cfg runConfig, job rowJob, successW, failedW *rowWriter) {
+	client, sel, jr := cfg.client, cfg.sel, cfg.jr
+	entryID, rowNum, repl := job.entryID, job.rowNum, job.repl
+	fetchEntryReq := sel.fetchEntryReq(entryID)
+	entry, entryStatus, err := client.FetchEntry(ctx, fetchEntryReq)
+	if err != nil {
+		warnf("row %d: fetch entry %s -> status %d: %v", rowNum, entryID, entryStatus, err)
+		_ = failedW.Write([]string{entryID, "", "", fmt.Sprintf("fetch entry: %v", err)})
 		return
 	}
 
-	// Create a new asset from the downloaded file BEFORE unpublishing the old asset
-	var newAssetID string
-	if savedPath != "" {
-		createReq := contentful.CreateAssetRequest{
-			Asset:             asset,
-			SpaceID:           spaceID,
-			Environment:       environment,
-			Locale:            "en-US",
-			FilePath:          savedPath,
-			HeaderName:        headerName,
-			Scheme:            scheme,
-			Token:             token,
-			OriginalCreatedAt: asset.CreatedAt,
+	oldAssetIDs := assetsToReplace(entryID, entry, sel, jr)
+	if len(oldAssetIDs) == 0 {
+		if len(jr.entryStates(entryID)) > 0 {
+			warnf("row %d: entry %s already completed in an earlier run, skipping", rowNum, entryID)
+			return
 		}
-		if nid, _, cerr := contentful.CreateAndPublishAssetFromFile(ctx, client, createReq); cerr != nil {
-			warnf("row %d: create new asset from file: %v", rowNum, cerr)
-			_ = failedW.Write([]string{entryID, assetID, nid, fmt.Sprintf("create new asset: %v", cerr)})
+		if len(sel.links(entry)) > 0 && sel.assets != nil {
+			warnf("row %d: entry %s links no asset matching -asset-query, skipping", rowNum, entryID)
 			return
-		} else {
-			newAssetID = nid
 		}
-	} else {
-		_ = failedW.Write([]string{entryID, assetID, "", "no savedPath for new asset"})
+		if len(sel.links(entry)) > 0 {
+			warnf("row %d: entry %s was already relinked to assets created in this run, skipping", rowNum, entryID)
+			return
+		}
+		warnf("row %d: entry %s has no asset link in %s", rowNum, entryID, strings.Join(sel.fields, ", "))
+		_ = failedW.Write([]string{entryID, "", "", fmt.Sprintf("entry has no asset link in %s", strings.Join(sel.fields, ", "))})
 		return
 	}
+	if repl.hasFile() && len(oldAssetIDs) > 1 {
+		warnf("row %d: entry %s links %d assets but the row has one replacement file", rowNum, entryID, len(oldAssetIDs))
+		_ = failedW.Write([]string{entryID, "", "", fmt.Sprintf("replacement file given but entry links %d assets (%s); narrow with -field, -locale or -index", len(oldAssetIDs), strings.Join(oldAssetIDs, ", "))})
+		return
+	}
+
+	for i, assetID := range oldAssetIDs {
+		// Another row may be replacing the same asset; wait for it and read the entry again after
+		unlock, waited := assetLocks.lockWaited(assetID)
+		ok := processEntryAsset(ctx, cfg, job, assetID, entry, i > 0 || waited, successW, failedW)
+		unlock()
+		if !ok {
+			return
+		}
+	}
+}
+
+// processEntryAsset replaces one of the entry's old assets, re-reading the entry first when
+// reread is set. It returns false when the entry's remaining assets should not be processed.
+func processEntryAsset(ctx context.Context, cfg runConfig, job rowJob, assetID string, entry contentful.Entry, reread bool, successW, failedW *rowWriter) bool {
+	client, sel, jr := cfg.client, cfg.sel, cfg.jr
+	entryID, rowNum := job.entryID, job.rowNum
+	progress, resuming := jr.state(entryID, assetID)
+	if resuming && progress.Step >= stepValidated {
+		warnf("row %d: entry %s asset %s already replaced in an earlier run, skipping", rowNum, entryID, assetID)
+		return true
+	}
+	if step, ok := jr.hasProgress(entryID, assetID); ok && !resuming {
+		warnf("row %d: entry %s asset %s stopped at step %s in an earlier run; pass -resume to continue it instead of starting over", rowNum, entryID, assetID, step)
+	}
+
+	// Earlier replacements, or another row relinking this entry, changed it, so read it again
+	if reread && !cfg.dryRun {
+		var entryStatus int
+		var err error
+		entry, entryStatus, err = client.FetchEntry(ctx, sel.fetchEntryReq(entryID))
+		if err != nil {
+			warnf("row %d: fetch entry %s -> status %d: %v", rowNum, entryID, entryStatus, err)
+			_ = failedW.Write([]string{entryID, assetID, "", fmt.Sprintf("fetch entry: %v", err)})
+			return false
+		}
+		if !resuming && len(sel.linksTo(entry, assetID)) == 0 {
+			warnf("row %d: entry %s no longer links asset %s, it was relinked while replacing the asset for another row", rowNum, entryID, assetID)
+			return true
+		}
+	}
 
-	// Unpublish the old asset first
-	unpublishReq := contentful.UnpublishAssetRequest{
-		SpaceID:     spaceID,
-		Environment: environment,
-		AssetID:     assetID,
-		Version:     asset.Version,
-		HeaderName:  headerName,
-		Scheme:      scheme,
-		Token:       token,
+	// Read the asset in the locale of its first link
+	assetLocale := ""
+	if links := sel.linksTo(entry, assetID); len(links) > 0 {
+		assetLocale = links[0].Locale
 	}
-	unpublishStatus, err := contentful.UnpublishAsset(ctx, client, unpublishReq)
+	fetchAssetReq := contentful.FetchAssetRequest{
+		AssetID: assetID,
+		Locale:  assetLocale,
+	}
+	asset, fetchStatus, err := client.FetchAsset(ctx, fetchAssetReq)
 	if err != nil {
-		warnf("row %d: unpublish asset %s -> status %d: %v", rowNum, assetID, unpublishStatus, err)
-		_ = failedW.Write([]string{entryID, assetID, newAssetID, fmt.Sprintf("unpublish old asset: %v", err)})
+		warnf("row %d: fetch asset %s -> status %d: %v", rowNum, assetID, fetchStatus, err)
+		_ = failedW.Write([]string{entryID, assetID, "", fmt.Sprintf("fetch asset: %v", err)})
+		return true
+	}
+
+	if cfg.dryRun {
+		planAssetUpdate(ctx, cfg, job, assetID, entry, asset, successW, failedW)
+	} else if cfg.strategy == strategyInPlace {
+		processAssetInPlace(ctx, cfg, job, assetID, asset, successW, failedW)
+	} else {
+		// Execute the full asset replacement workflow
+		processAssetUpdate(ctx, cfg, job, assetID, entry, asset, successW, failedW)
+	}
+	return true
+}
+
+// assetsToReplace lists the old assets to replace in the entry: every asset its selected
+// links point at and, when resuming, unfinished replacements whose links were already
+// patched. Assets created by a recorded replacement, or earlier in this run, are not
+// replaced again.
+func assetsToReplace(entryID string, entry contentful.Entry, sel linkSelector, jr *journal) []string {
+	states := jr.entryStates(entryID)
+	created := make(map[string]bool)
+	for _, st := range states {
+		if st.NewAssetID != "" {
+			created[st.NewAssetID] = true
+		}
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range sel.linkedAssetIDs(entry) {
+		if !created[id] && !jr.createdInRun(id) && sel.wanted(id) {
+			ids = append(ids, id)
+			seen[id] = true
+		}
+	}
+	for _, st := range states {
+		if !seen[st.OldAssetID] && st.Step < stepValidated {
+			ids = append(ids, st.OldAssetID)
+		}
+	}
+	return ids
+}
+
+// processAssetUpdate handles the complete asset replacement workflow for update mode.
+// A row's replacement file stands in for the primary locale's current file. Other entries
+// linking the old asset are relinked before it is retired, or, with the refuse referrers
+// policy, the asset is not replaced at all.
+// Each completed step is recorded in the journal; when resuming, steps the journal
+// already holds are skipped.
+func processAssetUpdate(ctx context.Context, cfg runConfig, job rowJob, assetID string, entry contentful.Entry, asset contentful.Asset, successW, failedW *rowWriter) {
+	client, sel, jr, conflicts := cfg.client, cfg.sel, cfg.jr, cfg.conflicts
+	entryID, rowNum, repl := job.entryID, job.rowNum, job.repl
+	progress, resuming := jr.state(entryID, assetID)
+
+	// Whether the old asset was published before the replacement, so rollback restores it as
+	// it was; a resumed replacement may have unpublished it already
+	oldPublished := asset.PublishedVersion != 0
+	if resuming {
+		oldPublished = !progress.OldAssetDraft
+	} else {
+		jr.record(journalRecord{EntryID: entryID, Step: stepStarted, OldAssetID: assetID, OldAssetDraft: !oldPublished})
+	}
+
+	// fail records a failed step in failed.csv and the journal
+	fail := func(step journalStep, newAssetID, msg string) {
+		_ = failedW.Write([]string{entryID, assetID, newAssetID, msg})
+		jr.record(journalRecord{EntryID: entryID, Step: step, OldAssetID: assetID, NewAssetID: newAssetID, Error: msg})
+	}
+
+	if progress.Step == stepFileReplaced {
+		warnf("row %d: entry %s asset %s was started with -strategy %s", rowNum, entryID, assetID, strategyInPlace)
+		_ = failedW.Write([]string{entryID, assetID, "", fmt.Sprintf("replacement was started with -strategy %s; resume it with the same strategy", strategyInPlace)})
 		return
 	}
 
-	// Then archive the old asset
-	archiveReq := contentful.ArchiveAssetRequest{
-		SpaceID:     spaceID,
-		Environment: environment,
-		AssetID:     assetID,
-		Version:     asset.Version,
-		HeaderName:  headerName,
-		Scheme:      scheme,
-		Token:       token,
+	// Refuse before creating anything when other entries would be left linking the retired asset
+	if cfg.referrers == referrersRefuse && progress.Step < stepOldUnpublished {
+		others, refStatus, err := otherReferrers(ctx, client, entryID, assetID, sel.linksTo(entry, assetID))
+		if err != nil {
+			warnf("row %d: find entries linking asset %s -> status %d: %v", rowNum, assetID, refStatus, err)
+			fail(stepOldUnpublished, progress.NewAssetID, fmt.Sprintf("find referring entries: %v", err))
+			return
+		}
+		if len(others) > 0 {
+			warnf("row %d: asset %s is also linked by %d other entries, not replacing it", rowNum, assetID, len(others))
+			fail(stepOldUnpublished, progress.NewAssetID, fmt.Sprintf("asset is also linked by %s; not replaced (pass -referrers %s to relink them)", describeReferrers(others), referrersRelink))
+			return
+		}
+	}
+
+	newAssetID, digests := progress.NewAssetID, progress.Digests
+	if progress.Step < stepAssetCreated {
+		files, ok := downloadAssetFiles(ctx, cfg, job, assetID, asset, progress, fail)
+		if !ok {
+			return
+		}
+
+		// Create a new asset from the downloaded files BEFORE unpublishing the old asset, and
+		// record its ID at once so a resumed run picks it up instead of creating another
+		createReq := contentful.CreateAssetRequest{
+			Asset:             files.applyTo(repl.apply(asset)),
+			Locale:            asset.Locale,
+			FilePaths:         files.paths,
+			Uploads:           files.uploads,
+			OriginalCreatedAt: asset.CreatedAt,
+		}
+		nid, createStatus, cerr := client.CreateAsset(ctx, createReq)
+		if cerr != nil {
+			warnf("row %d: create new asset from file -> status %d: %v", rowNum, createStatus, cerr)
+			fail(stepAssetCreated, "", fmt.Sprintf("create new asset: %v", cerr))
+			return
+		}
+		newAssetID, digests = nid, files.digests
+		jr.record(journalRecord{EntryID: entryID, Step: stepAssetCreated, OldAssetID: assetID, NewAssetID: newAssetID, Digests: digests})
 	}
-	archiveStatus, err := contentful.ArchiveAsset(ctx, client, archiveReq)
+	if progress.Step < stepAssetPublished {
+		if _, pubStatus, err := client.ProcessAndPublishAsset(ctx, contentful.ProcessAndPublishAssetRequest{AssetID: newAssetID}); err != nil {
+			warnf("row %d: process and publish new asset %s -> status %d: %v", rowNum, newAssetID, pubStatus, err)
+			fail(stepAssetPublished, newAssetID, fmt.Sprintf("publish new asset: %v", err))
+			return
+		}
+
+		// Make sure the new asset serves the bytes that were uploaded
+		if verifyStatus, err := verifyAssetFiles(ctx, client, newAssetID, asset.Locale, digests); err != nil {
+			warnf("row %d: verify new asset %s -> status %d: %v", rowNum, newAssetID, verifyStatus, err)
+			msg := fmt.Sprintf("verify new asset: %v", err)
+			if !errors.Is(err, errChecksumMismatch) {
+				fail(stepAssetPublished, newAssetID, msg)
+				return
+			}
+			// Retire the published asset with the wrong file, then start the replacement over
+			// on the next run; until it is retired, a resumed run verifies it again
+			if rerr := retireAsset(ctx, client, conflicts, newAssetID, rowNum); rerr != nil {
+				fail(stepAssetPublished, newAssetID, fmt.Sprintf("%s; retire new asset: %v", msg, rerr))
+				return
+			}
+			fail(stepAssetPublished, newAssetID, msg+"; new asset archived")
+			jr.record(journalRecord{EntryID: entryID, Step: stepStarted, OldAssetID: assetID, OldAssetDraft: !oldPublished})
+			return
+		}
+		jr.record(journalRecord{EntryID: entryID, Step: stepAssetPublished, OldAssetID: assetID, NewAssetID: newAssetID})
+	}
+
+	// From here on the row changes entries: lock its own entry, and when relinking the other
+	// entries linking the old asset, and read the entry again at its current version
+	relink := cfg.referrers == referrersRelink && progress.Step < stepOldUnpublished
+	entry, others, unlock, lockStatus, err := lockEntries(ctx, cfg, entryID, assetID, relink)
 	if err != nil {
-		warnf("row %d: archive asset %s -> status %d: %v", rowNum, assetID, archiveStatus, err)
-		_ = failedW.Write([]string{entryID, assetID, newAssetID, fmt.Sprintf("archive old asset: %v", err)})
+		warnf("row %d: entry %s asset %s -> status %d: %v", rowNum, entryID, assetID, lockStatus, err)
+		fail(stepOldUnpublished, newAssetID, err.Error())
 		return
 	}
+	defer unlock()
 
-	// Patch the entry to point to the new asset, then publish
-	if newAssetID != "" {
-		patchReq := contentful.PatchEntryAssetLinkRequest{
-			SpaceID:     spaceID,
-			Environment: environment,
-			EntryID:     entryID,
-			FieldKey:    "downloadableFile",
-			Locale:      "en-US",
-			NewAssetID:  newAssetID,
-			Version:     entry.Version,
-			HeaderName:  headerName,
-			Scheme:      scheme,
-			Token:       token,
-		}
-		newVersion, updStatus, uerr := contentful.PatchEntryAssetLink(ctx, client, patchReq)
-		if uerr != nil {
-			warnf("row %d: patch entry %s -> status %d: %v", rowNum, entryID, updStatus, uerr)
-			_ = failedW.Write([]string{entryID, assetID, newAssetID, fmt.Sprintf("patch entry: %v", uerr)})
+	// Relink other entries, and the entry's own links outside the selection, to the new asset
+	// so none is left linking the retired one
+	if relink {
+		if err := relinkReferrers(ctx, cfg, others, entryID, assetID, newAssetID, oldPublished, rowNum, successW); err != nil {
+			fail(stepOldUnpublished, newAssetID, err.Error())
 			return
 		}
-		publishReq := contentful.PublishEntryRequest{
-			SpaceID:     spaceID,
-			Environment: environment,
-			EntryID:     entryID,
-			Version:     newVersion,
-			HeaderName:  headerName,
-			Scheme:      scheme,
-			Token:       token,
-		}
-		if pubStatus, perr := contentful.PublishEntry(ctx, client, publishReq); perr != nil {
-			warnf("row %d: publish entry %s -> status %d: %v", rowNum, entryID, pubStatus, perr)
-			_ = failedW.Write([]string{entryID, assetID, newAssetID, fmt.Sprintf("publish entry: %v", perr)})
+		if slices.ContainsFunc(others, func(ref contentful.Entry) bool { return ref.ID == entryID }) {
+			var entryStatus int
+			if entry, entryStatus, err = client.FetchEntry(ctx, sel.fetchEntryReq(entryID)); err != nil {
+				warnf("row %d: fetch entry %s -> status %d: %v", rowNum, entryID, entryStatus, err)
+				fail(stepOldUnpublished, newAssetID, fmt.Sprintf("fetch entry: %v", err))
+				return
+			}
+		}
+	}
+
+	// Unpublish the old asset first, unless it is a draft. A resumed run may also find it
+	// already unpublished if the process died before the journal caught up.
+	archiveVersion := asset.Version
+	if progress.Step < stepOldUnpublished && asset.PublishedVersion != 0 {
+		unpublishReq := contentful.UnpublishAssetRequest{
+			AssetID: assetID,
+			Version: asset.Version,
+		}
+		unpublishedVersion, unpublishStatus, err := unpublishAsset(ctx, client, conflicts, unpublishReq, asset)
+		if err != nil {
+			warnf("row %d: unpublish asset %s -> status %d: %v", rowNum, assetID, unpublishStatus, err)
+			fail(stepOldUnpublished, newAssetID, fmt.Sprintf("unpublish old asset: %v", err))
+			return
+		}
+		archiveVersion = unpublishedVersion
+		jr.record(journalRecord{EntryID: entryID, Step: stepOldUnpublished, OldAssetID: assetID})
+	}
+
+	// Then archive the old asset using the version produced by unpublishing
+	if progress.Step < stepOldArchived && !(resuming && asset.ArchivedAt != "") {
+		archiveReq := contentful.ArchiveAssetRequest{
+			AssetID: assetID,
+			Version: archiveVersion,
+		}
+		archiveStatus, err := archiveAsset(ctx, client, conflicts, archiveReq, asset)
+		if err != nil {
+			warnf("row %d: archive asset %s -> status %d: %v", rowNum, assetID, archiveStatus, err)
+			fail(stepOldArchived, newAssetID, fmt.Sprintf("archive old asset: %v", err))
 			return
 		}
+		jr.record(journalRecord{EntryID: entryID, Step: stepOldArchived, OldAssetID: assetID})
+	}
+
+	// Patch every selected link to the old asset to point to the new asset, then publish.
+	// A resumed entry whose links were already patched has none left to change.
+	if newAssetID != "" {
+		entryVersion := entry.Version
+		patchedLinks := sel.linksTo(entry, newAssetID) // a resumed entry may already link the new asset
+		if oldLinks := sel.linksTo(entry, assetID); progress.Step < stepEntryPatched && len(oldLinks) > 0 {
+			patchReq := contentful.PatchEntryAssetLinkRequest{
+				EntryID:    entryID,
+				Links:      oldLinks,
+				NewAssetID: newAssetID,
+				Version:    entry.Version,
+			}
+			newVersion, updStatus, uerr := patchEntryLinks(ctx, client, conflicts, patchReq, assetID, true)
+			if uerr != nil {
+				warnf("row %d: patch entry %s -> status %d: %v", rowNum, entryID, updStatus, uerr)
+				fail(stepEntryPatched, newAssetID, fmt.Sprintf("patch entry: %v", uerr))
+				return
+			}
+			entryVersion = newVersion
+			patchedLinks = oldLinks
+			jr.record(journalRecord{EntryID: entryID, Step: stepEntryPatched, OldAssetID: assetID})
+		}
+		if progress.Step < stepEntryPublished {
+			publishReq := contentful.PublishEntryRequest{
+				EntryID: entryID,
+				Version: entryVersion,
+			}
+			if pubStatus, perr := publishEntryLinks(ctx, client, conflicts, publishReq, patchedLinks, newAssetID); perr != nil {
+				warnf("row %d: publish entry %s -> status %d: %v", rowNum, entryID, pubStatus, perr)
+				fail(stepEntryPublished, newAssetID, fmt.Sprintf("publish entry: %v", perr))
+				return
+			}
+			jr.record(journalRecord{EntryID: entryID, Step: stepEntryPublished, OldAssetID: assetID})
+		}
 
 		// Validate that the published entry contains the new asset ID
-		if validateAssetReplacement(ctx, client, entryID, newAssetID, spaceID, environment, headerName, scheme, token, rowNum, successW, failedW, assetID) {
+		if validateAssetReplacement(ctx, client, entryID, newAssetID, rowNum, sel, successW, failedW, assetID, oldPublished) {
+			jr.record(journalRecord{EntryID: entryID, Step: stepValidated, OldAssetID: assetID, Error: "validation failed"})
 			return
 		}
+		jr.record(journalRecord{EntryID: entryID, Step: stepValidated, OldAssetID: assetID})
+		cfg.staging.cleanup(assetID, rowNum, repl)
 	} else {
-		_ = failedW.Write([]string{entryID, assetID, newAssetID, "missing new asset id"})
+		fail(stepAssetCreated, newAssetID, "missing new asset id")
 		return
 	}
 }
 
+// downloadAssetFiles downloads every localized file of the asset, or takes the row's
+// replacement for its primary locale, and returns the files with their SHA-256 per locale.
+// With staging.stream, downloads are piped straight into uploads instead of saved; with
+// staging.fixTypes, files labelled with the wrong content type are relabelled. Files
+// from an interrupted run are reused. Failures are reported through fail.
+func downloadAssetFiles(ctx context.Context, cfg runConfig, job rowJob, assetID string, asset contentful.Asset, progress journalState, fail func(step journalStep, newAssetID, msg string)) (stagedFiles, bool) {
+	client, staging, jr := cfg.client, cfg.staging, cfg.jr
+	entryID, rowNum, repl := job.entryID, job.rowNum, job.repl
+	// Reuse files from an interrupted run
+	var earlierPaths map[string]string
+	if progress.Step >= stepDownloaded {
+		earlierPaths = progress.SavedPaths
+	}
+	fileLocales := replacedFileLocales(asset, repl)
+	if len(fileLocales) == 0 || (!repl.hasFile() && strings.TrimSpace(asset.FileURL) == "") {
+		fail(stepDownloaded, "", "asset has empty file URL")
+		return stagedFiles{}, false
+	}
+	files := stagedFiles{
+		paths:   make(map[string]string, len(fileLocales)),
+		uploads: make(map[string]contentful.UploadedFile),
+		digests: make(map[string]string, len(fileLocales)),
+	}
+	downloaded := false
+	for _, locale := range fileLocales {
+		if p := earlierPaths[locale]; fileExists(p) {
+			sum, err := fileSHA256(p)
+			if err != nil {
+				fail(stepDownloaded, "", fmt.Sprintf("read %s file: %v", locale, err))
+				return stagedFiles{}, false
+			}
+			files.paths[locale], files.digests[locale] = p, sum
+			continue
+		}
+		if locale == asset.Locale && repl.file != "" {
+			if !fileExists(repl.file) {
+				warnf("row %d: replacement file %s not found", rowNum, repl.file)
+				fail(stepDownloaded, "", fmt.Sprintf("replacement file %s not found", repl.file))
+				return stagedFiles{}, false
+			}
+			sum, err := fileSHA256(repl.file)
+			if err != nil {
+				fail(stepDownloaded, "", fmt.Sprintf("read replacement file: %v", err))
+				return stagedFiles{}, false
+			}
+			files.paths[locale], files.digests[locale] = repl.file, sum
+			downloaded = true
+			continue
+		}
+		// Each asset and locale gets its own directory so concurrent workers never write the same path
+		downloadReq := contentful.DownloadAssetRequest{
+			Asset:   asset.InLocale(locale),
+			DestDir: filepath.Join(downloadDir(assetID), locale),
+		}
+		if locale == asset.Locale && repl.url != "" {
+			downloadReq.Asset = repl.urlSource(downloadReq.Asset)
+			downloadReq.DestDir = filepath.Join(downloadDir(assetID), "replacement")
+		}
+		if staging.stream {
+			streamReq := contentful.StreamAssetFileRequest{Asset: downloadReq.Asset}
+			if staging.spool {
+				streamReq.SpoolDir = downloadReq.DestDir
+			}
+			uploaded, _, serr := client.StreamAssetFile(ctx, streamReq)
+			if serr != nil {
+				warnf("row %d: stream asset file (%s): %v", rowNum, locale, serr)
+				fail(stepDownloaded, "", fmt.Sprintf("stream %s file: %v", locale, serr))
+				return stagedFiles{}, false
+			}
+			files.uploads[locale], files.digests[locale] = uploaded, uploaded.SHA256
+			continue
+		}
+		file, _, derr := client.DownloadAssetFile(ctx, downloadReq)
+		if derr != nil {
+			warnf("row %d: download asset file (%s): %v", rowNum, locale, derr)
+			fail(stepDownloaded, "", fmt.Sprintf("download %s file: %v", locale, derr))
+			return stagedFiles{}, false
+		}
+		files.paths[locale], files.digests[locale] = file.Path, file.SHA256
+		downloaded = true
+	}
+	// Streamed files are not on disk for a resumed run to reuse
+	if downloaded {
+		jr.record(journalRecord{EntryID: entryID, Step: stepDownloaded, OldAssetID: assetID, SavedPaths: files.paths})
+	}
+
+	// The journal keeps the original files, so a resumed run transforms them again
+	if staging.transform != nil {
+		transformed, err := staging.transformImages(assetID, asset, repl, files)
+		if err != nil {
+			warnf("row %d: %v", rowNum, err)
+			fail(stepDownloaded, "", err.Error())
+			return stagedFiles{}, false
+		}
+		files = transformed
+	}
+	if staging.fixTypes {
+		corrected, err := staging.correctContentTypes(rowNum, asset, repl, files)
+		if err != nil {
+			warnf("row %d: %v", rowNum, err)
+			fail(stepDownloaded, "", err.Error())
+			return stagedFiles{}, false
+		}
+		files = corrected
+	}
+	return files, true
+}
+
+// fileExists reports whether path names an existing regular file
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
 // processArchivedList handles checking if assets are archived
-func processArchivedList(assetID string, asset contentful.Asset, successW *csv.Writer) {
+func processArchivedList(assetID string, asset contentful.Asset, successW *rowWriter) {
 	isArchived := "false"
 	archivedAt := ""
 
@@ -472,17 +1269,12 @@ func processArchivedList(assetID string, asset contentful.Asset, successW *csv.W
 }
 
 // processPublishEntry handles publishing an entry
-func processPublishEntry(ctx context.Context, client *http.Client, entryID string, entry contentful.Entry, spaceID, environment, headerName, scheme, token string, rowNum int, successW, failedW *csv.Writer) {
+func processPublishEntry(ctx context.Context, client *contentful.Client, entryID string, entry contentful.Entry, rowNum int, successW, failedW *rowWriter) {
 	publishReq := contentful.PublishEntryRequest{
-		SpaceID:     spaceID,
-		Environment: environment,
-		EntryID:     entryID,
-		Version:     entry.Version,
-		HeaderName:  headerName,
-		Scheme:      scheme,
-		Token:       token,
-	}
-	if pubStatus, perr := contentful.PublishEntry(ctx, client, publishReq); perr != nil {
+		EntryID: entryID,
+		Version: entry.Version,
+	}
+	if pubStatus, perr := client.PublishEntry(ctx, publishReq); perr != nil {
 		warnf("row %d: publish entry %s -> status %d: %v", rowNum, entryID, pubStatus, perr)
 		_ = failedW.Write([]string{entryID, fmt.Sprintf("publish entry: %v", perr)})
 		return
@@ -492,33 +1284,28 @@ func processPublishEntry(ctx context.Context, client *http.Client, entryID strin
 	_ = successW.Write([]string{entryID, fmt.Sprintf("%d", entry.Version), fmt.Sprintf("%d", entry.Version+1)})
 }
 
-// validateAssetReplacement validates that the published entry contains the expected new asset ID
+// validateAssetReplacement validates that every selected link of the published entry points at the expected new asset ID
 // Returns true if validation failed and processing should continue to next iteration
-func validateAssetReplacement(ctx context.Context, client *http.Client, entryID, newAssetID, spaceID, environment, headerName, scheme, token string, rowNum int, successW, failedW *csv.Writer, oldAssetID string) bool {
-	validateEntryReq := contentful.FetchEntryRequest{
-		SpaceID:     spaceID,
-		Environment: environment,
-		EntryID:     entryID,
-		HeaderName:  headerName,
-		Scheme:      scheme,
-		Token:       token,
-	}
-	validatedEntry, validateStatus, verr := contentful.FetchEntry(ctx, client, validateEntryReq)
+func validateAssetReplacement(ctx context.Context, client *contentful.Client, entryID, newAssetID string, rowNum int, sel linkSelector, successW, failedW *rowWriter, oldAssetID string, oldPublished bool) bool {
+	validateEntryReq := sel.fetchEntryReq(entryID)
+	validatedEntry, validateStatus, verr := client.FetchEntry(ctx, validateEntryReq)
 	if verr != nil {
 		warnf("row %d: validate entry %s -> status %d: %v", rowNum, entryID, validateStatus, verr)
 		_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("validation fetch entry: %v", verr)})
 		return true
 	}
 
-	// Check if the validated entry contains the new asset ID
-	if validatedEntry.AssetID == newAssetID {
-		// Success: record entry_id, old asset id, and new asset id
-		_ = successW.Write([]string{entryID, oldAssetID, newAssetID})
+	// Check if the validated entry links the new asset and no longer links the old one
+	if len(sel.linksTo(validatedEntry, newAssetID)) > 0 && len(sel.linksTo(validatedEntry, oldAssetID)) == 0 {
+		// Success: record entry_id, old asset id, new asset id, that the entry was published
+		// and whether the old asset was
+		_ = successW.Write([]string{entryID, oldAssetID, newAssetID, "true", fmt.Sprintf("%t", oldPublished)})
 		return false
 	} else {
 		// Validation failed: the entry doesn't contain the expected new asset ID
-		warnf("row %d: validation failed for entry %s - expected asset %s but found %s", rowNum, entryID, newAssetID, validatedEntry.AssetID)
-		_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("validation failed: expected asset %s but found %s", newAssetID, validatedEntry.AssetID)})
+		found := strings.Join(sel.linkedAssetIDs(validatedEntry), ", ")
+		warnf("row %d: validation failed for entry %s - expected asset %s but found %s", rowNum, entryID, newAssetID, found)
+		_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("validation failed: expected asset %s but found %s", newAssetID, found)})
 		return true
 	}
 }
@@ -0,0 +1,945 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"contentful-asset-replacer/contentful"
+	"contentful-asset-replacer/contentful/contentfultest"
+)
+
+// runMainEnv makes the test binary run main instead of the tests; runTool sets it when it
+// starts the tool against a fake CMA
+const runMainEnv = "CONTENTFUL_ASSET_REPLACER_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// pdf is the content of the seeded documents
+var pdf = []byte("%PDF-1.4\n1 0 obj <<>> endobj\ntrailer <<>>\n%%EOF\n")
+
+// newSpace starts a fake CMA holding a published document entry "e1" linking the published
+// asset "old1" in downloadableFile
+func newSpace(t *testing.T) *contentfultest.Server {
+	t.Helper()
+	srv := contentfultest.NewServer("space", "master")
+	srv.Token = "token"
+	t.Cleanup(srv.Close)
+	srv.AddAsset(contentfultest.Asset{ID: "old1", Title: "Report", FileName: "report.pdf", ContentType: "application/pdf", Content: pdf, Published: true})
+	addDocument(srv, "e1", "old1")
+	return srv
+}
+
+// addDocument seeds a published entry linking assetID in downloadableFile
+func addDocument(srv *contentfultest.Server, entryID, assetID string) {
+	srv.AddEntry(contentfultest.Entry{
+		ID:            entryID,
+		ContentTypeID: "document",
+		Fields: map[string]any{
+			"title":            map[string]any{"en-US": "Document " + entryID},
+			"downloadableFile": map[string]any{"en-US": contentfultest.LinkAsset(assetID)},
+		},
+		Published: true,
+	})
+}
+
+// runTool runs the tool in dir against srv with args after the connection flags. The tool
+// is the test binary itself, running main.
+func runTool(t *testing.T, srv *contentfultest.Server, dir string, args ...string) {
+	t.Helper()
+	certPath := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(certPath, cert, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := []string{
+		"-space-id", srv.SpaceID,
+		"-environment", srv.Environment,
+		"-token", srv.Token,
+		"-base-url", srv.URL,
+		"-upload-url", srv.URL,
+		"-rate-limit", "0",
+		"-retry-delay", "1ms",
+	}
+	cmd := exec.Command(os.Args[0], append(conn, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), runMainEnv+"=1", "SSL_CERT_FILE="+certPath)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("run %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+}
+
+// writeFile writes content to name in dir
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readCSV returns the records of a CSV output in dir, without its header
+func readCSV(t *testing.T, dir, name string) [][]string {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return records[1:]
+}
+
+// readJSONL decodes every line of an NDJSON output in dir
+func readJSONL[T any](t *testing.T, dir, name string) []T {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []T
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var v T
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("decode %s line %q: %v", name, line, err)
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// journalSteps returns the steps the journal in dir records for an entry, failed ones
+// suffixed with "!"
+func journalSteps(t *testing.T, dir, entryID string) []string {
+	t.Helper()
+	var steps []string
+	for _, rec := range readJSONL[journalRecord](t, dir, "update_journal.jsonl") {
+		if rec.EntryID != entryID {
+			continue
+		}
+		step := rec.Step.String()
+		if rec.Error != "" {
+			step += "!"
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// reportRow is the part of a run report line the tests check
+type reportRow struct {
+	Type     string         `json:"type"`
+	Row      int            `json:"row"`
+	LastRow  int            `json:"last_row"`
+	Rows     int            `json:"rows"`
+	ID       string         `json:"id"`
+	Outcome  string         `json:"outcome"`
+	Errors   []string       `json:"errors"`
+	Outcomes map[string]int `json:"outcomes"`
+	Requests []struct {
+		Step   string `json:"step"`
+		Status int    `json:"status"`
+	} `json:"requests"`
+	Checksums []checksumRecord `json:"checksums"`
+}
+
+// reportRows returns the row records of the run report in dir, checking that it starts
+// with a run record and ends with a summary counting them
+func reportRows(t *testing.T, dir string) []reportRow {
+	t.Helper()
+	lines := readJSONL[reportRow](t, dir, "run_report.jsonl")
+	if len(lines) < 2 || lines[0].Type != "run" || lines[len(lines)-1].Type != "summary" {
+		t.Fatalf("run report does not start with a run record and end with a summary: %+v", lines)
+	}
+	rows := lines[1 : len(lines)-1]
+	counted, reported := 0, 0
+	for _, n := range lines[len(lines)-1].Outcomes {
+		counted += n
+	}
+	for _, row := range rows {
+		if row.Type == "batch" {
+			reported += row.Rows
+		} else {
+			reported++
+		}
+	}
+	if counted != reported {
+		t.Errorf("summary counts %d rows, report has %d", counted, reported)
+	}
+	return rows
+}
+
+// linkedAsset returns the asset the entry links in downloadableFile
+func linkedAsset(t *testing.T, srv *contentfultest.Server, entryID string) string {
+	t.Helper()
+	return linkedAssetIn(t, srv, entryID, "downloadableFile")
+}
+
+// linkedAssetIn returns the asset the entry links in fieldKey
+func linkedAssetIn(t *testing.T, srv *contentfultest.Server, entryID, fieldKey string) string {
+	t.Helper()
+	entry, ok := srv.Entry(entryID)
+	if !ok {
+		t.Fatalf("entry %s not found", entryID)
+	}
+	field, _ := entry.Fields[fieldKey].(map[string]any)
+	link, _ := field["en-US"].(map[string]any)
+	sys, _ := link["sys"].(map[string]any)
+	id, _ := sys["id"].(string)
+	return id
+}
+
+// wantCleanlyPublished checks that the entry is published with nothing pending
+func wantCleanlyPublished(t *testing.T, srv *contentfultest.Server, entryID string) {
+	t.Helper()
+	entry, _ := srv.Entry(entryID)
+	if !entry.Published || entry.Version != entry.PublishedVersion+1 {
+		t.Errorf("entry %s is not published without pending changes: version %d, published version %d", entryID, entry.Version, entry.PublishedVersion)
+	}
+}
+
+// wantRetired checks that the asset is unpublished and archived
+func wantRetired(t *testing.T, srv *contentfultest.Server, assetID string) {
+	t.Helper()
+	asset, _ := srv.Asset(assetID)
+	if asset.Published || !asset.Archived {
+		t.Errorf("asset %s: published %v, archived %v; want unpublished and archived", assetID, asset.Published, asset.Archived)
+	}
+}
+
+func TestUpdateMode(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, srv *contentfultest.Server, dir string)
+		csv   string // id.csv; "entry_id\ne1\n" when empty
+		args  []string
+		check func(t *testing.T, srv *contentfultest.Server, dir string)
+	}{
+		{
+			name: "replaces the asset and relinks the entry",
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				success := readCSV(t, dir, "success.csv")
+				if len(success) != 1 || success[0][0] != "e1" || success[0][1] != "old1" {
+					t.Fatalf("success.csv = %v, want one line for e1 and old1", success)
+				}
+				newID := success[0][2]
+				if got := linkedAsset(t, srv, "e1"); got != newID {
+					t.Errorf("e1 links %s, want the new asset %s", got, newID)
+				}
+				wantCleanlyPublished(t, srv, "e1")
+				wantRetired(t, srv, "old1")
+				if asset, ok := srv.Asset(newID); !ok || !asset.Published {
+					t.Errorf("new asset %s is not published", newID)
+				}
+				if failed := readCSV(t, dir, "failed.csv"); len(failed) != 0 {
+					t.Errorf("failed.csv = %v, want no lines", failed)
+				}
+
+				wantSteps := []string{"started", "downloaded", "asset_created", "asset_published", "old_unpublished", "old_archived", "entry_patched", "entry_published", "validated"}
+				if got := journalSteps(t, dir, "e1"); !slices.Equal(got, wantSteps) {
+					t.Errorf("journal steps = %v, want %v", got, wantSteps)
+				}
+
+				rows := reportRows(t, dir)
+				if len(rows) != 1 || rows[0].ID != "e1" || rows[0].Outcome != outcomeSucceeded {
+					t.Fatalf("report rows = %+v, want e1 succeeded", rows)
+				}
+				var steps []string
+				for _, r := range rows[0].Requests {
+					steps = append(steps, r.Step)
+				}
+				for _, want := range []string{"fetch entry", "download file", "upload file", "create asset", "checksum file", "archive asset", "patch entry", "publish entry"} {
+					if !slices.Contains(steps, want) {
+						t.Errorf("report requests %v lack step %q", steps, want)
+					}
+				}
+			},
+		},
+		{
+			name: "refuses an asset other entries link",
+			setup: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				addDocument(srv, "e2", "old1")
+			},
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				failed := readCSV(t, dir, "failed.csv")
+				if len(failed) != 1 || failed[0][0] != "e1" || !strings.Contains(failed[0][3], "also linked by e2") {
+					t.Fatalf("failed.csv = %v, want e1 failing because e2 links the asset", failed)
+				}
+				if ids := srv.AssetIDs(); !slices.Equal(ids, []string{"old1"}) {
+					t.Errorf("assets = %v, want only old1", ids)
+				}
+				if asset, _ := srv.Asset("old1"); !asset.Published || asset.Archived {
+					t.Error("old1 was retired")
+				}
+				if rows := reportRows(t, dir); len(rows) != 1 || rows[0].Outcome != outcomeFailed || len(rows[0].Errors) != 1 {
+					t.Errorf("report rows = %+v, want e1 failed with one error", rows)
+				}
+			},
+		},
+		{
+			name: "relinks and republishes other entries with -referrers relink",
+			setup: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				addDocument(srv, "e2", "old1")
+			},
+			args: []string{"-referrers", "relink"},
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				success := readCSV(t, dir, "success.csv")
+				if len(success) != 2 || success[0][0] != "e2" || success[1][0] != "e1" || success[0][2] != success[1][2] {
+					t.Fatalf("success.csv = %v, want e2 then e1 relinked to one new asset", success)
+				}
+				for _, entryID := range []string{"e1", "e2"} {
+					if got := linkedAsset(t, srv, entryID); got != success[1][2] {
+						t.Errorf("%s links %s, want %s", entryID, got, success[1][2])
+					}
+					wantCleanlyPublished(t, srv, entryID)
+				}
+				wantRetired(t, srv, "old1")
+			},
+		},
+		{
+			name: "replaces the file in place once for every row linking the asset with -strategy in-place",
+			setup: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				addDocument(srv, "e2", "old1")
+			},
+			csv:  "entry_id\ne1\ne2\n",
+			args: []string{"-strategy", "in-place"},
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				want := [][]string{{"e1", "old1", "old1", "false", "true"}, {"e2", "old1", "old1", "false", "true"}}
+				if success := readCSV(t, dir, "success.csv"); !slices.EqualFunc(success, want, slices.Equal) {
+					t.Errorf("success.csv = %v, want %v", success, want)
+				}
+				if ids := srv.AssetIDs(); !slices.Equal(ids, []string{"old1"}) {
+					t.Errorf("assets = %v, want only old1", ids)
+				}
+				for _, entryID := range []string{"e1", "e2"} {
+					if got := linkedAsset(t, srv, entryID); got != "old1" {
+						t.Errorf("%s links %s, want old1", entryID, got)
+					}
+				}
+				if asset, _ := srv.Asset("old1"); !asset.Published || asset.Archived || asset.Version != asset.PublishedVersion+1 {
+					t.Errorf("old1: published %v, archived %v, version %d, published version %d; want republished", asset.Published, asset.Archived, asset.Version, asset.PublishedVersion)
+				}
+				replaced := 0
+				for _, req := range srv.Requests() {
+					if req == http.MethodPut+" /spaces/space/environments/master/assets/old1" {
+						replaced++
+					}
+				}
+				if replaced != 1 {
+					t.Errorf("old1 was updated %d times, want once", replaced)
+				}
+				if got, want := journalSteps(t, dir, "e1"), []string{"started", "downloaded", "file_replaced", "validated"}; !slices.Equal(got, want) {
+					t.Errorf("e1 journal steps = %v, want %v", got, want)
+				}
+				if got := journalSteps(t, dir, "e2"); !slices.Equal(got, []string{"validated"}) {
+					t.Errorf("e2 journal steps = %v, want validated only", got)
+				}
+			},
+		},
+		{
+			name: "resumes from the journaled new asset instead of creating another",
+			setup: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				srv.AddAsset(contentfultest.Asset{ID: "new1", Title: "Report", FileName: "report.pdf", ContentType: "application/pdf", Content: pdf})
+				sum := sha256.Sum256(pdf)
+				writeFile(t, dir, "update_journal.jsonl", strings.Join([]string{
+					`{"entry_id":"e1","step":"started","old_asset_id":"old1"}`,
+					`{"entry_id":"e1","step":"asset_created","old_asset_id":"old1","new_asset_id":"new1","sha256":{"en-US":"` + hex.EncodeToString(sum[:]) + `"}}`,
+				}, "\n")+"\n")
+			},
+			args: []string{"-resume"},
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				if ids := srv.AssetIDs(); !slices.Equal(ids, []string{"new1", "old1"}) {
+					t.Errorf("assets = %v, want old1 and new1 only", ids)
+				}
+				if got := linkedAsset(t, srv, "e1"); got != "new1" {
+					t.Errorf("e1 links %s, want new1", got)
+				}
+				if asset, _ := srv.Asset("new1"); !asset.Published {
+					t.Error("new1 is not published")
+				}
+				wantRetired(t, srv, "old1")
+				if success := readCSV(t, dir, "success.csv"); len(success) != 1 || success[0][2] != "new1" {
+					t.Errorf("success.csv = %v, want e1 relinked to new1", success)
+				}
+				got := journalSteps(t, dir, "e1")
+				if got[len(got)-1] != "validated" || slices.Contains(got[2:], "asset_created") {
+					t.Errorf("journal steps = %v, want the resumed run to go on from asset_created to validated", got)
+				}
+			},
+		},
+		{
+			name: "plans without changing anything with -dry-run",
+			args: []string{"-dry-run"},
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				var actions []string
+				for _, rec := range readCSV(t, dir, "plan.csv") {
+					if rec[0] != "2" || rec[1] != "e1" {
+						t.Errorf("plan line %v, want row 2 of e1", rec)
+					}
+					actions = append(actions, rec[2])
+				}
+				want := []string{"download_file", "create_asset", "publish_asset", "unpublish_asset", "archive_asset", "patch_entry", "publish_entry"}
+				if !slices.Equal(actions, want) {
+					t.Errorf("plan actions = %v, want %v", actions, want)
+				}
+				for _, req := range srv.Requests() {
+					if !strings.HasPrefix(req, http.MethodGet+" ") && !strings.HasPrefix(req, http.MethodHead+" ") {
+						t.Errorf("dry run sent %s", req)
+					}
+				}
+				if _, err := os.Stat(filepath.Join(dir, "success.csv")); err == nil {
+					t.Error("dry run wrote success.csv")
+				}
+				if _, err := os.Stat(filepath.Join(dir, "update_journal.jsonl")); err == nil {
+					t.Error("dry run wrote the journal")
+				}
+			},
+		},
+		{
+			name: "archives a new asset whose processed file fails the checksum",
+			setup: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				srv.CorruptProcessing(1)
+			},
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				failed := readCSV(t, dir, "failed.csv")
+				if len(failed) != 1 || failed[0][0] != "e1" || failed[0][2] == "" || !strings.Contains(failed[0][3], "checksum mismatch") || !strings.HasSuffix(failed[0][3], "new asset archived") {
+					t.Fatalf("failed.csv = %v, want e1 failing the checksum with its new asset archived", failed)
+				}
+				wantRetired(t, srv, failed[0][2])
+				if success := readCSV(t, dir, "success.csv"); len(success) != 0 {
+					t.Errorf("success.csv = %v, want no lines", success)
+				}
+				if got := linkedAsset(t, srv, "e1"); got != "old1" {
+					t.Errorf("e1 links %s, want it left on old1", got)
+				}
+				if asset, _ := srv.Asset("old1"); !asset.Published || asset.Archived {
+					t.Error("old1 was retired")
+				}
+				want := []string{"started", "downloaded", "asset_created", "asset_published!", "started"}
+				if got := journalSteps(t, dir, "e1"); !slices.Equal(got, want) {
+					t.Errorf("journal steps = %v, want %v", got, want)
+				}
+			},
+		},
+		{
+			name: "fails an in-place replacement whose processed file fails the checksum without republishing",
+			setup: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				srv.CorruptProcessing(1)
+			},
+			args: []string{"-strategy", "in-place"},
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				failed := readCSV(t, dir, "failed.csv")
+				if len(failed) != 1 || !strings.HasPrefix(failed[0][3], "verify replaced file: checksum mismatch") || !strings.Contains(failed[0][3], "published version is unchanged") {
+					t.Fatalf("failed.csv = %v, want e1 failing the checksum", failed)
+				}
+				if asset, _ := srv.Asset("old1"); !asset.Published || asset.Version == asset.PublishedVersion+1 {
+					t.Errorf("old1: published %v, version %d, published version %d; want the replaced file left in the draft", asset.Published, asset.Version, asset.PublishedVersion)
+				}
+				want := []string{"started", "downloaded", "file_replaced!"}
+				if got := journalSteps(t, dir, "e1"); !slices.Equal(got, want) {
+					t.Errorf("journal steps = %v, want %v", got, want)
+				}
+			},
+		},
+		{
+			name: "replays a failed streamed upload from the spool with -stream -spool",
+			setup: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				srv.AddFault(contentfultest.Fault{Method: http.MethodPost, PathSuffix: "/uploads", Status: http.StatusServiceUnavailable, Count: 1})
+			},
+			args: []string{"-stream", "-spool"},
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				success := readCSV(t, dir, "success.csv")
+				if len(success) != 1 {
+					t.Fatalf("success.csv = %v, want e1 replaced", success)
+				}
+				rows := reportRows(t, dir)
+				if len(rows) != 1 || len(rows[0].Checksums) != 1 || !rows[0].Checksums[0].Match {
+					t.Errorf("report rows = %+v, want the replayed upload's checksum matching", rows)
+				}
+				if entries, _ := os.ReadDir(filepath.Join(dir, "downloaded")); len(entries) != 0 {
+					t.Errorf("downloaded/ holds %d files, want the spool removed", len(entries))
+				}
+			},
+		},
+		{
+			name: "uploads the replacement file a header names",
+			setup: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				writeFile(t, dir, "new.pdf", "%PDF-1.7\nnew report\n%%EOF\n")
+			},
+			csv: "Entry_ID, Replacement_File ,title\ne1,new.pdf,New report\n",
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				success := readCSV(t, dir, "success.csv")
+				if len(success) != 1 || success[0][0] != "e1" {
+					t.Fatalf("success.csv = %v, want e1 replaced", success)
+				}
+				if asset, _, err := srv.Client().FetchAsset(context.Background(), contentful.FetchAssetRequest{AssetID: success[0][2]}); err != nil || asset.Title != "New report" || asset.FileName != "report.pdf" {
+					t.Errorf("new asset = %+v, %v; want report.pdf, as before, titled New report", asset, err)
+				}
+				want, err := fileSHA256(filepath.Join(dir, "new.pdf"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				rows := reportRows(t, dir)
+				if len(rows) != 1 || len(rows[0].Checksums) != 1 || rows[0].Checksums[0].Uploaded != want || !rows[0].Checksums[0].Match {
+					t.Errorf("report rows = %+v, want new.pdf uploaded with sha256 %s", rows, want)
+				}
+			},
+		},
+		{
+			name: "fails a row whose replacement file is missing",
+			csv:  "entry_id,replacement_file\ne1,missing.pdf\n",
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				failed := readCSV(t, dir, "failed.csv")
+				if len(failed) != 1 || failed[0][3] != "replacement file missing.pdf not found" {
+					t.Fatalf("failed.csv = %v, want e1 failing on the missing file", failed)
+				}
+				if ids := srv.AssetIDs(); !slices.Equal(ids, []string{"old1"}) {
+					t.Errorf("assets = %v, want only old1", ids)
+				}
+				if got := linkedAsset(t, srv, "e1"); got != "old1" {
+					t.Errorf("e1 links %s, want it left on old1", got)
+				}
+			},
+		},
+		{
+			name: "fails a row naming both a replacement file and URL",
+			setup: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				writeFile(t, dir, "new.pdf", "%PDF-1.7\n")
+			},
+			csv: "entry_id,replacement_file,replacement_url\ne1,new.pdf,https://example.com/new.pdf\n",
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				failed := readCSV(t, dir, "failed.csv")
+				if len(failed) != 1 || failed[0][0] != "e1" || !strings.Contains(failed[0][3], "mutually exclusive") {
+					t.Fatalf("failed.csv = %v, want e1 refused", failed)
+				}
+				if requests := srv.Requests(); len(requests) != 0 {
+					t.Errorf("requests = %v, want none for a refused row", requests)
+				}
+			},
+		},
+		{
+			name: "fails a row whose entry changed with -on-conflict fail",
+			setup: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				srv.AddFault(contentfultest.Fault{Method: http.MethodPatch, PathSuffix: "/entries/e1", Status: http.StatusConflict, Count: 1})
+			},
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				failed := readCSV(t, dir, "failed.csv")
+				if len(failed) != 1 || !strings.HasPrefix(failed[0][3], "patch entry:") {
+					t.Fatalf("failed.csv = %v, want e1 failing to patch", failed)
+				}
+				if got := linkedAsset(t, srv, "e1"); got != "old1" {
+					t.Errorf("e1 links %s, want it left on old1", got)
+				}
+				got := journalSteps(t, dir, "e1")
+				if got[len(got)-1] != "entry_patched!" {
+					t.Errorf("journal steps = %v, want a failed entry_patched last", got)
+				}
+			},
+		},
+		{
+			name: "retries a row whose entry changed with -on-conflict refetch",
+			setup: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				srv.AddFault(contentfultest.Fault{Method: http.MethodPatch, PathSuffix: "/entries/e1", Status: http.StatusConflict, Count: 1})
+			},
+			args: []string{"-on-conflict", "refetch"},
+			check: func(t *testing.T, srv *contentfultest.Server, dir string) {
+				success := readCSV(t, dir, "success.csv")
+				if len(success) != 1 {
+					t.Fatalf("success.csv = %v, want e1 replaced", success)
+				}
+				if got := linkedAsset(t, srv, "e1"); got != success[0][2] {
+					t.Errorf("e1 links %s, want %s", got, success[0][2])
+				}
+				wantCleanlyPublished(t, srv, "e1")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv := newSpace(t)
+			dir := t.TempDir()
+			if tt.setup != nil {
+				tt.setup(t, srv, dir)
+			}
+			if tt.csv == "" {
+				tt.csv = "entry_id\ne1\n"
+			}
+			writeFile(t, dir, "id.csv", tt.csv)
+			runTool(t, srv, dir, append([]string{"-csv", "id.csv"}, tt.args...)...)
+			tt.check(t, srv, dir)
+		})
+	}
+}
+
+func TestRollbackMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string // rollback source: "success.csv" or the journal
+		draft  bool   // old1 is a draft when it is replaced
+		faults []contentfultest.Fault
+		args   []string
+	}{
+		{name: "from success.csv", input: "success.csv"},
+		{name: "from the journal", input: "update_journal.jsonl"},
+		{name: "draft old asset from success.csv", input: "success.csv", draft: true},
+		{name: "draft old asset from the journal", input: "update_journal.jsonl", draft: true},
+		{
+			name:  "old asset changed with -on-conflict refetch",
+			input: "success.csv",
+			faults: []contentfultest.Fault{
+				{Method: http.MethodDelete, PathSuffix: "/assets/old1/archived", Status: http.StatusConflict, Count: 1},
+				{Method: http.MethodPut, PathSuffix: "/assets/old1/published", Status: http.StatusConflict, Count: 1, Applied: true},
+			},
+			args: []string{"-on-conflict", "refetch"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv := newSpace(t)
+			if tt.draft {
+				client := srv.Client()
+				old, _, err := client.FetchAsset(context.Background(), contentful.FetchAssetRequest{AssetID: "old1"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, _, err := client.UnpublishAsset(context.Background(), contentful.UnpublishAssetRequest{AssetID: "old1", Version: old.Version}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dir := t.TempDir()
+			writeFile(t, dir, "id.csv", "entry_id\ne1\n")
+			runTool(t, srv, dir, "-csv", "id.csv")
+			success := readCSV(t, dir, "success.csv")
+			if wantPublished := strconv.FormatBool(!tt.draft); len(success) != 1 || success[0][4] != wantPublished {
+				t.Fatalf("update: success.csv = %v, want one line with old_asset_published %s", success, wantPublished)
+			}
+			newID := success[0][2]
+
+			for _, f := range tt.faults {
+				srv.AddFault(f)
+			}
+			runTool(t, srv, dir, append([]string{"-mode", "rollback", "-csv", tt.input, "-retire-new"}, tt.args...)...)
+			rolledBack := readCSV(t, dir, "rollback_success.csv")
+			want := []string{"e1", "old1", newID, "true"}
+			if len(rolledBack) != 1 || !slices.Equal(rolledBack[0], want) {
+				t.Fatalf("rollback_success.csv = %v, want %v", rolledBack, want)
+			}
+			if got := linkedAsset(t, srv, "e1"); got != "old1" {
+				t.Errorf("e1 links %s, want old1", got)
+			}
+			wantCleanlyPublished(t, srv, "e1")
+			if asset, _ := srv.Asset("old1"); asset.Published == tt.draft || asset.Archived {
+				t.Errorf("old1: published %v, archived %v; want it restored as it was before the update, published %v", asset.Published, asset.Archived, !tt.draft)
+			}
+			wantRetired(t, srv, newID)
+		})
+	}
+}
+
+func TestRollbackModeRevertsRelinkedReferrers(t *testing.T) {
+	srv := newSpace(t)
+	// e2 links old1 outside the selected field, and e3 is a draft
+	srv.AddEntry(contentfultest.Entry{
+		ID:            "e2",
+		ContentTypeID: "page",
+		Fields:        map[string]any{"image": map[string]any{"en-US": contentfultest.LinkAsset("old1")}},
+		Published:     true,
+	})
+	srv.AddEntry(contentfultest.Entry{
+		ID:            "e3",
+		ContentTypeID: "document",
+		Fields:        map[string]any{"downloadableFile": map[string]any{"en-US": contentfultest.LinkAsset("old1")}},
+	})
+	dir := t.TempDir()
+	writeFile(t, dir, "id.csv", "entry_id\ne1\n")
+	runTool(t, srv, dir, "-csv", "id.csv", "-referrers", "relink")
+
+	published := make(map[string]string)
+	newID := ""
+	for _, rec := range readCSV(t, dir, "success.csv") {
+		published[rec[0]] = rec[3]
+		newID = rec[2]
+	}
+	if want := map[string]string{"e1": "true", "e2": "true", "e3": "false"}; !maps.Equal(published, want) {
+		t.Fatalf("success.csv entry_published = %v, want %v", published, want)
+	}
+	if got := linkedAssetIn(t, srv, "e2", "image"); got != newID {
+		t.Errorf("e2 links %s, want %s", got, newID)
+	}
+	if entry, _ := srv.Entry("e3"); entry.Published {
+		t.Error("draft e3 was published")
+	}
+
+	runTool(t, srv, dir, "-mode", "rollback", "-csv", "success.csv")
+	if rolledBack := readCSV(t, dir, "rollback_success.csv"); len(rolledBack) != 3 {
+		t.Errorf("rollback_success.csv = %v, want e1, e2 and e3 rolled back", rolledBack)
+	}
+	if failed := readCSV(t, dir, "rollback_failed.csv"); len(failed) != 0 {
+		t.Errorf("rollback_failed.csv = %v, want no lines", failed)
+	}
+	for _, link := range []struct{ entryID, fieldKey string }{{"e1", "downloadableFile"}, {"e2", "image"}, {"e3", "downloadableFile"}} {
+		if got := linkedAssetIn(t, srv, link.entryID, link.fieldKey); got != "old1" {
+			t.Errorf("%s links %s in %s, want old1", link.entryID, got, link.fieldKey)
+		}
+	}
+	wantCleanlyPublished(t, srv, "e1")
+	wantCleanlyPublished(t, srv, "e2")
+	if entry, _ := srv.Entry("e3"); entry.Published {
+		t.Error("draft e3 was published by the rollback")
+	}
+	if asset, _ := srv.Asset("old1"); !asset.Published || asset.Archived {
+		t.Errorf("old1: published %v, archived %v; want published", asset.Published, asset.Archived)
+	}
+}
+
+func TestRollbackModeRefusesInPlaceRows(t *testing.T) {
+	srv := newSpace(t)
+	dir := t.TempDir()
+	writeFile(t, dir, "success.csv", "entry_id,old_asset_id,new_asset_id\ne1,old1,old1\n")
+	runTool(t, srv, dir, "-mode", "rollback", "-csv", "success.csv")
+
+	failed := readCSV(t, dir, "rollback_failed.csv")
+	if len(failed) != 1 || !strings.Contains(failed[0][3], "replaced in place") {
+		t.Errorf("rollback_failed.csv = %v, want e1 refused as replaced in place", failed)
+	}
+	if rows := reportRows(t, dir); len(rows) != 1 || rows[0].Outcome != outcomeFailed {
+		t.Errorf("report rows = %+v, want the row reported as failed", rows)
+	}
+}
+
+func TestListModes(t *testing.T) {
+	tests := []struct {
+		name         string
+		setup        func(srv *contentfultest.Server)
+		args         []string
+		csv          string
+		output       string
+		want         [][]string
+		wantNotFound [][]string
+		wantRows     int // rows in the batch
+	}{
+		{
+			name:         "list",
+			args:         []string{"-mode", "list"},
+			csv:          "entry_id\ne1\n \nmissing\n",
+			output:       "entry_asset_list.csv",
+			want:         [][]string{{"e1", "published", "old1", "downloadableFile", "en-US", "", ""}},
+			wantNotFound: [][]string{{"4", "Entry", "missing", ""}},
+			wantRows:     2,
+		},
+		{
+			name: "list with a missing linked asset",
+			setup: func(srv *contentfultest.Server) {
+				srv.AddEntry(contentfultest.Entry{
+					ID:            "e2",
+					ContentTypeID: "document",
+					Fields: map[string]any{
+						"downloadableFile": map[string]any{"en-US": []any{contentfultest.LinkAsset("gone"), contentfultest.LinkAsset("old1"), contentfultest.LinkAsset("gone")}},
+					},
+					Published: true,
+				})
+			},
+			args:         []string{"-mode", "list"},
+			csv:          "entry_id\ne2\n",
+			output:       "entry_asset_list.csv",
+			want:         [][]string{{"e2", "published", "old1", "downloadableFile", "en-US", "1", ""}},
+			wantNotFound: [][]string{{"2", "Asset", "gone", "e2"}},
+			wantRows:     1,
+		},
+		{
+			name:         "archived-list",
+			args:         []string{"-mode", "archived-list"},
+			csv:          "asset_id\nold1\ngone\n",
+			output:       "archived_asset_list.csv",
+			want:         [][]string{{"old1", "false", "", "Report"}},
+			wantNotFound: [][]string{{"3", "Asset", "gone", ""}},
+			wantRows:     2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv := newSpace(t)
+			if tt.setup != nil {
+				tt.setup(srv)
+			}
+			dir := t.TempDir()
+			writeFile(t, dir, "rows.csv", tt.csv)
+			runTool(t, srv, dir, append([]string{"-csv", "rows.csv"}, tt.args...)...)
+
+			got := readCSV(t, dir, tt.output)
+			if len(got) != len(tt.want) {
+				t.Fatalf("%s = %v, want %v", tt.output, got, tt.want)
+			}
+			for i, want := range tt.want {
+				if !slices.Equal(got[i][:len(want)], want) {
+					t.Errorf("%s line %d = %v, want %v", tt.output, i+1, got[i], want)
+				}
+			}
+			if notFound := readCSV(t, dir, "not_found.csv"); !slices.EqualFunc(notFound, tt.wantNotFound, slices.Equal) {
+				t.Errorf("not_found.csv = %v, want %v", notFound, tt.wantNotFound)
+			}
+			if rows := reportRows(t, dir); len(rows) != 1 || rows[0].Type != "batch" || rows[0].Outcome != outcomePartial || rows[0].Rows != tt.wantRows {
+				t.Errorf("report rows = %+v, want one partial batch of %d rows", rows, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestAssetQueryNarrowsCSVRows(t *testing.T) {
+	tests := []struct {
+		mode   string
+		output string
+	}{
+		{mode: "list", output: "entry_asset_list.csv"},
+		{mode: "publish", output: "publish_success.csv"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			t.Parallel()
+			srv := newSpace(t)
+			// e2 and e3 link an image, but only e1 and e2 are in the CSV
+			srv.AddAsset(contentfultest.Asset{ID: "img1", FileName: "photo.png", ContentType: "image/png", Content: []byte("\x89PNG\r\n\x1a\n"), Published: true})
+			addDocument(srv, "e2", "img1")
+			addDocument(srv, "e3", "img1")
+			dir := t.TempDir()
+			writeFile(t, dir, "id.csv", "entry_id\ne1\ne2\n")
+			runTool(t, srv, dir, "-mode", tt.mode, "-csv", "id.csv", "-asset-query", "mimetype_group=image")
+
+			got := readCSV(t, dir, tt.output)
+			if len(got) != 1 || got[0][0] != "e2" {
+				t.Errorf("%s = %v, want only e2", tt.output, got)
+			}
+		})
+	}
+}
+
+func TestContentTypeAuditMode(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+	srv := newSpace(t)
+	srv.AddAsset(contentfultest.Asset{ID: "img1", FileName: "photo.png", ContentType: "application/octet-stream", Content: png, Published: true})
+	addDocument(srv, "e2", "img1")
+	dir := t.TempDir()
+	writeFile(t, dir, "id.csv", "entry_id\ne1\ne2\n")
+	runTool(t, srv, dir, "-mode", "content-type-audit", "-csv", "id.csv")
+
+	want := [][]string{
+		{"e1", "old1", "en-US", "report.pdf", "application/pdf", "application/pdf", auditMatch},
+		{"e2", "img1", "en-US", "photo.png", "application/octet-stream", "image/png", auditMismatch},
+	}
+	got := readCSV(t, dir, "content_type_audit.csv")
+	slices.SortFunc(got, func(a, b []string) int { return strings.Compare(a[0], b[0]) })
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("content_type_audit.csv = %v, want %v", got, want)
+	}
+}
+
+func TestRowWriterConcurrentWrites(t *testing.T) {
+	const (
+		workers   = 8
+		perWorker = 50
+	)
+	var buf strings.Builder
+	rw := newRowWriter(&buf)
+	var noted atomic.Int64
+	observed := rw.observed(func([]string) { noted.Add(1) })
+
+	// Each worker writes single records, through the observed writer every other time, and
+	// blocks of three that must stay together. Fields hold commas, quotes and newlines.
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				record := []string{fmt.Sprintf("w%d", w), strconv.Itoa(i), "a, \"quoted\"\nvalue"}
+				writer := rw
+				if i%2 == 1 {
+					writer = observed
+				}
+				if err := writer.Write(record); err != nil {
+					t.Error(err)
+				}
+				block := [][]string{
+					{fmt.Sprintf("w%d", w), strconv.Itoa(i), "block 1"},
+					{fmt.Sprintf("w%d", w), strconv.Itoa(i), "block 2"},
+					{fmt.Sprintf("w%d", w), strconv.Itoa(i), "block 3"},
+				}
+				if err := rw.WriteAll(block); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	rw.Flush()
+
+	records, err := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v", err)
+	}
+	if want := workers * perWorker * 4; len(records) != want {
+		t.Fatalf("got %d records, want %d", len(records), want)
+	}
+	if got, want := noted.Load(), int64(workers*perWorker/2); got != want {
+		t.Errorf("observed writer noted %d records, want %d", got, want)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < len(records); i++ {
+		rec := records[i]
+		key := rec[0] + "/" + rec[1]
+		if rec[2] == "block 1" {
+			if i+2 >= len(records) || !slices.Equal(records[i+1], []string{rec[0], rec[1], "block 2"}) || !slices.Equal(records[i+2], []string{rec[0], rec[1], "block 3"}) {
+				t.Fatalf("block of %s is split at record %d", key, i)
+			}
+			i += 2
+			continue
+		}
+		if rec[2] != "a, \"quoted\"\nvalue" {
+			t.Fatalf("record %d = %q, want its fields intact", i, rec)
+		}
+		if seen[key] {
+			t.Errorf("record %s written twice", key)
+		}
+		seen[key] = true
+	}
+}
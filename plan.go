@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// planHeader is the header of plan.csv. Each row lists one change a mutating mode would
+// make; target_id is empty for assets that do not exist yet.
+var planHeader = []string{"row", "entry_id", "action", "target_type", "target_id", "current_version", "detail"}
+
+// plan collects the planned actions for one CSV row
+type plan struct {
+	rowNum  int
+	entryID string
+	actions [][]string
+}
+
+func (p *plan) add(action, targetType, targetID string, currentVersion int, detail string) {
+	version := ""
+	if currentVersion > 0 {
+		version = strconv.Itoa(currentVersion)
+	}
+	p.actions = append(p.actions, []string{strconv.Itoa(p.rowNum), p.entryID, action, targetType, targetID, version, detail})
+}
+
+// write emits the row's actions as one contiguous block
+func (p *plan) write(planW *rowWriter) {
+	if len(p.actions) == 0 {
+		p.add("none", "entry", p.entryID, 0, "nothing to change")
+	}
+	_ = planW.WriteAll(p.actions)
+}
+
+// planAssetUpdate describes what processAssetUpdate, or processAssetInPlace for the in-place
+// strategy, would do for the row, honouring journal progress when resuming. File URLs are
+// checked with a HEAD request and a replacement file with a stat.
+func planAssetUpdate(ctx context.Context, cfg runConfig, job rowJob, assetID string, entry contentful.Entry, asset contentful.Asset, planW, failedW *rowWriter) {
+	client, sel, jr := cfg.client, cfg.sel, cfg.jr
+	entryID, rowNum, repl := job.entryID, job.rowNum, job.repl
+	progress, resuming := jr.state(entryID, assetID)
+	p := &plan{rowNum: rowNum, entryID: entryID}
+
+	inPlace := cfg.strategy == strategyInPlace
+
+	// Other entries linking the old asset are relinked before it is retired, or block the replacement
+	var others []contentful.Entry
+	if !inPlace && progress.Step < stepOldUnpublished {
+		var refStatus int
+		var err error
+		others, refStatus, err = otherReferrers(ctx, client, entryID, assetID, sel.linksTo(entry, assetID))
+		if err != nil {
+			warnf("row %d: find entries linking asset %s -> status %d: %v", rowNum, assetID, refStatus, err)
+			_ = failedW.Write([]string{entryID, assetID, "", fmt.Sprintf("find referring entries: %v", err)})
+			return
+		}
+		if len(others) > 0 && cfg.referrers == referrersRefuse {
+			warnf("row %d: asset %s is also linked by %d other entries, not replacing it", rowNum, assetID, len(others))
+			_ = failedW.Write([]string{entryID, assetID, "", fmt.Sprintf("asset is also linked by %s; not replaced (pass -referrers %s to relink them)", describeReferrers(others), referrersRelink)})
+			return
+		}
+	}
+
+	newAsset := "(new asset)"
+	if progress.Step >= stepAssetCreated {
+		newAsset = progress.NewAssetID
+		if progress.Step < stepAssetPublished {
+			p.add("publish_asset", "asset", newAsset, 0, "process and publish the asset created in an earlier run")
+		}
+	} else if !inPlace || progress.Step < stepFileReplaced {
+		if inPlace && asset.ArchivedAt != "" {
+			_ = failedW.Write([]string{entryID, assetID, "", "asset is archived; unarchive it before replacing its file in place"})
+			return
+		}
+		var earlierPaths map[string]string
+		if progress.Step >= stepDownloaded {
+			earlierPaths = progress.SavedPaths
+		}
+		fileLocales := replacedFileLocales(asset, repl)
+		if len(fileLocales) == 0 {
+			_ = failedW.Write([]string{entryID, assetID, "", "asset has empty file URL"})
+			return
+		}
+		for _, locale := range fileLocales {
+			if fileExists(earlierPaths[locale]) {
+				continue
+			}
+			if locale == asset.Locale && repl.file != "" {
+				info, err := os.Stat(repl.file)
+				if err != nil || !info.Mode().IsRegular() {
+					warnf("row %d: replacement file %s not found", rowNum, repl.file)
+					_ = failedW.Write([]string{entryID, assetID, "", fmt.Sprintf("replacement file %s not found", repl.file)})
+					return
+				}
+				p.add("use_file", "asset", assetID, asset.Version, fmt.Sprintf("%s: %s (%d bytes)", locale, repl.file, info.Size()))
+				continue
+			}
+			localized := asset.InLocale(locale)
+			if locale == asset.Locale && repl.url != "" {
+				localized = repl.urlSource(localized)
+			}
+			size, headStatus, err := client.CheckAssetFile(ctx, localized)
+			if err != nil {
+				warnf("row %d: check asset file %s -> status %d: %v", rowNum, localized.FileURL, headStatus, err)
+				_ = failedW.Write([]string{entryID, assetID, "", fmt.Sprintf("check %s file: %v", locale, err)})
+				return
+			}
+			p.add("download_file", "asset", assetID, asset.Version, fmt.Sprintf("%s: %s (%s bytes)", locale, localized.FileURL, formatSize(size)))
+		}
+		meta := repl.apply(asset)
+		detail := fmt.Sprintf("title=%q fileName=%q contentType=%q locales=%s", meta.Title, meta.FileName, meta.ContentType, strings.Join(fileLocales, ","))
+		if inPlace {
+			p.add("update_asset", "asset", assetID, asset.Version, detail)
+			if asset.PublishedVersion != 0 {
+				p.add("publish_asset", "asset", assetID, asset.Version, "republish the asset once its processed files are verified")
+			}
+		} else {
+			p.add("create_asset", "asset", "", 0, detail)
+			p.add("publish_asset", "asset", "", 0, "publish the new asset once processed")
+		}
+	}
+	if inPlace {
+		// The entry keeps linking the same asset
+		p.write(planW)
+		return
+	}
+
+	for _, ref := range others {
+		if ref.ID == entryID {
+			p.add("patch_entry", "entry", ref.ID, ref.Version, fmt.Sprintf("links outside the selection %s: %s -> %s", describeLinks(ref.AssetLinks), assetID, newAsset))
+			continue
+		}
+		p.add("patch_entry", "entry", ref.ID, ref.Version, fmt.Sprintf("other referrer %s: %s -> %s", describeLinks(ref.AssetLinks), assetID, newAsset))
+		if republishable(ref) {
+			p.add("publish_entry", "entry", ref.ID, ref.Version, "other referrer")
+		}
+	}
+	if progress.Step < stepOldUnpublished && !(resuming && asset.PublishedVersion == 0) {
+		p.add("unpublish_asset", "asset", assetID, asset.Version, "")
+	}
+	if progress.Step < stepOldArchived && !(resuming && asset.ArchivedAt != "") {
+		p.add("archive_asset", "asset", assetID, asset.Version, "")
+	}
+	if oldLinks := sel.linksTo(entry, assetID); progress.Step < stepEntryPatched && len(oldLinks) > 0 {
+		p.add("patch_entry", "entry", entryID, entry.Version, fmt.Sprintf("%s: %s -> %s", describeLinks(oldLinks), assetID, newAsset))
+	}
+	if progress.Step < stepEntryPublished {
+		p.add("publish_entry", "entry", entryID, entry.Version, "")
+	}
+	p.write(planW)
+}
+
+// planPublishEntry describes what processPublishEntry would do for the row, with the entry's
+// status in the locale of its first selected link, or the first selected locale
+func planPublishEntry(entryID string, entry contentful.Entry, sel linkSelector, rowNum int, planW *rowWriter) {
+	p := &plan{rowNum: rowNum, entryID: entryID}
+	locale := sel.locales[0]
+	if links := sel.links(entry); len(links) > 0 {
+		locale = links[0].Locale
+	}
+	p.add("publish_entry", "entry", entryID, entry.Version, fmt.Sprintf("current %s status: %s", locale, entry.FieldStatus["*"][locale]))
+	p.write(planW)
+}
+
+// planRollback describes what processRollback would do for the row
+func planRollback(ctx context.Context, cfg runConfig, job rowJob, planW, failedW *rowWriter) {
+	client := cfg.client
+	entryID, oldAssetID, newAssetID := job.entryID, job.oldAssetID, job.newAssetID
+	rowNum := job.rowNum
+	p := &plan{rowNum: rowNum, entryID: entryID}
+
+	oldAsset, fetchStatus, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: oldAssetID})
+	if err != nil {
+		warnf("row %d: fetch old asset %s -> status %d: %v", rowNum, oldAssetID, fetchStatus, err)
+		_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("fetch old asset: %v", err)})
+		return
+	}
+	if oldAsset.ArchivedAt != "" {
+		p.add("unarchive_asset", "asset", oldAssetID, oldAsset.Version, "archived at "+oldAsset.ArchivedAt)
+	}
+	if job.oldAssetPublished && oldAsset.PublishedVersion == 0 {
+		p.add("publish_asset", "asset", oldAssetID, oldAsset.Version, "")
+	}
+
+	entry, entryStatus, err := client.FetchEntry(ctx, contentful.FetchEntryRequest{EntryID: entryID, AllFields: true})
+	if err != nil {
+		warnf("row %d: fetch entry %s -> status %d: %v", rowNum, entryID, entryStatus, err)
+		_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("fetch entry: %v", err)})
+		return
+	}
+	newLinks := linksToAsset(entry, newAssetID)
+	if len(newLinks) == 0 && len(linksToAsset(entry, oldAssetID)) == 0 {
+		warnf("row %d: entry %s links neither asset %s nor %s", rowNum, entryID, newAssetID, oldAssetID)
+		_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("entry links neither asset %s nor %s; not changed", newAssetID, oldAssetID)})
+		return
+	}
+	if len(newLinks) > 0 {
+		p.add("patch_entry", "entry", entryID, entry.Version, fmt.Sprintf("%s: %s -> %s", describeLinks(newLinks), newAssetID, oldAssetID))
+		if job.entryPublished {
+			p.add("publish_entry", "entry", entryID, entry.Version, "")
+		}
+	}
+
+	if cfg.retireNew {
+		newAsset, fetchStatus, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: newAssetID})
+		if err != nil {
+			warnf("row %d: fetch asset %s -> status %d: %v", rowNum, newAssetID, fetchStatus, err)
+			_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("fetch new asset: %v", err)})
+			return
+		}
+		if newAsset.ArchivedAt == "" {
+			if newAsset.PublishedVersion != 0 {
+				p.add("unpublish_asset", "asset", newAssetID, newAsset.Version, "")
+			}
+			p.add("archive_asset", "asset", newAssetID, newAsset.Version, "")
+		}
+	}
+	p.write(planW)
+}
+
+// formatSize renders a Content-Length, which is -1 when unknown
+func formatSize(n int64) string {
+	if n < 0 {
+		return "unknown"
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// parseQuery parses a -query or -asset-query value, e.g. "content_type=document&sys.updatedAt[gte]=2025-01-01"
+func parseQuery(flagName, raw string) (url.Values, error) {
+	query, err := url.ParseQuery(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", flagName, err)
+	}
+	for _, key := range []string{"skip", "limit", "select"} {
+		if query.Has(key) {
+			return nil, fmt.Errorf("invalid %s: %s is set by the tool while paging", flagName, key)
+		}
+	}
+	return query, nil
+}
+
+// queryAssets returns the set of assets matching the -asset-query search parameters
+func queryAssets(ctx context.Context, client *contentful.Client, query url.Values) (map[string]bool, error) {
+	ids, status, err := client.QueryAssetIDs(ctx, contentful.QueryRequest{Query: query})
+	if err != nil {
+		return nil, fmt.Errorf("query assets -> status %d: %v", status, err)
+	}
+	assets := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		assets[id] = true
+	}
+	return assets, nil
+}
+
+// queryJobs pages through the collection the mode works on and returns one job per
+// result, numbered like CSV rows. Archived-list mode queries assets, the other modes
+// entries. When sel is narrowed to assets, only entries whose selected links point at one
+// of them are kept.
+func queryJobs(ctx context.Context, client *contentful.Client, mode string, query url.Values, sel linkSelector) ([]rowJob, error) {
+	var ids []string
+	if mode == "archived-list" {
+		assetIDs, status, err := client.QueryAssetIDs(ctx, contentful.QueryRequest{Query: query})
+		if err != nil {
+			return nil, fmt.Errorf("query assets -> status %d: %v", status, err)
+		}
+		ids = assetIDs
+	} else if sel.assets != nil {
+		// Read the selected links of every matching entry to keep those linking a wanted asset
+		queryReq := contentful.QueryRequest{
+			Query:     query,
+			FieldKeys: sel.fields,
+			Locales:   sel.locales,
+		}
+		entries, status, err := client.QueryEntries(ctx, queryReq)
+		if err != nil {
+			return nil, fmt.Errorf("query entries -> status %d: %v", status, err)
+		}
+		for _, entry := range entries {
+			if len(sel.wantedLinks(entry)) > 0 {
+				ids = append(ids, entry.ID)
+			}
+		}
+	} else {
+		entryIDs, status, err := client.QueryEntryIDs(ctx, contentful.QueryRequest{Query: query})
+		if err != nil {
+			return nil, fmt.Errorf("query entries -> status %d: %v", status, err)
+		}
+		ids = entryIDs
+	}
+
+	jobs := make([]rowJob, 0, len(ids))
+	for i, id := range ids {
+		jobs = append(jobs, rowJob{rowNum: i + 1, entryID: id})
+	}
+	return jobs, nil
+}
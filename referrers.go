@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// Update-mode policies for other entries linking an old asset, selected with -referrers
+const (
+	referrersRefuse = "refuse" // leave the asset alone and report them
+	referrersRelink = "relink" // patch and republish them to the new asset before archiving
+)
+
+// otherReferrers returns the entries that link to assetID, in any field and locale, other
+// than through the links of entryID the row patches itself. The row's entry is included
+// when it links the asset elsewhere too, e.g. in a field not selected with -field.
+func otherReferrers(ctx context.Context, client *contentful.Client, entryID, assetID string, patching []contentful.AssetLink) ([]contentful.Entry, int, error) {
+	entries, status, err := client.FetchEntriesLinkingAsset(ctx, contentful.FetchEntriesLinkingAssetRequest{AssetID: assetID})
+	if err != nil {
+		return nil, status, err
+	}
+	var others []contentful.Entry
+	for _, e := range entries {
+		if e.ID == entryID && len(e.AssetLinks) > 0 {
+			e.AssetLinks = slices.DeleteFunc(slices.Clone(e.AssetLinks), func(link contentful.AssetLink) bool {
+				return slices.Contains(patching, link)
+			})
+			if len(e.AssetLinks) == 0 {
+				continue
+			}
+		}
+		others = append(others, e)
+	}
+	return others, status, nil
+}
+
+// lockEntries locks the row's entry, and with relink the other entries linking assetID,
+// then reads the entry again so the row goes on from its current version. Locks are taken
+// in ID order, so rows sharing entries cannot deadlock; referrers that turn up once locked
+// are added by locking again. Returns the entry, the referrers and the unlock function.
+func lockEntries(ctx context.Context, cfg runConfig, entryID, assetID string, relink bool) (contentful.Entry, []contentful.Entry, func(), int, error) {
+	locked := []string{entryID}
+	for {
+		unlock := entryLocks.lockAll(locked...)
+		entry, status, err := cfg.client.FetchEntry(ctx, cfg.sel.fetchEntryReq(entryID))
+		if err != nil {
+			unlock()
+			return contentful.Entry{}, nil, nil, status, fmt.Errorf("fetch entry: %w", err)
+		}
+		if !relink {
+			return entry, nil, unlock, status, nil
+		}
+		others, status, err := otherReferrers(ctx, cfg.client, entryID, assetID, cfg.sel.linksTo(entry, assetID))
+		if err != nil {
+			unlock()
+			return contentful.Entry{}, nil, nil, status, fmt.Errorf("find referring entries: %w", err)
+		}
+		missing := false
+		for _, ref := range others {
+			if !slices.Contains(locked, ref.ID) {
+				locked = append(locked, ref.ID)
+				missing = true
+			}
+		}
+		if !missing {
+			return entry, others, unlock, status, nil
+		}
+		unlock()
+	}
+}
+
+// relinkReferrers patches every link of the referrers to oldAssetID to point at newAssetID.
+// The caller holds their entry locks. Referrers that were published without pending
+// changes are republished; drafts and entries with pending changes are only patched, so no
+// unreviewed content goes live. The row's own entry is published by the row itself. Each
+// other relinked referrer gets its own success.csv line, whose entry_published column tells
+// the two apart, and whose old_asset_published column is oldPublished. Version conflicts are
+// handled by the conflicts policy.
+func relinkReferrers(ctx context.Context, cfg runConfig, referrers []contentful.Entry, entryID, oldAssetID, newAssetID string, oldPublished bool, rowNum int, successW *rowWriter) error {
+	for _, ref := range referrers {
+		if len(ref.AssetLinks) == 0 {
+			warnf("row %d: referring entry %s links asset %s outside any asset link field", rowNum, ref.ID, oldAssetID)
+			return fmt.Errorf("referring entry %s links the asset outside any asset link field", ref.ID)
+		}
+		patchReq := contentful.PatchEntryAssetLinkRequest{
+			EntryID:    ref.ID,
+			Links:      ref.AssetLinks,
+			NewAssetID: newAssetID,
+			Version:    ref.Version,
+		}
+		// The row publishes its own entry once its selected links are patched too
+		publish := ref.ID == entryID || republishable(ref)
+		newVersion, patchStatus, err := patchEntryLinks(ctx, cfg.client, cfg.conflicts, patchReq, oldAssetID, publish)
+		if err != nil {
+			warnf("row %d: patch referring entry %s -> status %d: %v", rowNum, ref.ID, patchStatus, err)
+			return fmt.Errorf("patch referring entry %s: %v", ref.ID, err)
+		}
+		if ref.ID == entryID {
+			continue
+		}
+		if publish {
+			publishReq := contentful.PublishEntryRequest{
+				EntryID: ref.ID,
+				Version: newVersion,
+			}
+			if pubStatus, err := publishEntryLinks(ctx, cfg.client, cfg.conflicts, publishReq, ref.AssetLinks, newAssetID); err != nil {
+				warnf("row %d: publish referring entry %s -> status %d: %v", rowNum, ref.ID, pubStatus, err)
+				return fmt.Errorf("publish referring entry %s: %v", ref.ID, err)
+			}
+		} else {
+			warnf("row %d: referring entry %s relinked but left unpublished: it was a draft or had pending changes", rowNum, ref.ID)
+		}
+		_ = successW.Write([]string{ref.ID, oldAssetID, newAssetID, strconv.FormatBool(publish), strconv.FormatBool(oldPublished)})
+	}
+	return nil
+}
+
+// republishable reports whether the entry is published with no pending changes
+func republishable(e contentful.Entry) bool {
+	return e.PublishedVersion != 0 && e.Version == e.PublishedVersion+1
+}
+
+// describeReferrers renders entries and their links, e.g. "abc (heroImage.en-US, gallery.de-DE[1])"
+func describeReferrers(entries []contentful.Entry) string {
+	parts := make([]string, 0, len(entries))
+	for _, e := range entries {
+		parts = append(parts, fmt.Sprintf("%s (%s)", e.ID, describeLinks(e.AssetLinks)))
+	}
+	return strings.Join(parts, ", ")
+}
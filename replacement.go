@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// replacement holds a row's optional new file and metadata overrides for update mode.
+// Empty fields keep the old asset's file and metadata.
+type replacement struct {
+	file        string // local path of the new file
+	url         string // URL to download the new file from
+	title       string
+	description string
+	fileName    string
+	contentType string
+}
+
+// hasFile reports whether the row supplies a new file for the asset's primary locale
+func (r replacement) hasFile() bool {
+	return r.file != "" || r.url != ""
+}
+
+// source describes where the new file comes from, for plans and warnings
+func (r replacement) source() string {
+	if r.file != "" {
+		return r.file
+	}
+	return r.url
+}
+
+// apply returns asset with the row's metadata overrides applied to its primary locale
+func (r replacement) apply(asset contentful.Asset) contentful.Asset {
+	if r.title != "" {
+		asset.Title = r.title
+	}
+	if r.description != "" {
+		asset.Description = r.description
+	}
+	if r.fileName != "" {
+		asset.FileName = r.fileName
+	}
+	if r.contentType != "" {
+		asset.ContentType = r.contentType
+	}
+	return asset
+}
+
+// urlSource returns asset with its primary file swapped for the replacement URL, so it
+// can be downloaded like the asset's own file under the name the URL ends in
+func (r replacement) urlSource(asset contentful.Asset) contentful.Asset {
+	asset.FileURL = r.url
+	asset.FileName = ""
+	return asset
+}
+
+// columnIndex maps the names in an update-mode header row to their positions
+func columnIndex(header []string) map[string]int {
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	return cols
+}
+
+// parseReplacement reads the replacement columns of record. A row may name a local file
+// or a URL, not both.
+func parseReplacement(record []string, cols map[string]int) (replacement, error) {
+	get := func(name string) string {
+		if i, ok := cols[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	r := replacement{
+		file:        get("replacement_file"),
+		url:         get("replacement_url"),
+		title:       get("title"),
+		description: get("description"),
+		fileName:    get("file_name"),
+		contentType: get("content_type"),
+	}
+	if r.file != "" && r.url != "" {
+		return replacement{}, fmt.Errorf("replacement_file and replacement_url are mutually exclusive")
+	}
+	if r.url != "" {
+		// Protocol-relative URLs, as Contentful serves them, are fetched over https
+		u, err := url.Parse(r.url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "") || u.Host == "" {
+			return replacement{}, fmt.Errorf("replacement_url %q is not an http(s) URL", r.url)
+		}
+	}
+	return r, nil
+}
+
+// replacedFileLocales returns the locales whose files make up the new asset: the asset's
+// file locales, plus its primary locale when the row supplies a file for it
+func replacedFileLocales(asset contentful.Asset, repl replacement) []string {
+	locales := asset.FileLocales()
+	if repl.hasFile() && !slices.Contains(locales, asset.Locale) {
+		locales = append([]string{asset.Locale}, locales...)
+	}
+	return locales
+}
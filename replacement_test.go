@@ -0,0 +1,80 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []string
+		want   map[string]int
+	}{
+		{name: "entry_id only", header: []string{"entry_id"}, want: map[string]int{"entry_id": 0}},
+		{
+			name:   "replacement and metadata columns",
+			header: []string{"entry_id", "replacement_file", "title", "content_type"},
+			want:   map[string]int{"entry_id": 0, "replacement_file": 1, "title": 2, "content_type": 3},
+		},
+		{
+			name:   "case and padding ignored",
+			header: []string{"Entry_ID", " Replacement_URL ", "FILE_NAME"},
+			want:   map[string]int{"entry_id": 0, "replacement_url": 1, "file_name": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := columnIndex(tt.header); !maps.Equal(got, tt.want) {
+				t.Errorf("columnIndex(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReplacement(t *testing.T) {
+	cols := columnIndex([]string{"entry_id", "replacement_file", "replacement_url", "title", "description", "file_name", "content_type"})
+
+	tests := []struct {
+		name    string
+		record  []string
+		cols    map[string]int
+		want    replacement
+		wantErr string
+	}{
+		{name: "no header row", record: []string{"e1", "new.pdf"}, cols: nil, want: replacement{}},
+		{name: "entry only", record: []string{"e1"}, cols: cols, want: replacement{}},
+		{name: "local file", record: []string{"e1", " files/new.pdf ", ""}, cols: cols, want: replacement{file: "files/new.pdf"}},
+		{name: "https URL", record: []string{"e1", "", "https://example.com/new.pdf"}, cols: cols, want: replacement{url: "https://example.com/new.pdf"}},
+		{name: "protocol-relative URL", record: []string{"e1", "", "//assets.ctfassets.net/new.pdf"}, cols: cols, want: replacement{url: "//assets.ctfassets.net/new.pdf"}},
+		{
+			name:   "metadata overrides",
+			record: []string{"e1", "", "", "Annual report", "2024 edition", "report-2024.pdf", "application/pdf"},
+			cols:   cols,
+			want:   replacement{title: "Annual report", description: "2024 edition", fileName: "report-2024.pdf", contentType: "application/pdf"},
+		},
+		{name: "both file and URL", record: []string{"e1", "new.pdf", "https://example.com/new.pdf"}, cols: cols, wantErr: "mutually exclusive"},
+		{name: "ftp URL", record: []string{"e1", "", "ftp://example.com/new.pdf"}, cols: cols, wantErr: "not an http(s) URL"},
+		{name: "URL without a host", record: []string{"e1", "", "new.pdf"}, cols: cols, wantErr: "not an http(s) URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseReplacement(tt.record, tt.cols)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseReplacement(%q) error = %v, want one containing %q", tt.record, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseReplacement(%q): %v", tt.record, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseReplacement(%q) = %+v, want %+v", tt.record, got, tt.want)
+			}
+		})
+	}
+}
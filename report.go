@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// version is the tool version recorded in the run report; set it at build time with
+// -ldflags "-X main.version=v1.2.3"
+var version = ""
+
+// toolVersion returns version, or the module version or VCS revision the binary was built from
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return info.Main.Version
+}
+
+// Row outcomes recorded in the run report
+const (
+	outcomeSucceeded = "succeeded" // only success lines were written
+	outcomeFailed    = "failed"    // only failed lines were written
+	outcomePartial   = "partial"   // both, e.g. one of two assets of an entry failed
+	outcomeSkipped   = "skipped"   // neither; see the WARN lines on stderr
+)
+
+// runRecord is the first line of the run report
+type runRecord struct {
+	Type        string    `json:"type"` // "run"
+	Version     string    `json:"version"`
+	SpaceID     string    `json:"space_id"`
+	Environment string    `json:"environment"`
+	Mode        string    `json:"mode"`
+	DryRun      bool      `json:"dry_run"`
+	Source      string    `json:"source"` // the CSV path or the -query
+	StartedAt   time.Time `json:"started_at"`
+}
+
+// rowRecord reports one row, or in list and archived-list modes one batch of rows
+type rowRecord struct {
+	Type       string           `json:"type"` // "row" or "batch"
+	Row        int              `json:"row"`
+	LastRow    int              `json:"last_row,omitempty"` // batches only
+	Rows       int              `json:"rows,omitempty"`     // batches only: the rows in the batch, leaving out skipped lines
+	ID         string           `json:"id,omitempty"`       // the row's entry ID (asset ID in archived-list mode)
+	StartedAt  time.Time        `json:"started_at"`
+	DurationMS int64            `json:"duration_ms"`
+	Retries    int              `json:"retries"`
+	Outcome    string           `json:"outcome"`
+	Errors     []string         `json:"errors,omitempty"`
+	Requests   []requestRecord  `json:"requests"`
+	Checksums  []checksumRecord `json:"checksums,omitempty"` // update mode: uploaded files checked after processing
+}
+
+// requestRecord reports one API or file request made for a row
+type requestRecord struct {
+	Step       string `json:"step"` // e.g. "publish entry"
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Status     int    `json:"status"`
+	RequestID  string `json:"request_id,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Retries    int    `json:"retries"`
+	Error      string `json:"error,omitempty"`
+}
+
+// checksumRecord compares the SHA-256 of an uploaded file with that of the file the
+// processed asset serves
+type checksumRecord struct {
+	AssetID  string `json:"asset_id"`
+	Locale   string `json:"locale"`
+	Uploaded string `json:"uploaded_sha256"`
+	Served   string `json:"served_sha256"`
+	Match    bool   `json:"match"`
+}
+
+// summaryRecord is the last line of the run report
+type summaryRecord struct {
+	Type       string         `json:"type"` // "summary"
+	EndedAt    time.Time      `json:"ended_at"`
+	DurationMS int64          `json:"duration_ms"`
+	Rows       int            `json:"rows"`
+	Outcomes   map[string]int `json:"outcomes"`
+}
+
+// runReport writes the NDJSON run report: a run record, one record per row as it finishes
+// and a summary. A nil report writes nothing.
+type runReport struct {
+	mu       sync.Mutex
+	f        *os.File
+	enc      *json.Encoder
+	started  time.Time
+	rows     int
+	outcomes map[string]int
+}
+
+// openReport creates the report at path and writes the run record
+func openReport(path string, run runRecord) (*runReport, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	rep := &runReport{f: f, enc: json.NewEncoder(f), started: run.StartedAt, outcomes: make(map[string]int)}
+	run.Type = "run"
+	if err := rep.enc.Encode(run); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return rep, nil
+}
+
+// Close writes the summary record and closes the report
+func (rep *runReport) Close() error {
+	if rep == nil {
+		return nil
+	}
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	now := time.Now()
+	err := rep.enc.Encode(summaryRecord{
+		Type:       "summary",
+		EndedAt:    now,
+		DurationMS: now.Sub(rep.started).Milliseconds(),
+		Rows:       rep.rows,
+		Outcomes:   rep.outcomes,
+	})
+	if cerr := rep.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// rowTrace follows one row (or batch) while it is processed
+type rowTrace struct {
+	rep     *runReport
+	record  rowRecord
+	rows    int
+	log     *contentful.RequestLog
+	retries *contentful.RetryCounter
+
+	mu                  sync.Mutex
+	succeeded, failed   int
+	succeededW, failedW *rowWriter
+}
+
+// startRow begins tracing a row, or a batch of rows CSV rows read from lines first to
+// last, returning a context that records its requests and retries, and writers that note
+// its outcome while writing through successW and failedW. Lines skipped between first and
+// last, e.g. empty ones, are not counted.
+func (rep *runReport) startRow(ctx context.Context, kind string, first, last, rows int, id string, successW, failedW *rowWriter) (context.Context, *rowTrace) {
+	ctx, retries := contentful.WithRetryCounter(ctx)
+	t := &rowTrace{rep: rep, retries: retries, rows: rows}
+	t.record = rowRecord{Type: kind, Row: first, ID: id, StartedAt: time.Now()}
+	if last != first {
+		t.record.LastRow = last
+	}
+	if kind == "batch" {
+		t.record.Rows = rows
+	}
+	if rep != nil {
+		ctx, t.log = contentful.WithRequestLog(ctx)
+	}
+	ctx = context.WithValue(ctx, rowTraceKey{}, t)
+	t.succeededW = successW.observed(func([]string) { t.note(false, "") })
+	t.failedW = failedW.observed(func(record []string) {
+		// Failed rows end with their error; not_found.csv lines name the missing item
+		msg := ""
+		if kind == "batch" && len(record) > 1 {
+			msg = "not found: " + strings.Join(record[1:], " ")
+		} else if len(record) > 0 {
+			msg = record[len(record)-1]
+		}
+		t.note(true, msg)
+	})
+	return ctx, t
+}
+
+// failRow reports a row that fails before it reaches a worker, e.g. one whose CSV columns
+// cannot be used, writing its failed line through failedW
+func (rep *runReport) failRow(ctx context.Context, rowNum int, id string, failedW *rowWriter, record []string) {
+	_, t := rep.startRow(ctx, "row", rowNum, rowNum, 1, id, nil, failedW)
+	_ = t.failedW.Write(record)
+	t.finish()
+}
+
+// rowTraceKey is the context key of the row's rowTrace
+type rowTraceKey struct{}
+
+// noteChecksum records a checksum comparison in the report of the row traced by ctx
+func noteChecksum(ctx context.Context, rec checksumRecord) {
+	t, ok := ctx.Value(rowTraceKey{}).(*rowTrace)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record.Checksums = append(t.record.Checksums, rec)
+}
+
+// Retries returns the retries made for the row so far
+func (t *rowTrace) Retries() int {
+	return t.retries.Count()
+}
+
+// note counts a success or failure line written for the row
+func (t *rowTrace) note(failed bool, msg string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !failed {
+		t.succeeded++
+		return
+	}
+	t.failed++
+	if msg != "" {
+		t.record.Errors = append(t.record.Errors, msg)
+	}
+}
+
+// finish writes the row's record to the report
+func (t *rowTrace) finish() {
+	rep := t.rep
+	if rep == nil {
+		return
+	}
+	t.mu.Lock()
+	rec := t.record
+	switch {
+	case t.failed > 0 && t.succeeded > 0:
+		rec.Outcome = outcomePartial
+	case t.failed > 0:
+		rec.Outcome = outcomeFailed
+	case t.succeeded > 0:
+		rec.Outcome = outcomeSucceeded
+	default:
+		rec.Outcome = outcomeSkipped
+	}
+	t.mu.Unlock()
+
+	rec.DurationMS = time.Since(rec.StartedAt).Milliseconds()
+	rec.Retries = t.retries.Count()
+	rec.Requests = []requestRecord{}
+	for _, r := range t.log.Requests() {
+		rec.Requests = append(rec.Requests, requestRecord{
+			Step:       r.Step,
+			Method:     r.Method,
+			Path:       r.Path,
+			Status:     r.Status,
+			RequestID:  r.RequestID,
+			DurationMS: r.Duration.Milliseconds(),
+			Retries:    r.Retries,
+			Error:      r.Err,
+		})
+	}
+
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	rep.rows += t.rows
+	rep.outcomes[rec.Outcome] += t.rows
+	_ = rep.enc.Encode(rec)
+}
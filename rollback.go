@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// processRollback reverts one replacement recorded by update mode: it restores the old
+// asset (unarchive, and publish unless it was a draft), points the entry back at it and
+// republishes the entry, unless update mode left the entry unpublished. Every link of the entry to the new asset is
+// reverted, whatever -field and -locale select, since update mode may have relinked links
+// outside the selection. With cfg.retireNew, the replacement asset is then unpublished and
+// archived. Version conflicts are handled by the conflicts policy.
+func processRollback(ctx context.Context, cfg runConfig, job rowJob, successW, failedW *rowWriter) {
+	client, conflicts := cfg.client, cfg.conflicts
+	entryID, oldAssetID, newAssetID := job.entryID, job.oldAssetID, job.newAssetID
+	rowNum := job.rowNum
+
+	// 1) Restore the old asset: unarchive it, then publish it if it was published before
+	oldAsset, fetchStatus, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: oldAssetID})
+	if err != nil {
+		warnf("row %d: fetch old asset %s -> status %d: %v", rowNum, oldAssetID, fetchStatus, err)
+		_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("fetch old asset: %v", err)})
+		return
+	}
+	version := oldAsset.Version
+	if oldAsset.ArchivedAt != "" {
+		unarchiveReq := contentful.UnarchiveAssetRequest{
+			AssetID: oldAssetID,
+			Version: version,
+		}
+		var unarchiveStatus int
+		version, unarchiveStatus, err = unarchiveAsset(ctx, client, conflicts, unarchiveReq, oldAsset)
+		if err != nil {
+			warnf("row %d: unarchive asset %s -> status %d: %v", rowNum, oldAssetID, unarchiveStatus, err)
+			_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("unarchive old asset: %v", err)})
+			return
+		}
+	}
+	if job.oldAssetPublished && oldAsset.PublishedVersion == 0 {
+		publishReq := contentful.PublishAssetRequest{
+			AssetID: oldAssetID,
+			Version: version,
+		}
+		if pubStatus, perr := publishAsset(ctx, client, conflicts, publishReq, oldAsset); perr != nil {
+			warnf("row %d: publish asset %s -> status %d: %v", rowNum, oldAssetID, pubStatus, perr)
+			_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("publish old asset: %v", perr)})
+			return
+		}
+	}
+
+	// 2) Point the entry's links to the new asset back at the old asset, unless an earlier
+	// rollback already did. Entries that link neither asset were changed since the run and
+	// are left alone.
+	entry, entryStatus, err := client.FetchEntry(ctx, contentful.FetchEntryRequest{EntryID: entryID, AllFields: true})
+	if err != nil {
+		warnf("row %d: fetch entry %s -> status %d: %v", rowNum, entryID, entryStatus, err)
+		_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("fetch entry: %v", err)})
+		return
+	}
+	newLinks := linksToAsset(entry, newAssetID)
+	if len(newLinks) == 0 && len(linksToAsset(entry, oldAssetID)) == 0 {
+		warnf("row %d: entry %s links neither asset %s nor %s", rowNum, entryID, newAssetID, oldAssetID)
+		_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("entry links neither asset %s nor %s; not changed", newAssetID, oldAssetID)})
+		return
+	}
+	if len(newLinks) > 0 {
+		patchReq := contentful.PatchEntryAssetLinkRequest{
+			EntryID:    entryID,
+			Links:      newLinks,
+			NewAssetID: oldAssetID,
+			Version:    entry.Version,
+		}
+		newVersion, updStatus, uerr := patchEntryLinks(ctx, client, conflicts, patchReq, newAssetID, job.entryPublished)
+		if uerr != nil {
+			warnf("row %d: patch entry %s -> status %d: %v", rowNum, entryID, updStatus, uerr)
+			_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("patch entry: %v", uerr)})
+			return
+		}
+		// A referring entry that update mode only patched was a draft or had pending
+		// changes, so it is left unpublished again
+		if job.entryPublished {
+			publishReq := contentful.PublishEntryRequest{
+				EntryID: entryID,
+				Version: newVersion,
+			}
+			if pubStatus, perr := publishEntryLinks(ctx, client, conflicts, publishReq, newLinks, oldAssetID); perr != nil {
+				warnf("row %d: publish entry %s -> status %d: %v", rowNum, entryID, pubStatus, perr)
+				_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("publish entry: %v", perr)})
+				return
+			}
+		}
+	}
+
+	// 3) Optionally retire the replacement asset
+	retired := "false"
+	if cfg.retireNew {
+		if err := retireAsset(ctx, client, conflicts, newAssetID, rowNum); err != nil {
+			_ = failedW.Write([]string{entryID, oldAssetID, newAssetID, fmt.Sprintf("retire new asset: %v", err)})
+			return
+		}
+		retired = "true"
+	}
+
+	_ = successW.Write([]string{entryID, oldAssetID, newAssetID, retired})
+}
+
+// linksToAsset returns the entry's links that point at assetID
+func linksToAsset(entry contentful.Entry, assetID string) []contentful.AssetLink {
+	var links []contentful.AssetLink
+	for _, link := range entry.AssetLinks {
+		if link.AssetID == assetID {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// retireAsset unpublishes and archives an asset, skipping whichever state it is already in
+func retireAsset(ctx context.Context, client *contentful.Client, conflicts, assetID string, rowNum int) error {
+	asset, fetchStatus, err := client.FetchAsset(ctx, contentful.FetchAssetRequest{AssetID: assetID})
+	if err != nil {
+		warnf("row %d: fetch asset %s -> status %d: %v", rowNum, assetID, fetchStatus, err)
+		return fmt.Errorf("fetch: %w", err)
+	}
+	if asset.ArchivedAt != "" {
+		return nil
+	}
+
+	version := asset.Version
+	if asset.PublishedVersion != 0 {
+		unpublishReq := contentful.UnpublishAssetRequest{
+			AssetID: assetID,
+			Version: version,
+		}
+		var unpublishStatus int
+		version, unpublishStatus, err = unpublishAsset(ctx, client, conflicts, unpublishReq, asset)
+		if err != nil {
+			warnf("row %d: unpublish asset %s -> status %d: %v", rowNum, assetID, unpublishStatus, err)
+			return fmt.Errorf("unpublish: %w", err)
+		}
+	}
+
+	archiveReq := contentful.ArchiveAssetRequest{
+		AssetID: assetID,
+		Version: version,
+	}
+	if archiveStatus, err := archiveAsset(ctx, client, conflicts, archiveReq, asset); err != nil {
+		warnf("row %d: archive asset %s -> status %d: %v", rowNum, assetID, archiveStatus, err)
+		return fmt.Errorf("archive: %w", err)
+	}
+	return nil
+}
+
+// rollbackJobsFromJournal returns a rollback job for every replacement the journal shows as
+// relinked to a new asset, ordered by entry ID and old asset ID. The journal records the
+// row's own entry, which update mode publishes, and whether the old asset was published.
+func rollbackJobsFromJournal(path string) ([]rowJob, error) {
+	states, err := loadJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]journalKey, 0, len(states))
+	for key, st := range states {
+		if st.Step >= stepEntryPatched && st.OldAssetID != "" && st.NewAssetID != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].EntryID != keys[b].EntryID {
+			return keys[a].EntryID < keys[b].EntryID
+		}
+		return keys[a].OldAssetID < keys[b].OldAssetID
+	})
+
+	jobs := make([]rowJob, 0, len(keys))
+	for i, key := range keys {
+		st := states[key]
+		jobs = append(jobs, rowJob{rowNum: i + 1, entryID: key.EntryID, oldAssetID: st.OldAssetID, newAssetID: st.NewAssetID, entryPublished: true, oldAssetPublished: !st.OldAssetDraft})
+	}
+	return jobs, nil
+}
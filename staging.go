@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"contentful-asset-replacer/contentful"
+)
+
+// fileStaging says how update mode stages the files it re-uploads
+type fileStaging struct {
+	stream bool // pipe each file from the CDN into its upload instead of saving it under downloaded/
+	spool  bool // with stream: spool each file to disk while uploading so a failed upload can be retried
+	keep   bool // keep the files under downloaded/ after a row succeeds
+
+	transform *imageTransform // when set, image files are re-encoded before they are uploaded
+	fixTypes  bool            // label each file with the content type detected from its bytes
+}
+
+// stagedFiles are the files of one replacement, ready to be put onto an asset
+type stagedFiles struct {
+	paths   map[string]string                  // local file per locale
+	uploads map[string]contentful.UploadedFile // file per locale already streamed into an upload
+	digests map[string]string                  // SHA-256 of every locale's file
+
+	converted    map[string]convertedFile // locales whose image was re-encoded by -transform
+	contentTypes map[string]string        // locales whose content type was corrected by -fix-content-type
+}
+
+// applyTo returns asset with the file names and content types of the converted images,
+// and the corrected content types
+func (files stagedFiles) applyTo(asset contentful.Asset) contentful.Asset {
+	if len(files.converted) == 0 && len(files.contentTypes) == 0 {
+		return asset
+	}
+	localized := make(map[string]contentful.AssetFile, len(asset.Files))
+	for l, f := range asset.Files {
+		localized[l] = f
+	}
+	for l, c := range files.converted {
+		f := localized[l]
+		f.FileName, f.ContentType = c.fileName, c.contentType
+		localized[l] = f
+		if l == asset.Locale {
+			asset.FileName, asset.ContentType = c.fileName, c.contentType
+		}
+	}
+	for l, contentType := range files.contentTypes {
+		f := localized[l]
+		f.ContentType = contentType
+		localized[l] = f
+		if l == asset.Locale {
+			asset.ContentType = contentType
+		}
+	}
+	asset.Files = localized
+	return asset
+}
+
+// correctContentTypes detects the content type of each staged file from its first bytes
+// and name, and stages a correction for those labelled otherwise. Files whose type cannot
+// be detected, and a content type set by the row, are left alone.
+func (staging fileStaging) correctContentTypes(rowNum int, asset contentful.Asset, repl replacement, files stagedFiles) (stagedFiles, error) {
+	files.contentTypes = make(map[string]string)
+	named := files.applyTo(repl.apply(asset))
+	for _, l := range sortedFileLocales(files) {
+		if l == asset.Locale && repl.contentType != "" {
+			continue
+		}
+		f := named.Files[l]
+		if l == asset.Locale {
+			f.FileName, f.ContentType = named.FileName, named.ContentType
+		}
+		var head []byte
+		fileName := f.FileName
+		if up, ok := files.uploads[l]; ok {
+			head = up.Head
+			if strings.TrimSpace(fileName) == "" {
+				fileName = up.FileName
+			}
+		} else {
+			var err error
+			if head, err = fileHead(files.paths[l]); err != nil {
+				return stagedFiles{}, fmt.Errorf("read %s file: %w", l, err)
+			}
+			if strings.TrimSpace(fileName) == "" {
+				fileName = filepath.Base(files.paths[l])
+			}
+		}
+		detected := detectContentType(head, fileName)
+		if auditContentType(f.ContentType, detected) != auditMismatch {
+			continue
+		}
+		warnf("row %d: %s file of asset %s is labelled %q but is %s, correcting it", rowNum, l, asset.ID, f.ContentType, detected)
+		files.contentTypes[l] = detected
+	}
+	return files, nil
+}
+
+// sortedFileLocales returns the locales of the staged files, saved or streamed, in order
+func sortedFileLocales(files stagedFiles) []string {
+	locales := slices.Collect(maps.Keys(files.paths))
+	for l := range files.uploads {
+		if _, ok := files.paths[l]; !ok {
+			locales = append(locales, l)
+		}
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// transformImages re-encodes the image files among files.paths with staging.transform,
+// writing them below the asset's download directory, and stages them in their place.
+// Other files are left as they are.
+func (staging fileStaging) transformImages(assetID string, asset contentful.Asset, repl replacement, files stagedFiles) (stagedFiles, error) {
+	files.converted = make(map[string]convertedFile)
+	named := repl.apply(asset)
+	for _, l := range slices.Sorted(maps.Keys(files.paths)) {
+		fileName := named.Files[l].FileName
+		if l == asset.Locale {
+			fileName = named.FileName
+		}
+		if strings.TrimSpace(fileName) == "" {
+			fileName = filepath.Base(files.paths[l])
+		}
+		converted, ok, err := staging.transform.apply(files.paths[l], filepath.Join(downloadDir(assetID), "transformed", l), fileName)
+		if err != nil {
+			return stagedFiles{}, fmt.Errorf("transform %s file: %w", l, err)
+		}
+		if !ok {
+			continue
+		}
+		sum, err := fileSHA256(converted.path)
+		if err != nil {
+			return stagedFiles{}, fmt.Errorf("read transformed %s file: %w", l, err)
+		}
+		files.paths[l], files.digests[l], files.converted[l] = converted.path, sum, converted
+	}
+	return files, nil
+}
+
+// downloadDir is the directory holding the files staged for an asset
+func downloadDir(assetID string) string {
+	return filepath.Join("downloaded", assetID)
+}
+
+// cleanup removes the files staged for the asset, including those of earlier runs, once
+// its replacement succeeded. A row's own replacement file is never removed.
+func (staging fileStaging) cleanup(assetID string, rowNum int, repl replacement) {
+	if staging.keep {
+		return
+	}
+	dir := downloadDir(assetID)
+	if repl.file != "" {
+		if rel, err := filepath.Rel(dir, repl.file); err == nil && !strings.HasPrefix(rel, "..") {
+			warnf("row %d: replacement file %s is inside %s, keeping the directory", rowNum, repl.file, dir)
+			return
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		warnf("row %d: remove staged files of asset %s: %v", rowNum, assetID, err)
+	}
+}
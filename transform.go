@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Image formats -transform reads and writes
+const (
+	formatKeep = "keep" // write the image in the format it was read in
+	formatJPEG = "jpeg"
+	formatPNG  = "png"
+	formatGIF  = "gif"
+)
+
+// imageTransform re-encodes image files before they are uploaded, selected with -transform.
+// Re-encoding drops EXIF and other metadata; the EXIF orientation of JPEGs is applied first.
+type imageTransform struct {
+	format    string // formatKeep or the format to convert to
+	maxWidth  int    // 0 for no limit
+	maxHeight int    // 0 for no limit
+	quality   int    // JPEG quality, 1-100
+}
+
+// convertedFile is an image file written by an imageTransform
+type convertedFile struct {
+	path        string
+	fileName    string // the asset's file name with the extension of the new format
+	contentType string
+}
+
+// parseTransform parses a -transform spec such as "format=jpeg,max-width=2000,quality=80"
+func parseTransform(spec string) (*imageTransform, error) {
+	t := &imageTransform{format: formatKeep, quality: jpeg.DefaultQuality}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid -transform option %q: want key=value", part)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "format":
+			value = strings.ToLower(value)
+			if value == "jpg" {
+				value = formatJPEG
+			}
+			if value != formatKeep && value != formatJPEG && value != formatPNG && value != formatGIF {
+				return nil, fmt.Errorf("invalid -transform format %q: must be %s, %s, %s or %s", value, formatKeep, formatJPEG, formatPNG, formatGIF)
+			}
+			t.format = value
+		case "max-width", "max-height", "quality":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || (key == "quality" && (n < 1 || n > 100)) {
+				return nil, fmt.Errorf("invalid -transform %s %q", key, value)
+			}
+			switch key {
+			case "max-width":
+				t.maxWidth = n
+			case "max-height":
+				t.maxHeight = n
+			default:
+				t.quality = n
+			}
+		default:
+			return nil, fmt.Errorf("unknown -transform option %q: use format, max-width, max-height or quality", key)
+		}
+	}
+	return t, nil
+}
+
+// apply re-encodes the image at srcPath into destDir, naming it after fileName. Reports
+// false, leaving the file alone, when it is not a PNG, JPEG or still GIF.
+func (t *imageTransform) apply(srcPath, destDir, fileName string) (convertedFile, bool, error) {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return convertedFile{}, false, err
+	}
+	_, srcFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (srcFormat != formatJPEG && srcFormat != formatPNG && srcFormat != formatGIF) {
+		return convertedFile{}, false, nil
+	}
+	if srcFormat == formatGIF {
+		// Only the first frame of an animation would survive
+		if anim, err := gif.DecodeAll(bytes.NewReader(data)); err == nil && len(anim.Image) > 1 {
+			return convertedFile{}, false, nil
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return convertedFile{}, false, fmt.Errorf("decode %s: %w", srcFormat, err)
+	}
+	if srcFormat == formatJPEG {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	b := img.Bounds()
+	if w, h := fitWithin(b.Dx(), b.Dy(), t.maxWidth, t.maxHeight); w != b.Dx() || h != b.Dy() {
+		img = resizeBox(img, w, h)
+	}
+
+	format := t.format
+	if format == formatKeep {
+		format = srcFormat
+	}
+	var buf bytes.Buffer
+	switch format {
+	case formatJPEG:
+		err = jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: t.quality})
+	case formatPNG:
+		err = png.Encode(&buf, img)
+	case formatGIF:
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		return convertedFile{}, false, fmt.Errorf("encode %s: %w", format, err)
+	}
+
+	// Keep an extension that already fits the format, e.g. .jpeg
+	ext := filepath.Ext(fileName)
+	if lower := strings.ToLower(ext); lower != "."+format && !(format == formatJPEG && lower == ".jpg") {
+		ext = "." + format
+		if format == formatJPEG {
+			ext = ".jpg"
+		}
+	}
+	newName := strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ext
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return convertedFile{}, false, err
+	}
+	path := filepath.Join(destDir, newName)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return convertedFile{}, false, err
+	}
+	return convertedFile{path: path, fileName: newName, contentType: "image/" + format}, true, nil
+}
+
+// fitWithin scales w x h down to fit maxW x maxH, keeping the aspect ratio; a zero limit
+// does not constrain
+func fitWithin(w, h, maxW, maxH int) (int, int) {
+	scale := 1.0
+	if maxW > 0 && w > maxW {
+		scale = float64(maxW) / float64(w)
+	}
+	if maxH > 0 && float64(h)*scale > float64(maxH) {
+		scale = float64(maxH) / float64(h)
+	}
+	if scale == 1 {
+		return w, h
+	}
+	return max(1, int(float64(w)*scale+0.5)), max(1, int(float64(h)*scale+0.5))
+}
+
+// resizeBox scales img down to w x h, averaging the source pixels each destination pixel covers
+func resizeBox(img image.Image, w, h int) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*b.Dy()/h, max((y+1)*b.Dy()/h, y*b.Dy()/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*b.Dx()/w, max((x+1)*b.Dx()/w, x*b.Dx()/w+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r, g, bl, a = r+uint64(p[0]), g+uint64(p[1]), bl+uint64(p[2]), a+uint64(p[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(bl/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// flatten composites img onto white, as JPEG has no transparency
+func flatten(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, or 1 when it has none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || size < 2 || i+2+size > len(data) {
+			return 1 // image data starts, or a broken segment
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return exifOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// exifOrientation reads the Orientation tag of IFD0 from a TIFF header
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient returns img turned upright for an EXIF orientation
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if orientation >= 5 {
+		w, h = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = b.Dx()-1-x, y
+			case 3: // rotated 180°
+				dx, dy = b.Dx()-1-x, b.Dy()-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, b.Dy()-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = b.Dy()-1-y, x
+			case 7: // transversed
+				dx, dy = b.Dy()-1-y, b.Dx()-1-x
+			case 8: // rotated 90° counter-clockwise
+				dx, dy = y, b.Dx()-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTransform(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    imageTransform
+		wantErr bool
+	}{
+		{spec: "", want: imageTransform{format: formatKeep, quality: jpeg.DefaultQuality}},
+		{spec: "format=jpg, max-width=2000 ,quality=80", want: imageTransform{format: formatJPEG, maxWidth: 2000, quality: 80}},
+		{spec: "format=PNG,max-height=600", want: imageTransform{format: formatPNG, maxHeight: 600, quality: jpeg.DefaultQuality}},
+		{spec: "format=webp", wantErr: true},
+		{spec: "quality=0", wantErr: true},
+		{spec: "quality=101", wantErr: true},
+		{spec: "max-width=-1", wantErr: true},
+		{spec: "max-width=wide", wantErr: true},
+		{spec: "format", wantErr: true},
+		{spec: "size=3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseTransform(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTransform(%q) = %+v, want an error", tt.spec, *got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTransform(%q): %v", tt.spec, err)
+			}
+			if *got != tt.want {
+				t.Errorf("parseTransform(%q) = %+v, want %+v", tt.spec, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFitWithin(t *testing.T) {
+	tests := []struct {
+		w, h, maxW, maxH int
+		wantW, wantH     int
+	}{
+		{w: 4000, h: 3000, wantW: 4000, wantH: 3000},
+		{w: 4000, h: 3000, maxW: 2000, wantW: 2000, wantH: 1500},
+		{w: 4000, h: 3000, maxH: 600, wantW: 800, wantH: 600},
+		{w: 4000, h: 3000, maxW: 2000, maxH: 600, wantW: 800, wantH: 600},
+		{w: 800, h: 600, maxW: 2000, maxH: 2000, wantW: 800, wantH: 600},
+		{w: 1000, h: 1, maxW: 10, wantW: 10, wantH: 1},
+	}
+
+	for _, tt := range tests {
+		if w, h := fitWithin(tt.w, tt.h, tt.maxW, tt.maxH); w != tt.wantW || h != tt.wantH {
+			t.Errorf("fitWithin(%d, %d, %d, %d) = %d x %d, want %d x %d", tt.w, tt.h, tt.maxW, tt.maxH, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3 x 2 image with red top-left and green top-right corners
+	red, green := color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.Set(0, 0, red)
+	src.Set(2, 0, green)
+
+	tests := []struct {
+		orientation int
+		w, h        int
+		red, green  image.Point
+	}{
+		{orientation: 1, w: 3, h: 2, red: image.Pt(0, 0), green: image.Pt(2, 0)},
+		{orientation: 2, w: 3, h: 2, red: image.Pt(2, 0), green: image.Pt(0, 0)},
+		{orientation: 3, w: 3, h: 2, red: image.Pt(2, 1), green: image.Pt(0, 1)},
+		{orientation: 4, w: 3, h: 2, red: image.Pt(0, 1), green: image.Pt(2, 1)},
+		{orientation: 5, w: 2, h: 3, red: image.Pt(0, 0), green: image.Pt(0, 2)},
+		{orientation: 6, w: 2, h: 3, red: image.Pt(1, 0), green: image.Pt(1, 2)},
+		{orientation: 7, w: 2, h: 3, red: image.Pt(1, 2), green: image.Pt(1, 0)},
+		{orientation: 8, w: 2, h: 3, red: image.Pt(0, 2), green: image.Pt(0, 0)},
+		{orientation: 9, w: 3, h: 2, red: image.Pt(0, 0), green: image.Pt(2, 0)},
+	}
+
+	for _, tt := range tests {
+		img := orient(src, tt.orientation)
+		if b := img.Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("orientation %d: %d x %d, want %d x %d", tt.orientation, b.Dx(), b.Dy(), tt.w, tt.h)
+			continue
+		}
+		if got := color.RGBAModel.Convert(img.At(tt.red.X, tt.red.Y)); got != red {
+			t.Errorf("orientation %d: pixel %v = %v, want red", tt.orientation, tt.red, got)
+		}
+		if got := color.RGBAModel.Convert(img.At(tt.green.X, tt.green.Y)); got != green {
+			t.Errorf("orientation %d: pixel %v = %v, want green", tt.orientation, tt.green, got)
+		}
+	}
+}
+
+// encodeJPEG returns a w x h JPEG carrying an EXIF orientation tag in the given byte order,
+// or no EXIF segment when orientation is zero
+func encodeJPEG(t *testing.T, w, h, orientation int, order binary.AppendByteOrder) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if orientation == 0 {
+		return data
+	}
+
+	tiff := []byte("II")
+	if order == binary.BigEndian {
+		tiff = []byte("MM")
+	}
+	tiff = order.AppendUint16(tiff, 42)
+	tiff = order.AppendUint32(tiff, 8) // IFD0 follows the header
+	tiff = order.AppendUint16(tiff, 1) // one entry
+	tiff = order.AppendUint16(tiff, 0x0112)
+	tiff = order.AppendUint16(tiff, 3) // SHORT
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0, 0)
+	tiff = order.AppendUint32(tiff, 0) // no next IFD
+
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(len(seg)+2))
+	app1 = append(app1, seg...)
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{name: "little-endian EXIF", data: encodeJPEG(t, 4, 2, 6, binary.LittleEndian), want: 6},
+		{name: "big-endian EXIF", data: encodeJPEG(t, 4, 2, 8, binary.BigEndian), want: 8},
+		{name: "no EXIF", data: encodeJPEG(t, 4, 2, 0, nil), want: 1},
+		{name: "out of range", data: encodeJPEG(t, 4, 2, 12, binary.LittleEndian), want: 1},
+		{name: "truncated", data: encodeJPEG(t, 4, 2, 6, binary.LittleEndian)[:20], want: 1},
+		{name: "not a JPEG", data: []byte("%PDF-1.7\n"), want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("jpegOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageTransformApply(t *testing.T) {
+	var transparentPNG bytes.Buffer
+	if err := png.Encode(&transparentPNG, image.NewNRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	palette := color.Palette{color.Black, color.White}
+	var stillGIF, animatedGIF bytes.Buffer
+	frame := image.NewPaletted(image.Rect(0, 0, 8, 8), palette)
+	if err := gif.Encode(&stillGIF, frame, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.EncodeAll(&animatedGIF, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		spec            string
+		fileName        string
+		data            []byte
+		wantOK          bool
+		wantFileName    string
+		wantContentType string
+		wantW, wantH    int
+		wantWhite       bool // the top-left pixel, transparent in data, is white
+	}{
+		{
+			name:            "transparent PNG to a resized JPEG",
+			spec:            "format=jpeg,max-width=20",
+			fileName:        "logo.png",
+			data:            transparentPNG.Bytes(),
+			wantOK:          true,
+			wantFileName:    "logo.jpg",
+			wantContentType: "image/jpeg",
+			wantW:           20,
+			wantH:           10,
+			wantWhite:       true,
+		},
+		{
+			name:            "rotated JPEG turned upright and its extension kept",
+			spec:            "quality=90",
+			fileName:        "photo.JPEG",
+			data:            encodeJPEG(t, 40, 20, 6, binary.LittleEndian),
+			wantOK:          true,
+			wantFileName:    "photo.JPEG",
+			wantContentType: "image/jpeg",
+			wantW:           20,
+			wantH:           40,
+		},
+		{
+			name:            "rotated JPEG resized after turning",
+			spec:            "max-height=20",
+			fileName:        "photo.jpg",
+			data:            encodeJPEG(t, 40, 20, 8, binary.BigEndian),
+			wantOK:          true,
+			wantFileName:    "photo.jpg",
+			wantContentType: "image/jpeg",
+			wantW:           10,
+			wantH:           20,
+		},
+		{
+			name:            "still GIF to PNG",
+			spec:            "format=png",
+			fileName:        "icon.gif",
+			data:            stillGIF.Bytes(),
+			wantOK:          true,
+			wantFileName:    "icon.png",
+			wantContentType: "image/png",
+			wantW:           8,
+			wantH:           8,
+		},
+		{
+			name:     "animated GIF left alone",
+			spec:     "format=png",
+			fileName: "spinner.gif",
+			data:     animatedGIF.Bytes(),
+		},
+		{
+			name:     "not an image",
+			spec:     "format=jpeg",
+			fileName: "report.pdf",
+			data:     []byte("%PDF-1.7\n"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transform, err := parseTransform(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := t.TempDir()
+			src := filepath.Join(dir, "download")
+			if err := os.WriteFile(src, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			out, ok, err := transform.apply(src, filepath.Join(dir, "converted"), tt.fileName)
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("apply converted = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if out.fileName != tt.wantFileName || out.contentType != tt.wantContentType {
+				t.Errorf("converted to %s (%s), want %s (%s)", out.fileName, out.contentType, tt.wantFileName, tt.wantContentType)
+			}
+			data, err := os.ReadFile(out.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("decode converted file: %v", err)
+			}
+			if "image/"+format != tt.wantContentType || cfg.Width != tt.wantW || cfg.Height != tt.wantH {
+				t.Errorf("converted file is a %d x %d %s, want %d x %d %s", cfg.Width, cfg.Height, format, tt.wantW, tt.wantH, tt.wantContentType)
+			}
+			if o := jpegOrientation(data); o != 1 {
+				t.Errorf("converted file keeps EXIF orientation %d", o)
+			}
+			if tt.wantWhite {
+				img, _, err := image.Decode(bytes.NewReader(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r, g, b, _ := img.At(0, 0).RGBA(); r>>8 < 240 || g>>8 < 240 || b>>8 < 240 {
+					t.Errorf("transparent pixel became %v, want white", img.At(0, 0))
+				}
+			}
+		})
+	}
+}